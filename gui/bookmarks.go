@@ -0,0 +1,218 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package gui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/spezifisch/stmps/mpvplayer"
+	"github.com/spezifisch/stmps/service"
+)
+
+// autoBookmarks tracks the long song playing, it's bookmarked on the server
+// when it's paused, skipped or stmps quits. It's used by the gui event loop
+// and on quit.
+type autoBookmarks struct {
+	mu sync.Mutex
+	// bookmark positions of songs by their ID, in milliseconds
+	positions map[string]int64
+	// the long song playing, Id is "" if there's none
+	item mpvplayer.QueueItem
+	// seconds
+	position int64
+	// no resume is offered when this song starts the next time, it's
+	// already played from a saved position
+	skipOfferId string
+}
+
+// setPositions replaces the known bookmarks with those of the server.
+func (a *autoBookmarks) setPositions(bookmarks []service.Bookmark) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.positions = make(map[string]int64, len(bookmarks))
+	for _, bookmark := range bookmarks {
+		a.positions[bookmark.Entry.Id] = bookmark.Position
+	}
+}
+
+// skipOffer keeps the resume offer from showing when the song with ID id
+// starts the next time.
+func (a *autoBookmarks) skipOffer(id string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.skipOfferId = id
+}
+
+// bookmarkable reports whether item is long enough to be bookmarked. Radio
+// stations aren't songs of the server and podcast episodes resume on their
+// own.
+func (ui *Ui) bookmarkable(item mpvplayer.QueueItem) bool {
+	threshold := ui.connection.Conf().BookmarkThreshold
+	return threshold > 0 && !item.Live && !item.Podcast && time.Duration(item.Duration)*time.Second > threshold
+}
+
+// bookmarkSongStarted bookmarks the long song played before item and offers
+// to resume item from its bookmark.
+func (ui *Ui) bookmarkSongStarted(item mpvplayer.QueueItem) {
+	bookmarkable := ui.bookmarkable(item)
+
+	a := &ui.autoBookmarks
+	a.mu.Lock()
+	previous, position := a.item, a.position
+	a.item, a.position = mpvplayer.QueueItem{}, 0
+	if bookmarkable {
+		a.item = item
+	}
+	offerPosition := a.positions[item.Id]
+	if a.skipOfferId != "" {
+		if a.skipOfferId == item.Id {
+			offerPosition = 0
+		}
+		a.skipOfferId = ""
+	}
+	a.mu.Unlock()
+
+	if previous.Id != "" {
+		go ui.saveBookmark(ui.ctx, previous, position)
+	}
+	if bookmarkable && offerPosition >= mpvplayer.ResumeMinPosition*1000 {
+		ui.app.QueueUpdateDraw(func() {
+			ui.offerBookmark(item, offerPosition)
+		})
+	}
+}
+
+// bookmarkPaused is called for EventPaused, which is also sent when a song
+// starts paused.
+func (ui *Ui) bookmarkPaused(item mpvplayer.QueueItem) {
+	ui.autoBookmarks.mu.Lock()
+	current, position := ui.autoBookmarks.item, ui.autoBookmarks.position
+	ui.autoBookmarks.mu.Unlock()
+
+	if current.Id == "" || current.Id != item.Id {
+		ui.bookmarkSongStarted(item)
+		return
+	}
+	go ui.saveBookmark(ui.ctx, current, position)
+}
+
+// bookmarkStopped bookmarks the long song that played when playback stopped.
+func (ui *Ui) bookmarkStopped() {
+	a := &ui.autoBookmarks
+	a.mu.Lock()
+	current, position := a.item, a.position
+	a.item, a.position = mpvplayer.QueueItem{}, 0
+	a.mu.Unlock()
+
+	if current.Id != "" {
+		go ui.saveBookmark(ui.ctx, current, position)
+	}
+}
+
+// updateBookmarkPosition remembers where the long song playing is.
+func (ui *Ui) updateBookmarkPosition(position int64) {
+	ui.autoBookmarks.mu.Lock()
+	defer ui.autoBookmarks.mu.Unlock()
+	if ui.autoBookmarks.item.Id != "" {
+		ui.autoBookmarks.position = position
+	}
+}
+
+// saveCurrentBookmark bookmarks the long song playing, it's called on quit.
+func (ui *Ui) saveCurrentBookmark(ctx context.Context) {
+	ui.autoBookmarks.mu.Lock()
+	current, position := ui.autoBookmarks.item, ui.autoBookmarks.position
+	ui.autoBookmarks.mu.Unlock()
+
+	if current.Id != "" {
+		ui.saveBookmark(ctx, current, position)
+	}
+}
+
+// saveBookmark bookmarks item at position seconds, or deletes its bookmark
+// if it's finished. Songs left too early keep their previous bookmark.
+func (ui *Ui) saveBookmark(ctx context.Context, item mpvplayer.QueueItem, position int64) {
+	resume, finished := mpvplayer.ResumeFrom(position, int64(item.Duration))
+	if !resume && !finished {
+		return
+	}
+
+	a := &ui.autoBookmarks
+	a.mu.Lock()
+	saved, ok := a.positions[item.Id]
+	a.mu.Unlock()
+
+	var err error
+	switch {
+	case finished && !ok:
+		return
+	case finished:
+		err = ui.connection.DeleteBookmark(ctx, item.Id)
+		if errors.Is(err, service.ErrNotFound) {
+			// deleted elsewhere
+			err = nil
+		}
+	case ok && saved == position*1000:
+		return
+	default:
+		err = ui.connection.CreateBookmark(ctx, item.Id, position*1000, "")
+	}
+	if err != nil {
+		ui.logger.Error("saving the bookmark of %s: %v", item.Id, err)
+		return
+	}
+
+	a.mu.Lock()
+	if a.positions == nil {
+		a.positions = map[string]int64{}
+	}
+	if finished {
+		delete(a.positions, item.Id)
+	} else {
+		a.positions[item.Id] = position * 1000
+	}
+	a.mu.Unlock()
+	ui.logger.Debug("bookmark of %s saved at %ds", item.Id, position)
+
+	ui.bookmarksPage.UpdateBookmarks()
+}
+
+// offerBookmark asks whether to resume item from its bookmark at position
+// milliseconds.
+func (ui *Ui) offerBookmark(item mpvplayer.QueueItem, position int64) {
+	text := fmt.Sprintf("Resume %s - %s from the bookmark at %s?", item.Artist, item.Title, formatPosition(position/1000))
+	ui.resumeBookmarkModal.SetText(text).
+		ClearButtons().
+		AddButtons([]string{"Resume", "Start over"}).
+		SetDoneFunc(func(_ int, label string) {
+			ui.pages.HidePage(PageResumeBookmark)
+			ui.app.SetFocus(ui.pages)
+			if label != "Resume" {
+				return
+			}
+			// the song may have been skipped meanwhile
+			if queue, current := ui.player.GetQueueCopy(); current >= len(queue) || queue[current].Id != item.Id {
+				return
+			}
+			if err := ui.player.SeekAbsolute(int(position / 1000)); err != nil {
+				ui.logger.Error("resuming from bookmark: %v", err)
+			}
+		})
+	ui.pages.ShowPage(PageResumeBookmark)
+	ui.pages.SendToFront(PageResumeBookmark)
+	ui.app.SetFocus(ui.resumeBookmarkModal)
+}
+
+// formatPosition formats seconds as [h:]mm:ss, audiobooks take hours.
+func formatPosition(seconds int64) string {
+	hours := seconds / 3600
+	if hours > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", hours, seconds/60%60, seconds%60)
+	}
+	return fmt.Sprintf("%02d:%02d", seconds/60, seconds%60)
+}
@@ -14,8 +14,14 @@ type eventLoop struct {
 	// scrobbles are handled by background loop
 	scrobbleNowPlaying      chan string
 	scrobbleSubmissionTimer *time.Timer
+
+	// debounces saving the queue on the server
+	playQueueSyncTimer *time.Timer
 }
 
+// how long the queue has to be left alone before it's saved on the server
+const playQueueSyncDelay = 5 * time.Second
+
 func (ui *Ui) initEventLoops() {
 	el := &eventLoop{
 		scrobbleNowPlaying: make(chan string, 5),
@@ -27,6 +33,11 @@ func (ui *Ui) initEventLoops() {
 	if !el.scrobbleSubmissionTimer.Stop() {
 		<-el.scrobbleSubmissionTimer.C
 	}
+
+	el.playQueueSyncTimer = time.NewTimer(0)
+	if !el.playQueueSyncTimer.Stop() {
+		<-el.playQueueSyncTimer.C
+	}
 }
 
 func (ui *Ui) runEventLoops() {
@@ -65,14 +76,20 @@ func (ui *Ui) guiEventLoop() {
 				volume := ui.player.State.Volume
 				position := ui.player.State.Position
 				duration := ui.player.State.Duration
+				codec, bitrate := ui.player.GetAudioFormat()
+				ui.updateBookmarkPosition(position)
 				ui.app.QueueUpdateDraw(func() {
 					ui.topbar.SetPlayerState(volume, position, duration)
+					ui.queuePage.updateLyrics(position)
+					ui.queuePage.setAudioFormat(codec, bitrate)
 				})
 
 			case mpvplayer.EventStopped:
 				ui.logger.Info("mpvEvent: stopped")
+				ui.bookmarkStopped()
 				ui.app.QueueUpdateDraw(func() {
 					ui.topbar.SetActivityStop()
+					ui.queuePage.setAudioFormat("", 0)
 					ui.queuePage.UpdateQueue()
 				})
 
@@ -92,7 +109,8 @@ func (ui *Ui) guiEventLoop() {
 							ui.mprisPlayer.OnSongChange(currentSong)
 						}
 
-						if ui.connection.Conf().Scrobble {
+						// radio stations aren't songs of the server
+						if ui.connection.Conf().Scrobble && !currentSong.Live {
 							// TODO: move outside of eventloop, scrobble shouldn't effect player performance and processing loop
 
 							// scrobble "now playing" event (delegate to background event loop)
@@ -116,26 +134,73 @@ func (ui *Ui) guiEventLoop() {
 								ui.logger.Debug("scrobbler: track too short")
 							}
 						}
+
+						ui.bookmarkSongStarted(currentSong)
+						ui.schedulePlayQueueSync()
+						go ui.queuePage.loadLyrics(currentSong)
 					}
+					streamTitle := ui.player.GetStreamTitle()
 					ui.app.QueueUpdateDraw(func() {
-						ui.topbar.SetActivityPlaying(currentSong.Artist, currentSong.Title)
+						if currentSong.Live {
+							ui.topbar.SetActivityStream(false, currentSong.Title, streamTitle)
+						} else {
+							ui.topbar.SetActivityPlaying(currentSong.Artist, currentSong.Title)
+						}
 						ui.queuePage.UpdateQueue()
 					})
 				}
 
 			case mpvplayer.EventPaused:
 				ui.logger.Info("mpvEvent: paused")
+				ui.schedulePlayQueueSync()
+				if item, ok := mpvEvent.Data.(mpvplayer.QueueItem); ok {
+					ui.bookmarkPaused(item)
+				}
 
 				currentSong, err := ui.player.GetPlayingTrack()
 				if err == nil {
 					// currentSong = mpvEvent.Data.(mpvplayer.QueueItem) // TODO is this safe to access? maybe we need a copy
 					// TODO: the data passed on the event should be the relevant details not the whole entity
 
+					streamTitle := ui.player.GetStreamTitle()
 					ui.app.QueueUpdateDraw(func() {
-						ui.topbar.SetActivityPause(currentSong.Artist, currentSong.Title)
+						if currentSong.Live {
+							ui.topbar.SetActivityStream(true, currentSong.Title, streamTitle)
+						} else {
+							ui.topbar.SetActivityPause(currentSong.Artist, currentSong.Title)
+						}
 					})
 				}
 
+			case mpvplayer.EventStreamTitle:
+				title := mpvEvent.Data.(string)
+				queue, current := ui.player.GetQueueCopy()
+				if current >= len(queue) || !queue[current].Live {
+					continue
+				}
+				station := queue[current].Title
+				ui.logger.Info("mpvEvent: stream title %q", title)
+
+				if ui.mprisPlayer != nil {
+					ui.mprisPlayer.OnStreamTitleChange(station, title)
+				}
+				paused, err := ui.player.IsPaused()
+				if err != nil {
+					ui.logger.Error("stream title: IsPaused", err)
+				}
+				ui.app.QueueUpdateDraw(func() {
+					ui.topbar.SetActivityStream(paused, station, title)
+				})
+
+			case mpvplayer.EventRepeatMode:
+				mode := mpvEvent.Data.(mpvplayer.RepeatMode)
+				if ui.mprisPlayer != nil {
+					ui.mprisPlayer.OnLoopStatusChange(ui.player.GetLoopStatus())
+				}
+				ui.app.QueueUpdateDraw(func() {
+					ui.topbar.SetRepeatMode(mode)
+				})
+
 			default:
 				ui.logger.Warn("guiEventLoop: unhandled mpvEvent %v", mpvEvent)
 			}
@@ -149,7 +214,7 @@ func (ui *Ui) backgroundEventLoop() {
 		select {
 		case songId := <-ui.eventLoop.scrobbleNowPlaying:
 			// scrobble now playing
-			if _, err := ui.connection.ScrobbleSubmission(songId, false); err != nil {
+			if _, err := ui.connection.ScrobbleSubmission(ui.ctx, songId, false); err != nil {
 				ui.logger.Error("scrobble nowplaying", err)
 			}
 
@@ -158,21 +223,36 @@ func (ui *Ui) backgroundEventLoop() {
 			if currentSong, err := ui.player.GetPlayingTrack(); err != nil {
 				// user paused/stopped
 				ui.logger.Debug("not scrobbling: %v", err)
+			} else if currentSong.Live {
+				// switched to a radio station meanwhile
+				ui.logger.Debug("not scrobbling live stream %s", currentSong.Id)
 			} else {
 				// it's still playing
 				ui.logger.Debug("scrobbling: %s", currentSong.Id)
-				if _, err := ui.connection.ScrobbleSubmission(currentSong.Id, true); err != nil {
+				if _, err := ui.connection.ScrobbleSubmission(ui.ctx, currentSong.Id, true); err != nil {
 					ui.logger.Error("scrobble submission", err)
 				}
 			}
+
+		case <-ui.eventLoop.playQueueSyncTimer.C:
+			ui.savePlayQueue(ui.ctx)
 		}
 	}
 }
 
+// schedulePlayQueueSync saves the queue on the server after a delay, restarting
+// the delay if it's already pending
+func (ui *Ui) schedulePlayQueueSync() {
+	if ui.connection.Conf().SyncPlayQueue {
+		ui.eventLoop.playQueueSyncTimer.Reset(playQueueSyncDelay)
+	}
+}
+
 func (ui *Ui) addStarredToList() {
-	response, err := ui.connection.GetStarred()
+	response, err := ui.connection.GetStarred(ui.ctx)
 	if err != nil {
-		ui.logger.Error("addStarredToList", err)
+		ui.logger.Error("addStarredToList: %v", err)
+		return
 	}
 
 	for _, e := range response.Starred.Song {
@@ -4,6 +4,10 @@
 package gui
 
 import (
+	"context"
+	"errors"
+	"time"
+
 	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
 	"github.com/spezifisch/stmps/mpvplayer"
@@ -38,27 +42,66 @@ type Ui struct {
 	// search page
 	searchPage *SearchPage
 
+	// albums page
+	albumsPage *AlbumsPage
+
+	// genres page
+	genresPage *GenresPage
+
+	// favorites page
+	favoritesPage *FavoritesPage
+
+	// radio page
+	radioPage *RadioPage
+
+	// podcasts page
+	podcastsPage *PodcastsPage
+
+	// bookmarks page
+	bookmarksPage *BookmarksPage
+
 	// log page
 	logPage *LogPage
 
 	// modals
 	addToPlaylistList    *tview.List
+	addToPlaylistModal   tview.Primitive
 	messageBox           *tview.Modal
+	resumeQueueModal     *tview.Modal
+	resumeBookmarkModal  *tview.Modal
 	helpModal            tview.Primitive
 	helpWidget           *HelpWidget
+	serverInfoModal      tview.Primitive
+	serverInfoWidget     *ServerInfoWidget
 	selectPlaylistModal  tview.Primitive
 	selectPlaylistWidget *PlaylistSelectionWidget
 
+	// what the add to playlist modal adds and where to go back to, see
+	// showAddToPlaylist
+	addToPlaylist      func(playlist *service.SubsonicPlaylist)
+	addToPlaylistFocus tview.Primitive
+
 	starIdList map[string]struct{}
+	// ratings set in this session, the server's responses may be cached
+	ratings map[string]int
+	// see bookmarkSongStarted
+	autoBookmarks autoBookmarks
+	// see syncOffline
+	offlineSync offlineSync
 
 	eventLoop   *eventLoop
 	mpvEvents   chan mpvplayer.UiEvent
 	mprisPlayer *remote.MprisPlayer
 
-	playlists  []service.SubsonicPlaylist
-	connection *service.SubsonicConnection
-	player     *mpvplayer.Player
-	logger     utils.Logger
+	// canceled on quit, requests are made with it
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	playlists   []service.SubsonicPlaylist
+	connection  service.Connector
+	player      *mpvplayer.Player
+	keyBindings *KeyBindings
+	logger      utils.Logger
 }
 
 const (
@@ -68,23 +111,41 @@ const (
 	PagePlaylists = "Playlists"
 	PageSearch    = "Search"
 	PageLog       = "Log"
-
-	PageDeletePlaylist = "deletePlaylist"
-	PageNewPlaylist    = "newPlaylist"
-	PageAddToPlaylist  = "addToPlaylist"
-	PageMessageBox     = "messageBox"
-	PageHelpBox        = "helpBox"
-	PageSelectPlaylist = "selectPlaylist"
+	PageAlbums    = "Albums"
+	PageGenres    = "Genres"
+	PageFavorites = "Favorites"
+	PageRadio     = "Radio"
+	PagePodcasts  = "Podcasts"
+	PageBookmarks = "Bookmarks"
+
+	PageDeletePlaylist     = "deletePlaylist"
+	PageNewPlaylist        = "newPlaylist"
+	PageAddToPlaylist      = "addToPlaylist"
+	PageMessageBox         = "messageBox"
+	PageResumeQueue        = "resumeQueue"
+	PageHelpBox            = "helpBox"
+	PageServerInfo         = "serverInfo"
+	PageSelectPlaylist     = "selectPlaylist"
+	PageRadioStation       = "radioStation"
+	PageDeleteRadioStation = "deleteRadioStation"
+	PageSubscribePodcast   = "subscribePodcast"
+	PageDeletePodcast      = "deletePodcast"
+	PageResumeBookmark     = "resumeBookmark"
 )
 
+// quitSaveTimeout limits how long saving the queue on the server delays quitting
+const quitSaveTimeout = 5 * time.Second
+
 func InitGui(indexes *[]service.SubsonicIndex,
-	connection *service.SubsonicConnection,
+	connection service.Connector,
 	player *mpvplayer.Player,
+	keyBindings *KeyBindings,
 	logger utils.Logger,
 	mprisPlayer *remote.MprisPlayer,
 ) (ui *Ui) {
 	ui = &Ui{
 		starIdList: map[string]struct{}{},
+		ratings:    map[string]int{},
 
 		eventLoop: nil, // initialized by initEventLoops()
 		mpvEvents: make(chan mpvplayer.UiEvent, 5),
@@ -92,10 +153,13 @@ func InitGui(indexes *[]service.SubsonicIndex,
 		playlists:   []service.SubsonicPlaylist{},
 		connection:  connection,
 		player:      player,
+		keyBindings: keyBindings,
 		logger:      logger,
 		mprisPlayer: mprisPlayer,
 	}
 
+	ui.ctx, ui.cancel = context.WithCancel(context.Background())
+
 	ui.initEventLoops()
 
 	ui.app = tview.NewApplication()
@@ -108,6 +172,25 @@ func InitGui(indexes *[]service.SubsonicIndex,
 	// same as 'playlistList' except for the addToPlaylistModal
 	// - we need a specific version of this because we need different keybinds
 	ui.addToPlaylistList = tview.NewList().ShowSecondaryText(false)
+	ui.addToPlaylistList.SetBorder(true).
+		SetTitle("Add to Playlist")
+	ui.addToPlaylistModal = makeModal(ui.addToPlaylistList, 60, 20)
+	ui.addToPlaylistList.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Key() {
+		case tcell.KeyEscape:
+			ui.closeAddToPlaylist()
+			return nil
+		case tcell.KeyEnter:
+			index := ui.addToPlaylistList.GetCurrentItem()
+			if index >= 0 && index < len(ui.playlists) {
+				playlist := ui.playlists[index]
+				ui.addToPlaylist(&playlist)
+			}
+			ui.closeAddToPlaylist()
+			return nil
+		}
+		return event
+	})
 
 	// message box for small notes
 	ui.messageBox = tview.NewModal().
@@ -118,6 +201,14 @@ func InitGui(indexes *[]service.SubsonicIndex,
 		return event
 	})
 
+	// asks whether to resume the server's play queue, see offerPlayQueue
+	ui.resumeQueueModal = tview.NewModal().
+		SetBackgroundColor(tcell.ColorBlack)
+
+	// asks whether to resume a song from its bookmark, see offerBookmark
+	ui.resumeBookmarkModal = tview.NewModal().
+		SetBackgroundColor(tcell.ColorBlack)
+
 	ui.selectPlaylistModal = makeModal(ui.selectPlaylistWidget.Root, 80, 5)
 
 	// help box modal
@@ -133,7 +224,18 @@ func InitGui(indexes *[]service.SubsonicIndex,
 		return event
 	})
 
+	// server info modal
+	ui.serverInfoWidget = ui.createServerInfoWidget()
+	ui.serverInfoModal = makeModal(ui.serverInfoWidget.Root, 80, 20)
+	ui.serverInfoWidget.Root.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if ui.serverInfoWidget.visible && event.Key() == tcell.KeyEscape {
+			ui.CloseServerInfo()
+		}
+		return event
+	})
+
 	ui.topbar = InitTopBar(logger)
+	ui.topbar.SetStreamProfile(connection.StreamProfile())
 
 	// browser page
 	ui.browserPage = ui.createBrowserPage(indexes)
@@ -147,6 +249,24 @@ func InitGui(indexes *[]service.SubsonicIndex,
 	// search page
 	ui.searchPage = ui.createSearchPage()
 
+	// albums page
+	ui.albumsPage = ui.createAlbumsPage()
+
+	// genres page
+	ui.genresPage = ui.createGenresPage()
+
+	// favorites page
+	ui.favoritesPage = ui.createFavoritesPage()
+
+	// radio page
+	ui.radioPage = ui.createRadioPage()
+
+	// podcasts page
+	ui.podcastsPage = ui.createPodcastsPage()
+
+	// bookmarks page
+	ui.bookmarksPage = ui.createBookmarksPage()
+
 	// log page
 	ui.logPage = ui.createLogPage()
 
@@ -154,12 +274,25 @@ func InitGui(indexes *[]service.SubsonicIndex,
 		AddPage(PageQueue, ui.queuePage.Root, true, false).
 		AddPage(PagePlaylists, ui.playlistPage.Root, true, false).
 		AddPage(PageSearch, ui.searchPage.Root, true, false).
+		AddPage(PageAlbums, ui.albumsPage.Root, true, false).
+		AddPage(PageGenres, ui.genresPage.Root, true, false).
+		AddPage(PageFavorites, ui.favoritesPage.Root, true, false).
+		AddPage(PageRadio, ui.radioPage.Root, true, false).
+		AddPage(PagePodcasts, ui.podcastsPage.Root, true, false).
+		AddPage(PageBookmarks, ui.bookmarksPage.Root, true, false).
 		AddPage(PageDeletePlaylist, ui.playlistPage.DeletePlaylistModal, true, false).
 		AddPage(PageNewPlaylist, ui.playlistPage.NewPlaylistModal, true, false).
-		AddPage(PageAddToPlaylist, ui.browserPage.AddToPlaylistModal, true, false).
+		AddPage(PageAddToPlaylist, ui.addToPlaylistModal, true, false).
 		AddPage(PageSelectPlaylist, ui.selectPlaylistModal, true, false).
 		AddPage(PageMessageBox, ui.messageBox, true, false).
+		AddPage(PageResumeQueue, ui.resumeQueueModal, true, false).
+		AddPage(PageResumeBookmark, ui.resumeBookmarkModal, true, false).
 		AddPage(PageHelpBox, ui.helpModal, true, false).
+		AddPage(PageServerInfo, ui.serverInfoModal, true, false).
+		AddPage(PageRadioStation, ui.radioPage.StationModal, true, false).
+		AddPage(PageDeleteRadioStation, ui.radioPage.DeleteModal, true, false).
+		AddPage(PageSubscribePodcast, ui.podcastsPage.SubscribeModal, true, false).
+		AddPage(PageDeletePodcast, ui.podcastsPage.DeleteModal, true, false).
 		AddPage(PageLog, ui.logPage.Root, true, false)
 
 	rootFlex := tview.NewFlex().
@@ -183,6 +316,7 @@ func InitGui(indexes *[]service.SubsonicIndex,
 func (ui *Ui) Run() error {
 	// receive events from mpv wrapper
 	ui.player.RegisterEventConsumer(ui)
+	ui.player.SetOffsetUri(ui.offsetUri)
 
 	// run gui/background event handler
 	ui.runEventLoops()
@@ -190,6 +324,25 @@ func (ui *Ui) Run() error {
 	// run mpv event handler
 	go ui.player.EventLoop()
 
+	if ui.connection.Conf().BookmarkThreshold > 0 {
+		// resuming is offered for the bookmarked songs
+		go func() {
+			if err := ui.bookmarksPage.fetch(); err != nil {
+				ui.logger.Warn("loading the bookmarks: %v", err)
+			}
+		}()
+	}
+	ui.restoreLocalState()
+	if len(ui.connection.OfflineMarks()) > 0 {
+		// playlists may have changed and downloads been interrupted
+		ui.syncOffline(false)
+	}
+	// the artists may come from the library cache
+	go ui.browserPage.revalidate()
+	if ui.connection.Conf().SyncPlayQueue {
+		go ui.offerPlayQueue()
+	}
+
 	// gui main loop (blocking)
 	return ui.app.Run()
 }
@@ -209,6 +362,20 @@ func (ui *Ui) CloseHelp() {
 	ui.pages.HidePage(PageHelpBox)
 }
 
+func (ui *Ui) ShowServerInfo() {
+	ui.serverInfoWidget.Render()
+
+	ui.pages.ShowPage(PageServerInfo)
+	ui.pages.SendToFront(PageServerInfo)
+	ui.app.SetFocus(ui.serverInfoModal)
+	ui.serverInfoWidget.visible = true
+}
+
+func (ui *Ui) CloseServerInfo() {
+	ui.serverInfoWidget.visible = false
+	ui.pages.HidePage(PageServerInfo)
+}
+
 func (ui *Ui) ShowSelectPlaylist() {
 	ui.pages.ShowPage(PageSelectPlaylist)
 	ui.pages.SendToFront(PageSelectPlaylist)
@@ -221,8 +388,60 @@ func (ui *Ui) CloseSelectPlaylist() {
 	ui.selectPlaylistWidget.visible = false
 }
 
+// showAddToPlaylist lets the user pick a playlist to call add with, then
+// focuses focus again.
+func (ui *Ui) showAddToPlaylist(focus tview.Primitive, add func(playlist *service.SubsonicPlaylist)) {
+	// only makes sense to add to a playlist if there are playlists
+	if ui.playlistPage.GetCount() == 0 {
+		ui.showMessageBox("No playlists available. Create one first.")
+		return
+	}
+
+	ui.addToPlaylist = add
+	ui.addToPlaylistFocus = focus
+	ui.pages.ShowPage(PageAddToPlaylist)
+	ui.pages.SendToFront(PageAddToPlaylist)
+	ui.app.SetFocus(ui.addToPlaylistList)
+}
+
+func (ui *Ui) closeAddToPlaylist() {
+	ui.pages.HidePage(PageAddToPlaylist)
+	ui.app.SetFocus(ui.addToPlaylistFocus)
+	ui.addToPlaylist = nil
+	ui.addToPlaylistFocus = nil
+}
+
 func (ui *Ui) showMessageBox(text string) {
 	ui.pages.ShowPage(PageMessageBox)
 	ui.messageBox.SetText(text)
 	ui.app.SetFocus(ui.messageBox)
 }
+
+// showError logs err and tells the user about it in the message box. It can
+// be called from any goroutine.
+func (ui *Ui) showError(action string, err error) {
+	ui.logger.Error("%s: %v", action, err)
+
+	text := action + " failed:\n" + errorText(err)
+	ui.app.QueueUpdateDraw(func() {
+		ui.showMessageBox(text)
+	})
+}
+
+// errorText describes err for the message box
+func errorText(err error) string {
+	var apiErr *service.APIError
+	if !errors.As(err, &apiErr) {
+		return err.Error()
+	}
+
+	switch {
+	case errors.Is(err, service.ErrAuthFailed):
+		return apiErr.Message + "\nCheck the credentials in the config file."
+	case errors.Is(err, service.ErrNotAuthorized):
+		return apiErr.Message + "\nThe user isn't allowed to do this."
+	case errors.Is(err, service.ErrClientTooOld):
+		return apiErr.Message + "\nThe server requires a newer API version."
+	}
+	return apiErr.Message
+}
@@ -4,7 +4,10 @@
 package gui
 
 import (
-	"log"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
 
 	"github.com/gdamore/tcell/v2"
 	"github.com/spezifisch/stmps/mpvplayer"
@@ -15,49 +18,79 @@ import (
 func (ui *Ui) handlePageInput(event *tcell.EventKey) *tcell.EventKey {
 	// we don't want any of these firing if we're trying to add a new playlist
 	focused := ui.app.GetFocus()
-	if ui.playlistPage.IsNewPlaylistInputFocused(focused) || ui.browserPage.IsSearchFocused(focused) || focused == ui.searchPage.searchField || ui.selectPlaylistWidget.visible {
+	if ui.playlistPage.IsNewPlaylistInputFocused(focused) || ui.browserPage.IsSearchFocused(focused) || focused == ui.searchPage.searchField || focused == ui.albumsPage.filterField || ui.selectPlaylistWidget.visible {
+		return event
+	}
+	frontPage, _ := ui.pages.GetFrontPage()
+	switch frontPage {
+	case PageResumeQueue, PageResumeBookmark, PageRadioStation, PageDeleteRadioStation, PageSubscribePodcast, PageDeletePodcast:
+		return event
+	}
+	// keys bound on the active page take precedence
+	if context, ok := pageContexts[frontPage]; ok && ui.keyBindings.Command(context, event) != "" {
 		return event
 	}
 
-	switch event.Rune() {
-	case '1':
+	switch ui.keyBindings.Command(ContextGlobal, event) {
+	case "showBrowser":
 		ui.ShowPage(PageBrowser)
 
-	case '2':
+	case "showQueue":
 		ui.ShowPage(PageQueue)
 
-	case '3':
+	case "showPlaylists":
 		ui.ShowPage(PagePlaylists)
 
-	case '4':
+	case "showSearch":
 		ui.ShowPage(PageSearch)
 
-	case '5':
+	case "showLog":
 		ui.ShowPage(PageLog)
 
-	case '?':
+	case "showAlbums":
+		ui.ShowPage(PageAlbums)
+
+	case "showGenres":
+		ui.ShowPage(PageGenres)
+
+	case "showFavorites":
+		ui.ShowPage(PageFavorites)
+
+	case "showRadio":
+		ui.ShowPage(PageRadio)
+
+	case "showPodcasts":
+		ui.ShowPage(PagePodcasts)
+
+	case "showBookmarks":
+		ui.ShowPage(PageBookmarks)
+
+	case "showHelp":
 		ui.ShowHelp()
 
-	case 'Q':
+	case "showServerInfo":
+		ui.ShowServerInfo()
+
+	case "quit":
 		ui.Quit()
 
-	case 'r':
+	case "addRandomSongs":
 		// add random songs to queue
 		ui.handleAddRandomSongs("", "random")
 
-	case 'D':
+	case "clearQueue":
 		// clear queue and stop playing
 		ui.player.ClearQueue()
 		ui.queuePage.UpdateQueue()
 
-	case 'p':
+	case "togglePause":
 		// toggle playing/pause
 		err := ui.player.Pause()
 		if err != nil {
 			ui.logger.Error("handlePageInput: Pause", err)
 		}
 
-	case 'P':
+	case "stop":
 		// stop playing without changes to queue
 		ui.logger.Info("key stop")
 		err := ui.player.Stop()
@@ -65,46 +98,57 @@ func (ui *Ui) handlePageInput(event *tcell.EventKey) *tcell.EventKey {
 			ui.logger.Error("handlePageInput: Stop", err)
 		}
 
-	case 'X':
-		// debug stuff
-		ui.logger.Info("test")
-		// ui.player.Test()
-		ui.showMessageBox("foo bar")
-
-	case '-':
+	case "volumeDown":
 		// volume-
 		if err := ui.player.AdjustVolume(-5); err != nil {
 			ui.logger.Error("handlePageInput: AdjustVolume-", err)
 		}
 
-	case '+', '=':
+	case "volumeUp":
 		// volume+
 		if err := ui.player.AdjustVolume(5); err != nil {
 			ui.logger.Error("handlePageInput: AdjustVolume+", err)
 		}
 
-	case '.':
-		// <<
+	case "seekForward":
+		// >>
 		if err := ui.player.Seek(10); err != nil {
 			ui.logger.Error("handlePageInput: Seek+", err)
 		}
 
-	case ',':
-		// >>
+	case "seekBackward":
+		// <<
 		if err := ui.player.Seek(-10); err != nil {
 			ui.logger.Error("handlePageInput: Seek-", err)
 		}
 
-	case '>':
+	case "nextTrack":
 		// skip to next track
 		if err := ui.player.PlayNextTrack(); err != nil {
 			ui.logger.Error("handlePageInput: Next", err)
 		}
 		ui.queuePage.UpdateQueue()
 
-	case 's':
-		if err := ui.connection.StartScan(); err != nil {
-			ui.logger.Error("startScan:", err)
+	case "previousTrack":
+		// restart track or go back to the previous one
+		if err := ui.player.PlayPreviousTrack(); err != nil {
+			ui.logger.Error("handlePageInput: Previous", err)
+		}
+		ui.queuePage.UpdateQueue()
+
+	case "cycleRepeat":
+		mode := ui.player.CycleRepeatMode()
+		ui.logger.Info("repeat mode: %s", mode)
+
+	case "cycleStreamProfile":
+		ui.cycleStreamProfile()
+
+	case "syncOffline":
+		ui.syncOffline(true)
+
+	case "startScan":
+		if err := ui.connection.StartScan(ui.ctx); err != nil {
+			ui.showError("Starting the library scan", err)
 		}
 
 	default:
@@ -119,26 +163,195 @@ func (ui *Ui) ShowPage(name string) {
 	ui.menuWidget.SetActivePage(name)
 	_, prim := ui.pages.GetFrontPage()
 	ui.app.SetFocus(prim)
+
+	switch name {
+	case PageAlbums:
+		ui.albumsPage.open()
+	case PageGenres:
+		ui.genresPage.open()
+	case PageFavorites:
+		ui.favoritesPage.open()
+	case PageRadio:
+		ui.radioPage.open()
+	case PagePodcasts:
+		ui.podcastsPage.open()
+	case PageBookmarks:
+		ui.bookmarksPage.open()
+	}
 }
 
 func (ui *Ui) Quit() {
-	if len(ui.queuePage.queueData.playerQueue) > 0 {
-		ids := make([]string, len(ui.queuePage.queueData.playerQueue))
-		for i, it := range ui.queuePage.queueData.playerQueue {
-			ids[i] = it.Id
+	ui.eventLoop.playQueueSyncTimer.Stop()
+
+	// don't hang on quit if the server is gone
+	ctx, cancel := context.WithTimeout(ui.ctx, quitSaveTimeout)
+	ui.savePlayQueue(ctx)
+	ui.saveCurrentBookmark(ctx)
+	cancel()
+
+	// abort requests still running in the background
+	ui.cancel()
+
+	ui.saveLocalState()
+	if err := ui.connection.SaveCache(); err != nil {
+		ui.logger.Error("Saving the library cache: %v", err)
+	}
+	ui.player.Quit()
+	ui.app.Stop()
+}
+
+// savePlayQueue stores the queue and position on the server, so they can be
+// resumed here or in other clients
+func (ui *Ui) savePlayQueue(ctx context.Context) {
+	queue, current := ui.player.GetQueueCopy()
+	position := int(ui.player.GetTimePos() * 1000)
+	if current >= len(queue) {
+		// played to the end, start over
+		current, position = 0, 0
+	}
+
+	// the server only queues songs, radio stations are left out and the song
+	// after a current one takes its place
+	ids := make([]string, 0, len(queue))
+	currentId := ""
+	for i, it := range queue {
+		if it.Live {
+			if i == current {
+				current, position = i+1, 0
+			}
+			continue
 		}
-		// stmps always only ever plays the first song in the queue
-		pos := ui.player.GetTimePos()
-		if err := ui.connection.SavePlayQueue(ids, ids[0], int(pos)); err != nil {
-			log.Printf("error stashing play queue: %s", err)
+		if i == current {
+			currentId = it.Id
 		}
-	} else {
+		ids = append(ids, it.Id)
+	}
+
+	if len(ids) == 0 {
 		// The only way to purge a saved play queue is to force an error by providing
 		// bad data. Therefore, we ignore errors.
-		_ = ui.connection.SavePlayQueue([]string{"XXX"}, "XXX", 0)
+		_ = ui.connection.SavePlayQueue(ctx, []string{"XXX"}, "XXX", 0)
+		return
+	}
+	if currentId == "" {
+		// no song after the current radio station
+		currentId, position = ids[0], 0
+	}
+	if err := ui.connection.SavePlayQueue(ctx, ids, currentId, position); err != nil {
+		ui.logger.Error("error stashing play queue", err)
+	}
+}
+
+// loadPlayQueue replaces the queue with the one saved on the server, paused
+// at the saved position
+func (ui *Ui) loadPlayQueue(playQueue service.PlayQueue) {
+	items := make(mpvplayer.PlayerQueue, 0, len(playQueue.Entries))
+	current := 0
+	for i, entity := range playQueue.Entries {
+		if entity.Id == playQueue.Current {
+			current = i
+		}
+		items = append(items, ui.newQueueItem(&entity))
+	}
+
+	position := int64(playQueue.Position / 1000)
+	if position > 0 && current < len(items) {
+		ui.autoBookmarks.skipOffer(items[current].Id)
+	}
+	if err := ui.player.LoadQueue(items, current, position, true); err != nil {
+		ui.logger.Error("unable to load play queue", err)
+	}
+	ui.app.QueueUpdateDraw(ui.queuePage.UpdateQueue)
+}
+
+// offerPlayQueue asks whether to resume the queue saved on the server, unless
+// it's the one we're already playing
+func (ui *Ui) offerPlayQueue() {
+	response, err := ui.connection.LoadPlayQueue(ui.ctx)
+	if err != nil {
+		ui.logger.Error("unable to load play queue from server", err)
+		return
+	}
+	playQueue := response.PlayQueue
+	if len(playQueue.Entries) == 0 {
+		return
+	}
+	if queue, current := ui.player.GetQueueCopy(); current < len(queue) && queue[current].Id == playQueue.Current {
+		return
+	}
+
+	text := fmt.Sprintf("Resume the play queue saved on the server?\n\n%d songs", len(playQueue.Entries))
+	for _, entity := range playQueue.Entries {
+		if entity.Id == playQueue.Current {
+			min, sec := utils.SecondsToMinAndSec(int64(playQueue.Position / 1000))
+			text += fmt.Sprintf(", at %s - %s [%02d:%02d]", entity.Artist, entity.GetSongTitle(), min, sec)
+			break
+		}
+	}
+
+	ui.app.QueueUpdateDraw(func() {
+		ui.resumeQueueModal.SetText(text).
+			ClearButtons().
+			AddButtons([]string{"Resume", "Keep"}).
+			SetDoneFunc(func(_ int, label string) {
+				ui.pages.HidePage(PageResumeQueue)
+				ui.app.SetFocus(ui.pages)
+				if label == "Resume" {
+					go ui.loadPlayQueue(playQueue)
+				}
+			})
+		ui.pages.ShowPage(PageResumeQueue)
+		ui.pages.SendToFront(PageResumeQueue)
+		ui.app.SetFocus(ui.resumeQueueModal)
+	})
+}
+
+// saveLocalState stores the queue, position and volume in the state file.
+// Without persist-queue only the podcast episode positions are stored.
+func (ui *Ui) saveLocalState() {
+	conf := ui.connection.Conf()
+	if conf.StateFile == "" {
+		return
+	}
+	state := ui.player.GetState()
+	if !conf.PersistQueue {
+		state = mpvplayer.SavedState{EpisodePositions: state.EpisodePositions}
+	}
+	if err := mpvplayer.SaveState(conf.StateFile, state); err != nil {
+		ui.logger.Error("saveLocalState", err)
 	}
-	ui.player.Quit()
-	ui.app.Stop()
+}
+
+// restoreLocalState loads the queue saved by saveLocalState, paused at the
+// saved position unless resume-playing is set
+func (ui *Ui) restoreLocalState() {
+	conf := ui.connection.Conf()
+	if conf.StateFile == "" {
+		return
+	}
+	state, err := mpvplayer.LoadState(conf.StateFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return
+	} else if err != nil {
+		ui.logger.Error("restoreLocalState", err)
+		return
+	}
+	if !conf.PersistQueue {
+		ui.player.SetEpisodePositions(state.EpisodePositions)
+		return
+	}
+
+	for i := range state.Queue {
+		state.Queue[i].Uri = ui.queueItemUri(state.Queue[i])
+	}
+	if state.Position > 0 && state.Current < len(state.Queue) {
+		// it's resumed from the saved position
+		ui.autoBookmarks.skipOffer(state.Queue[state.Current].Id)
+	}
+	if err := ui.player.RestoreState(state, !conf.ResumePlaying); err != nil {
+		ui.logger.Error("restoreLocalState", err)
+	}
+	ui.queuePage.UpdateQueue()
 }
 
 func (ui *Ui) handleAddRandomSongs(Id string, randomType string) {
@@ -147,9 +360,10 @@ func (ui *Ui) handleAddRandomSongs(Id string, randomType string) {
 }
 
 func (ui *Ui) addRandomSongsToQueue(Id string, randomType string) {
-	response, err := ui.connection.GetRandomSongs(Id, randomType)
+	response, err := ui.connection.GetRandomSongs(ui.ctx, Id, randomType)
 	if err != nil {
-		ui.logger.Error("addRandomSongsToQueue %s", err)
+		ui.showError("Adding "+randomType+" songs", err)
+		return
 	}
 	switch randomType {
 	case "random":
@@ -163,37 +377,145 @@ func (ui *Ui) addRandomSongsToQueue(Id string, randomType string) {
 	}
 }
 
+// rating returns the rating of id, the one set in this session if it was
+// changed since the server sent it.
+func (ui *Ui) rating(id string, fromServer int) int {
+	if rating, ok := ui.ratings[id]; ok {
+		return rating
+	}
+	return fromServer
+}
+
+// setRating rates id on the server, 0 clears the rating. The cached
+// directories and albums listing it are marked as outdated.
+func (ui *Ui) setRating(id string, rating int, cachedIn ...string) bool {
+	if err := ui.connection.SetRating(ui.ctx, id, rating); err != nil {
+		ui.showError("Rating", err)
+		return false
+	}
+	ui.ratings[id] = rating
+
+	ui.connection.RemoveCacheEntry(id)
+	for _, cacheId := range cachedIn {
+		if cacheId != "" {
+			ui.connection.RemoveCacheEntry(cacheId)
+		}
+	}
+	return true
+}
+
 // make sure to call ui.QueuePage.UpdateQueue() after this
 func (ui *Ui) addSongToQueue(entity *service.SubsonicEntity) {
-	uri := ui.connection.GetPlayUrl(entity)
+	queueItem := ui.newQueueItem(entity)
+	ui.player.AddToQueue(&queueItem)
+}
 
-	response, err := ui.connection.GetAlbum(entity.Parent)
-	album := ""
-	if err != nil {
-		ui.logger.Error("addSongToQueue", err)
-	} else {
-		switch {
-		case response.Album.Name != "":
-			album = response.Album.Name
-		case response.Album.Title != "":
-			album = response.Album.Title
-		case response.Album.Album != "":
-			album = response.Album.Album
+// queueItemUri returns the stream URL of item with the current stream
+// profile. Live streams keep their own URI.
+func (ui *Ui) queueItemUri(item mpvplayer.QueueItem) string {
+	if item.Live {
+		return item.Uri
+	}
+	return ui.connection.GetPlayUrl(&service.SubsonicEntity{Id: item.Id})
+}
+
+// offsetUri returns the stream of item starting position seconds into it, if
+// the server transcodes it and can start there. mpv seeks in other streams.
+func (ui *Ui) offsetUri(item mpvplayer.QueueItem, position int64) string {
+	if item.Live {
+		return ""
+	}
+	return ui.connection.GetPlayUrlAt(&service.SubsonicEntity{Id: item.Id}, position)
+}
+
+// cycleStreamProfile switches to the next configured stream profile. The
+// queued songs are streamed with it, the playing one keeps its stream.
+func (ui *Ui) cycleStreamProfile() {
+	profiles := ui.connection.Conf().StreamProfiles
+	if len(profiles) < 2 {
+		ui.showMessageBox("No stream profiles are configured, add a [streaming] section to the config.")
+		return
+	}
+	current := ui.connection.StreamProfile()
+	next := profiles[0]
+	for i, profile := range profiles {
+		if profile.Name == current.Name {
+			next = profiles[(i+1)%len(profiles)]
 		}
 	}
+	ui.connection.SetStreamProfile(next)
+	ui.player.UpdateUris(ui.queueItemUri)
+	ui.topbar.SetStreamProfile(next)
+	ui.logger.Info("stream profile: %s", formatStreamProfile(next))
+}
+
+func (ui *Ui) newQueueItem(entity *service.SubsonicEntity) mpvplayer.QueueItem {
+	return ui.newAlbumQueueItem(entity, ui.albumName(entity.Parent))
+}
+
+// newQueueItems returns the queue items of entities, getting the name of
+// each of their albums once.
+func (ui *Ui) newQueueItems(entities []service.SubsonicEntity) mpvplayer.PlayerQueue {
+	albums := make(map[string]string)
+	items := make(mpvplayer.PlayerQueue, 0, len(entities))
+	for i := range entities {
+		album, ok := albums[entities[i].Parent]
+		if !ok {
+			album = ui.albumName(entities[i].Parent)
+			albums[entities[i].Parent] = album
+		}
+		items = append(items, ui.newAlbumQueueItem(&entities[i], album))
+	}
+	return items
+}
+
+// albumName returns the name of the album with id, "" if it can't be loaded.
+func (ui *Ui) albumName(id string) string {
+	response, err := ui.connection.GetAlbum(ui.ctx, id)
+	if err != nil {
+		ui.logger.Error("albumName", err)
+		return ""
+	}
+	switch {
+	case response.Album.Name != "":
+		return response.Album.Name
+	case response.Album.Title != "":
+		return response.Album.Title
+	default:
+		return response.Album.Album
+	}
+}
+
+// newAlbumQueueItem returns the queue item of entity on the album named album.
+func (ui *Ui) newAlbumQueueItem(entity *service.SubsonicEntity, album string) mpvplayer.QueueItem {
+	uri := ui.connection.GetPlayUrl(entity)
+
+	albumId := entity.AlbumId
+	if albumId == "" {
+		albumId = entity.Parent
+	}
 
-	queueItem := &mpvplayer.QueueItem{
+	return mpvplayer.QueueItem{
 		Id:          entity.Id,
 		Uri:         uri,
 		Title:       entity.GetSongTitle(),
 		Artist:      entity.Artist,
 		Duration:    entity.Duration,
 		Album:       album,
+		AlbumId:     albumId,
 		TrackNumber: entity.Track,
 		CoverArtId:  entity.CoverArtId,
 		DiscNumber:  entity.DiscNumber,
+		Rating:      entity.UserRating,
+		ReplayGain: mpvplayer.ReplayGain{
+			TrackGain:    entity.ReplayGain.TrackGain,
+			AlbumGain:    entity.ReplayGain.AlbumGain,
+			TrackPeak:    entity.ReplayGain.TrackPeak,
+			AlbumPeak:    entity.ReplayGain.AlbumPeak,
+			BaseGain:     entity.ReplayGain.BaseGain,
+			FallbackGain: entity.ReplayGain.FallbackGain,
+		},
 	}
-	ui.player.AddToQueue(queueItem)
 }
 
 func makeSongHandler(entity *service.SubsonicEntity, ui *Ui, fallbackArtist string) func() {
@@ -208,7 +530,7 @@ func makeSongHandler(entity *service.SubsonicEntity, ui *Ui, fallbackArtist stri
 	coverArtId := entity.CoverArtId
 	disc := entity.DiscNumber
 
-	response, err := ui.connection.GetAlbum(entity.Parent)
+	response, err := ui.connection.GetAlbum(ui.ctx, entity.Parent)
 	album := ""
 	if err != nil {
 		ui.logger.Error("makeSongHandler", err)
@@ -4,8 +4,12 @@
 package gui
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/rivo/tview"
 	"github.com/spezifisch/stmps/service"
+	"github.com/spezifisch/stmps/utils"
 )
 
 func makeModal(p tview.Primitive, width, height int) tview.Primitive {
@@ -24,3 +28,46 @@ func formatSongForPlaylistEntry(entity service.SubsonicEntity) (text string) {
 	}
 	return
 }
+
+// ratingStars shows a rating of 1-5 as stars, "" if unrated
+func ratingStars(rating int) string {
+	if rating <= 0 {
+		return ""
+	}
+	return strings.Repeat(ratingIcon, min(rating, 5))
+}
+
+// formatRating shows a rating after a list entry
+func formatRating(rating int) string {
+	if rating <= 0 {
+		return ""
+	}
+	return " [yellow]" + ratingStars(rating) + "[white]"
+}
+
+// formatStreamProfile describes the transcoding of a stream profile
+func formatStreamProfile(profile utils.StreamProfile) string {
+	var settings []string
+	if profile.Format != "" {
+		settings = append(settings, profile.Format)
+	}
+	if profile.MaxBitRate > 0 {
+		settings = append(settings, fmt.Sprintf("max. %d kbit/s", profile.MaxBitRate))
+	}
+	if len(settings) == 0 {
+		return profile.Name
+	}
+	return profile.Name + " (" + strings.Join(settings, ", ") + ")"
+}
+
+// formatAudioFormat shows the codec and bitrate in bit/s mpv reports, "" if
+// they're unknown
+func formatAudioFormat(codec string, bitrate int64) string {
+	switch {
+	case codec == "":
+		return ""
+	case bitrate <= 0:
+		return codec
+	}
+	return fmt.Sprintf("%s, %d kbit/s", codec, bitrate/1000)
+}
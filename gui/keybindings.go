@@ -0,0 +1,519 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package gui
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	tviewcommand "github.com/spezifisch/tview-command"
+)
+
+// contexts commands can be bound in, named like the sections of the key
+// bindings file
+const (
+	ContextGlobal    = "Global"
+	ContextBrowser   = "Browser"
+	ContextQueue     = "Queue"
+	ContextPlaylists = "Playlists"
+	ContextSearch    = "Search"
+	ContextAlbums    = "Albums"
+	ContextGenres    = "Genres"
+	ContextFavorites = "Favorites"
+	ContextRadio     = "Radio"
+	ContextPodcasts  = "Podcasts"
+	ContextBookmarks = "Bookmarks"
+)
+
+// pageContexts maps pages to the context of their bindings
+var pageContexts = map[string]string{
+	PageBrowser:   ContextBrowser,
+	PageQueue:     ContextQueue,
+	PagePlaylists: ContextPlaylists,
+	PageSearch:    ContextSearch,
+	PageAlbums:    ContextAlbums,
+	PageGenres:    ContextGenres,
+	PageFavorites: ContextFavorites,
+	PageRadio:     ContextRadio,
+	PagePodcasts:  ContextPodcasts,
+	PageBookmarks: ContextBookmarks,
+}
+
+// command is an action keys can be bound to
+type command struct {
+	name string
+	help string
+}
+
+// commands lists the commands available in each context, in help order
+var commands = map[string][]command{
+	ContextGlobal: {
+		{"togglePause", "play/pause"},
+		{"stop", "stop"},
+		{"nextTrack", "next song"},
+		{"previousTrack", "previous song (restarts the song if it played >3s)"},
+		{"cycleRepeat", "cycle repeat mode (off/all/one/stop after current)"},
+		{"volumeDown", "volume down"},
+		{"volumeUp", "volume up"},
+		{"seekBackward", "seek -10 seconds"},
+		{"seekForward", "seek +10 seconds"},
+		{"cycleStreamProfile", "switch to the next stream profile (transcoding)"},
+		{"addRandomSongs", "add random songs to queue"},
+		{"clearQueue", "remove all songs from queue"},
+		{"startScan", "start server library scan"},
+		{"syncOffline", "download missing offline songs, update marked playlists"},
+		{"showBrowser", "browser page"},
+		{"showQueue", "queue page"},
+		{"showPlaylists", "playlists page"},
+		{"showSearch", "search page"},
+		{"showLog", "log page"},
+		{"showAlbums", "albums page"},
+		{"showGenres", "genres page"},
+		{"showFavorites", "favorites page"},
+		{"showRadio", "internet radio page"},
+		{"showPodcasts", "podcasts page"},
+		{"showBookmarks", "bookmarks page"},
+		{"showHelp", "this help"},
+		{"showServerInfo", "server info"},
+		{"quit", "quit"},
+	},
+	ContextBrowser: {
+		{"addToQueue", "add artist, album or song to queue"},
+		{"addToPlaylist", "add song to playlist"},
+		{"toggleStar", "toggle star on song/album"},
+		{"addSimilarSongs", "add similar songs to queue"},
+		{"refresh", "refresh the list"},
+		{"search", "search artists"},
+		{"searchNext", "continue search forward"},
+		{"searchPrev", "continue search backwards"},
+		{"toggleOffline", "make album/song available offline or remove it"},
+		{"rate1", "rate 1 star"},
+		{"rate2", "rate 2 stars"},
+		{"rate3", "rate 3 stars"},
+		{"rate4", "rate 4 stars"},
+		{"rate5", "rate 5 stars"},
+		{"clearRating", "clear rating"},
+	},
+	ContextQueue: {
+		{"playSelected", "play selected song"},
+		{"deleteSelected", "remove selected song from the queue"},
+		{"toggleStar", "toggle star on song"},
+		{"moveUp", "move selected song up in queue"},
+		{"moveDown", "move selected song down in queue"},
+		{"saveQueue", "save queue as a playlist"},
+		{"shuffleQueue", "shuffle the upcoming songs"},
+		{"loadServerQueue", "load last queue from server"},
+		{"rate1", "rate 1 star"},
+		{"rate2", "rate 2 stars"},
+		{"rate3", "rate 3 stars"},
+		{"rate4", "rate 4 stars"},
+		{"rate5", "rate 5 stars"},
+		{"clearRating", "clear rating"},
+	},
+	ContextPlaylists: {
+		{"addToQueue", "add playlist or song to queue"},
+		{"newPlaylist", "new playlist"},
+		{"deletePlaylist", "delete playlist"},
+		{"toggleOffline", "make playlist/song available offline or remove it"},
+	},
+	ContextSearch: {
+		{"addToQueue", "recursively add item to queue"},
+		{"focusSearch", "start search"},
+		{"rate1", "rate 1 star"},
+		{"rate2", "rate 2 stars"},
+		{"rate3", "rate 3 stars"},
+		{"rate4", "rate 4 stars"},
+		{"rate5", "rate 5 stars"},
+		{"clearRating", "clear rating"},
+	},
+	ContextAlbums: {
+		{"addToQueue", "add album to queue"},
+		{"addToPlaylist", "add album to playlist"},
+		{"toggleStar", "toggle star on album"},
+		{"refresh", "reload the list"},
+		{"toggleOffline", "make album available offline or remove it"},
+		{"sortByRating", "toggle sorting the loaded albums by rating"},
+		{"filterByRating", "cycle the minimum rating shown"},
+		{"rate1", "rate 1 star"},
+		{"rate2", "rate 2 stars"},
+		{"rate3", "rate 3 stars"},
+		{"rate4", "rate 4 stars"},
+		{"rate5", "rate 5 stars"},
+		{"clearRating", "clear rating"},
+	},
+	ContextGenres: {
+		{"addToQueue", "add genre or song to queue"},
+		{"shuffleGenre", "add genre shuffled to queue"},
+		{"refresh", "reload the genres"},
+	},
+	ContextFavorites: {
+		{"addToQueue", "add artist, album or song to queue"},
+		{"playAll", "play all starred songs"},
+		{"shuffleAll", "play all starred songs shuffled"},
+		{"unstar", "unstar artist, album or song"},
+		{"refresh", "reload the favorites"},
+	},
+	ContextRadio: {
+		{"playStation", "play station now"},
+		{"addToQueue", "add station to queue"},
+		{"newStation", "add a station"},
+		{"editStation", "edit station"},
+		{"deleteStation", "delete station"},
+		{"refresh", "reload the stations"},
+	},
+	ContextPodcasts: {
+		{"addToQueue", "add episode or downloaded episodes of channel to queue"},
+		{"downloadEpisode", "download episode on the server"},
+		{"deleteEpisode", "delete downloaded episode on the server"},
+		{"subscribe", "subscribe to a podcast by feed URL"},
+		{"unsubscribe", "unsubscribe from channel"},
+		{"refresh", "check the feeds for new episodes"},
+	},
+	ContextBookmarks: {
+		{"playBookmark", "play song from bookmark now"},
+		{"addToQueue", "add song to queue"},
+		{"deleteBookmark", "delete bookmark"},
+		{"refresh", "reload the bookmarks"},
+	},
+}
+
+// contextNotes are shown in the help below a context's bindings
+var contextNotes = map[string]string{
+	ContextBrowser: `ENTER on a song plays it (clears current queue)
+Left/Right switch between artists and songs
+ESC closes the search`,
+	ContextSearch: `Left/Right switch between the artist, album and
+ song columns, Enter in the search field searches,
+ Up/ESC leave it
+
+Note: unlike browser, columns navigate
+ search results, not selected items.`,
+	ContextAlbums: `Left/Right switch between list types and albums,
+ more albums are loaded while scrolling down.
+By year takes a year or a range like 1990-1999,
+ by genre a genre, Enter in the field loads them.`,
+	ContextGenres: `Left/Right switch between genres and songs,
+ more songs are loaded while scrolling down.
+Adding a genre adds all of its songs.`,
+	ContextFavorites: `Left/Right switch between the artist, album and
+ song columns. Playing replaces the queue, in the
+ song column starting with the selected song.`,
+	ContextRadio: `Playing a station inserts it after the current
+ song. Most servers only let admins add, edit
+ or delete stations.`,
+	ContextPodcasts: `Left/Right switch between channels and episodes.
+Episodes are downloaded by the server before they
+ can be played, they resume where they were left.`,
+	ContextBookmarks: `Songs longer than bookmark-threshold are bookmarked
+ when they are paused, skipped or stmps quits.
+Resuming is offered when a bookmarked song starts.`,
+}
+
+// defaultBindings are used for keys the user didn't bind
+var defaultBindings = map[string]map[string]string{
+	ContextGlobal: {
+		"p": "togglePause",
+		"P": "stop",
+		">": "nextTrack",
+		"<": "previousTrack",
+		"L": "cycleRepeat",
+		"-": "volumeDown",
+		"=": "volumeUp",
+		"+": "volumeUp",
+		",": "seekBackward",
+		".": "seekForward",
+		"T": "cycleStreamProfile",
+		"r": "addRandomSongs",
+		"D": "clearQueue",
+		"s": "startScan",
+		"O": "syncOffline",
+		"1": "showBrowser",
+		"2": "showQueue",
+		"3": "showPlaylists",
+		"4": "showSearch",
+		"5": "showLog",
+		"6": "showAlbums",
+		"7": "showGenres",
+		"8": "showFavorites",
+		"9": "showRadio",
+		"0": "showPodcasts",
+		"b": "showBookmarks",
+		"?": "showHelp",
+		"i": "showServerInfo",
+		"Q": "quit",
+	},
+	ContextBrowser: {
+		"a":     "addToQueue",
+		"A":     "addToPlaylist",
+		"y":     "toggleStar",
+		"S":     "addSimilarSongs",
+		"R":     "refresh",
+		"/":     "search",
+		"n":     "searchNext",
+		"N":     "searchPrev",
+		"o":     "toggleOffline",
+		"ALT-1": "rate1",
+		"ALT-2": "rate2",
+		"ALT-3": "rate3",
+		"ALT-4": "rate4",
+		"ALT-5": "rate5",
+		"ALT-0": "clearRating",
+	},
+	ContextQueue: {
+		"ENTER": "playSelected",
+		"d":     "deleteSelected",
+		"DEL":   "deleteSelected",
+		"y":     "toggleStar",
+		"k":     "moveUp",
+		"j":     "moveDown",
+		"s":     "saveQueue",
+		"S":     "shuffleQueue",
+		"l":     "loadServerQueue",
+		"ALT-1": "rate1",
+		"ALT-2": "rate2",
+		"ALT-3": "rate3",
+		"ALT-4": "rate4",
+		"ALT-5": "rate5",
+		"ALT-0": "clearRating",
+	},
+	ContextPlaylists: {
+		"a": "addToQueue",
+		"n": "newPlaylist",
+		"d": "deletePlaylist",
+		"o": "toggleOffline",
+	},
+	ContextSearch: {
+		"a":     "addToQueue",
+		"ENTER": "addToQueue",
+		"/":     "focusSearch",
+		"ALT-1": "rate1",
+		"ALT-2": "rate2",
+		"ALT-3": "rate3",
+		"ALT-4": "rate4",
+		"ALT-5": "rate5",
+		"ALT-0": "clearRating",
+	},
+	ContextAlbums: {
+		"a":     "addToQueue",
+		"ENTER": "addToQueue",
+		"A":     "addToPlaylist",
+		"y":     "toggleStar",
+		"R":     "refresh",
+		"o":     "toggleOffline",
+		"S":     "sortByRating",
+		"f":     "filterByRating",
+		"ALT-1": "rate1",
+		"ALT-2": "rate2",
+		"ALT-3": "rate3",
+		"ALT-4": "rate4",
+		"ALT-5": "rate5",
+		"ALT-0": "clearRating",
+	},
+	ContextGenres: {
+		"a":     "addToQueue",
+		"ENTER": "addToQueue",
+		"S":     "shuffleGenre",
+		"R":     "refresh",
+	},
+	ContextFavorites: {
+		"a":     "addToQueue",
+		"ENTER": "playAll",
+		"S":     "shuffleAll",
+		"y":     "unstar",
+		"R":     "refresh",
+	},
+	ContextRadio: {
+		"ENTER": "playStation",
+		"a":     "addToQueue",
+		"n":     "newStation",
+		"e":     "editStation",
+		"d":     "deleteStation",
+		"R":     "refresh",
+	},
+	ContextPodcasts: {
+		"a":     "addToQueue",
+		"ENTER": "addToQueue",
+		"d":     "downloadEpisode",
+		"x":     "deleteEpisode",
+		"n":     "subscribe",
+		"u":     "unsubscribe",
+		"R":     "refresh",
+	},
+	ContextBookmarks: {
+		"ENTER": "playBookmark",
+		"a":     "addToQueue",
+		"d":     "deleteBookmark",
+		"R":     "refresh",
+	},
+}
+
+// ratingOf returns the rating set by one of the rate commands, 0 for
+// clearRating.
+func ratingOf(name string) int {
+	rating, _ := strconv.Atoi(strings.TrimPrefix(name, "rate"))
+	return rating
+}
+
+// KeyBindings maps keys to command names per context.
+type KeyBindings struct {
+	// context -> key name -> command name
+	bindings map[string]map[string]string
+}
+
+// defaultContext holds bindings for every context that knows their command
+const defaultContext = "Default"
+
+// LoadKeyBindings loads the tview-command config at path on top of the
+// default bindings. Binding a key to "" removes its default binding. An empty
+// path gives the defaults.
+func LoadKeyBindings(path string) (*KeyBindings, error) {
+	k := &KeyBindings{bindings: map[string]map[string]string{}}
+	for context, bindings := range defaultBindings {
+		k.bindings[context] = map[string]string{}
+		for key, name := range bindings {
+			k.bindings[context][key] = name
+		}
+	}
+	if path == "" {
+		return k, nil
+	}
+
+	config, err := tviewcommand.LoadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// tview-command only merges Default into the contexts in the file, so it's
+	// applied to all of them here, skipping the commands a context lacks
+	inherited := (*config)[defaultContext].Bindings
+	for key, name := range inherited {
+		known := name == ""
+		for context := range commands {
+			if name == "" || hasCommand(context, name) {
+				k.bind(context, key, name)
+				known = true
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown command %q for key %q in context %s", name, normalizeKeyName(key), defaultContext)
+		}
+	}
+
+	for context, c := range *config {
+		if _, ok := commands[context]; !ok {
+			// presets and Default
+			continue
+		}
+		for key, name := range c.Bindings {
+			if inheritedName, ok := inherited[key]; ok && inheritedName == name {
+				continue
+			}
+			if name != "" && !hasCommand(context, name) {
+				return nil, fmt.Errorf("unknown command %q for key %q in context %s", name, normalizeKeyName(key), context)
+			}
+			k.bind(context, key, name)
+		}
+	}
+	return k, nil
+}
+
+// bind binds key to the command name in context, "" removes the binding
+func (k *KeyBindings) bind(context, key, name string) {
+	key = normalizeKeyName(key)
+	if name == "" {
+		delete(k.bindings[context], key)
+		return
+	}
+	k.bindings[context][key] = name
+}
+
+func hasCommand(context, name string) bool {
+	return slices.ContainsFunc(commands[context], func(c command) bool {
+		return c.name == name
+	})
+}
+
+// Command returns the name of the command bound to the key of event in
+// context, "" if there is none.
+func (k *KeyBindings) Command(context string, event *tcell.EventKey) string {
+	return k.bindings[context][keyName(event)]
+}
+
+// Keys returns the sorted keys bound to the command in context.
+func (k *KeyBindings) Keys(context, name string) []string {
+	keys := []string{}
+	for key, boundName := range k.bindings[context] {
+		if boundName == name {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// Help lists the bound commands of context, one per line.
+func (k *KeyBindings) Help(context string) string {
+	lines := []string{}
+	for _, c := range commands[context] {
+		keys := k.Keys(context, c.name)
+		if len(keys) == 0 {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%-6s %s", strings.Join(keys, "/"), c.help))
+	}
+	if note, ok := contextNotes[context]; ok {
+		lines = append(lines, "", note)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// keyName names the key of event like the keys in the bindings file: runes as
+// they are, other keys upper case like ENTER, ESC or CTRL-A.
+func keyName(event *tcell.EventKey) string {
+	var name string
+	if event.Key() == tcell.KeyRune {
+		name = string(event.Rune())
+		if name == " " {
+			name = "SPC"
+		}
+		if event.Modifiers()&tcell.ModAlt != 0 {
+			name = "ALT-" + name
+		}
+		return name
+	}
+
+	name, ok := tcell.KeyNames[event.Key()]
+	if !ok {
+		return ""
+	}
+	return normalizeKeyName(name)
+}
+
+var keyAliases = map[string]string{
+	"ESCAPE":     "ESC",
+	"DELETE":     "DEL",
+	"RETURN":     "ENTER",
+	"SPACE":      "SPC",
+	"BACKSPACE2": "BACKSPACE",
+}
+
+// normalizeKeyName upper cases key names longer than one character and
+// resolves aliases, so "enter" and "Enter" both match ENTER.
+func normalizeKeyName(name string) string {
+	if len([]rune(name)) == 1 {
+		return name
+	}
+	if prefix, r, ok := strings.Cut(name, "-"); ok && len([]rune(r)) == 1 && strings.EqualFold(prefix, "alt") {
+		// keep the case of the rune in ALT-x
+		return "ALT-" + r
+	}
+	name = strings.ToUpper(name)
+	if alias, ok := keyAliases[name]; ok {
+		return alias
+	}
+	return name
+}
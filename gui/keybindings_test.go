@@ -0,0 +1,141 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package gui
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeBindings(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "keybindings.toml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+func TestKeyName(t *testing.T) {
+	testCases := []struct {
+		event *tcell.EventKey
+		name  string
+	}{
+		{tcell.NewEventKey(tcell.KeyRune, 'a', tcell.ModNone), "a"},
+		{tcell.NewEventKey(tcell.KeyRune, 'A', tcell.ModShift), "A"},
+		{tcell.NewEventKey(tcell.KeyRune, ' ', tcell.ModNone), "SPC"},
+		{tcell.NewEventKey(tcell.KeyRune, 'x', tcell.ModAlt), "ALT-x"},
+		{tcell.NewEventKey(tcell.KeyEnter, 0, tcell.ModNone), "ENTER"},
+		{tcell.NewEventKey(tcell.KeyEscape, 0, tcell.ModNone), "ESC"},
+		{tcell.NewEventKey(tcell.KeyDelete, 0, tcell.ModNone), "DEL"},
+		{tcell.NewEventKey(tcell.KeyCtrlN, 0, tcell.ModCtrl), "CTRL-N"},
+		{tcell.NewEventKey(tcell.KeyF1, 0, tcell.ModNone), "F1"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.name, keyName(tc.event))
+		})
+	}
+
+	assert.Equal(t, "ENTER", normalizeKeyName("enter"))
+	assert.Equal(t, "ESC", normalizeKeyName("Escape"))
+	assert.Equal(t, "CTRL-N", normalizeKeyName("ctrl-n"))
+	assert.Equal(t, "ALT-X", normalizeKeyName("alt-X"))
+	assert.Equal(t, "q", normalizeKeyName("q"))
+}
+
+func TestDefaultBindingsAreKnownCommands(t *testing.T) {
+	for context, bindings := range defaultBindings {
+		for key, name := range bindings {
+			assert.True(t, hasCommand(context, name), "%s: %s = %s", context, key, name)
+		}
+	}
+}
+
+func TestDefaultToggleOfflineKey(t *testing.T) {
+	// the same key on every page items are made available offline on
+	for _, context := range []string{ContextBrowser, ContextPlaylists, ContextAlbums} {
+		assert.Equal(t, "toggleOffline", defaultBindings[context]["o"], context)
+	}
+}
+
+func TestLoadKeyBindings(t *testing.T) {
+	path := writeBindings(t, `
+[Global.bindings]
+SPC = "togglePause"
+p = ""
+s = ""
+ctrl-n = "nextTrack"
+
+[Queue.bindings]
+x = "deleteSelected"
+`)
+	k, err := LoadKeyBindings(path)
+	require.NoError(t, err)
+
+	space := tcell.NewEventKey(tcell.KeyRune, ' ', tcell.ModNone)
+	p := tcell.NewEventKey(tcell.KeyRune, 'p', tcell.ModNone)
+	ctrlN := tcell.NewEventKey(tcell.KeyCtrlN, 0, tcell.ModCtrl)
+	assert.Equal(t, "togglePause", k.Command(ContextGlobal, space))
+	assert.Equal(t, "", k.Command(ContextGlobal, p))
+	assert.Equal(t, "nextTrack", k.Command(ContextGlobal, ctrlN))
+	assert.Equal(t, []string{"SPC"}, k.Keys(ContextGlobal, "togglePause"))
+
+	// defaults of other keys stay
+	assert.Equal(t, []string{"DEL", "d", "x"}, k.Keys(ContextQueue, "deleteSelected"))
+	assert.Equal(t, []string{"k"}, k.Keys(ContextQueue, "moveUp"))
+
+	// unbound commands are left out of the help
+	assert.NotContains(t, k.Help(ContextGlobal), "library scan")
+	assert.Contains(t, k.Help(ContextGlobal), "SPC    play/pause")
+}
+
+func TestLoadKeyBindingsDefault(t *testing.T) {
+	path := writeBindings(t, `
+[Default.bindings]
+x = "deleteSelected"
+ctrl-r = "refresh"
+
+[Queue.bindings]
+x = "moveDown"
+`)
+	k, err := LoadKeyBindings(path)
+	require.NoError(t, err)
+
+	// applied to the contexts knowing the command, even those not in the file
+	assert.Equal(t, []string{"CTRL-R", "R"}, k.Keys(ContextAlbums, "refresh"))
+	assert.Equal(t, []string{"CTRL-R", "R"}, k.Keys(ContextPodcasts, "refresh"))
+	assert.Empty(t, k.Keys(ContextGlobal, "refresh"))
+	assert.Empty(t, k.Keys(ContextGlobal, "deleteSelected"))
+
+	// the context's own bindings win
+	assert.Equal(t, []string{"j", "x"}, k.Keys(ContextQueue, "moveDown"))
+
+	_, err = LoadKeyBindings(writeBindings(t, `
+[Default.bindings]
+x = "bogus"
+`))
+	assert.ErrorContains(t, err, `unknown command "bogus" for key "x" in context Default`)
+}
+
+func TestLoadKeyBindingsErrors(t *testing.T) {
+	_, err := LoadKeyBindings(writeBindings(t, `
+[Queue.bindings]
+x = "quit"
+`))
+	assert.ErrorContains(t, err, `unknown command "quit"`)
+
+	_, err = LoadKeyBindings(writeBindings(t, `[Global.bindings`))
+	assert.Error(t, err)
+
+	_, err = LoadKeyBindings(filepath.Join(t.TempDir(), "missing.toml"))
+	assert.Error(t, err)
+
+	k, err := LoadKeyBindings("")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"+", "="}, k.Keys(ContextGlobal, "volumeUp"))
+}
@@ -0,0 +1,104 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package gui
+
+import (
+	"sync"
+)
+
+// offlineIcon marks downloaded songs and what's marked available offline
+const offlineIcon = "↓"
+
+// offlineSync runs one sync of the offline songs at a time, requests made
+// meanwhile start another one afterwards.
+type offlineSync struct {
+	mu      sync.Mutex
+	running bool
+	again   bool
+}
+
+// toggleOffline marks the directory, album, playlist or song with ID id available
+// offline and downloads its songs, or removes the mark and deletes the songs
+// no other mark needs.
+func (ui *Ui) toggleOffline(kind, id, name string) {
+	go func() {
+		if ui.connection.IsMarkedOffline(kind, id) {
+			if err := ui.connection.UnmarkOffline(kind, id); err != nil {
+				ui.showError("Removing the offline songs", err)
+			}
+			ui.offlineChanged()
+			return
+		}
+
+		if err := ui.connection.MarkOffline(ui.ctx, kind, id, name); err != nil {
+			ui.showError("Making it available offline", err)
+			return
+		}
+		ui.offlineChanged()
+		ui.syncOffline(true)
+	}()
+}
+
+// syncOffline downloads the missing offline songs in the background. Errors
+// are shown if report is set, otherwise they are only logged, e.g. when
+// starting without connectivity.
+func (ui *Ui) syncOffline(report bool) {
+	s := &ui.offlineSync
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running {
+		s.again = true
+		return
+	}
+	s.running = true
+
+	go func() {
+		for {
+			err := ui.connection.SyncOffline(ui.ctx, func(done, total int) {
+				ui.logger.Info("offline songs: %d of %d downloaded", done, total)
+				ui.offlineChanged()
+			})
+			if err == nil {
+				ui.logger.Info("offline songs are up to date")
+			} else if ui.ctx.Err() == nil {
+				if report {
+					ui.showError("Downloading the offline songs", err)
+				} else {
+					ui.logger.Error("downloading the offline songs: %v", err)
+				}
+			}
+			ui.offlineChanged()
+
+			s.mu.Lock()
+			if !s.again || ui.ctx.Err() != nil {
+				s.running = false
+				s.mu.Unlock()
+				return
+			}
+			s.again = false
+			s.mu.Unlock()
+		}
+	}()
+}
+
+// offlineChanged switches the queued songs between their local files and
+// streams and updates the offline indicators. It can be called from any
+// goroutine.
+func (ui *Ui) offlineChanged() {
+	ui.player.UpdateUris(ui.queueItemUri)
+	ui.app.QueueUpdateDraw(func() {
+		ui.queuePage.UpdateQueue()
+		ui.browserPage.updateOffline()
+		ui.playlistPage.updateOffline()
+		ui.albumsPage.updateOffline()
+	})
+}
+
+// formatOffline shows the offline indicator after a list entry
+func formatOffline(offline bool) string {
+	if !offline {
+		return ""
+	}
+	return " [green]" + offlineIcon + "[white]"
+}
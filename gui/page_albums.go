@@ -0,0 +1,539 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package gui
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"github.com/spezifisch/stmps/service"
+	"github.com/spezifisch/stmps/utils"
+)
+
+// albumsPageSize is how many albums are fetched at once
+const albumsPageSize = 100
+
+// albumsMaxUnmatchedPages is how many pages are fetched in a row to fill the
+// list while none of their albums pass the rating filter
+const albumsMaxUnmatchedPages = 5
+
+// albumListTypes are the lists of the albums page in the order shown
+var albumListTypes = []struct {
+	name     string
+	listType string
+}{
+	{"Newest", service.AlbumListNewest},
+	{"Recently played", service.AlbumListRecent},
+	{"Most played", service.AlbumListFrequent},
+	{"Random", service.AlbumListRandom},
+	{"Highest rated", service.AlbumListHighest},
+	{"By name", service.AlbumListAlphabeticalByName},
+	{"By artist", service.AlbumListAlphabeticalByArtist},
+	{"Starred", service.AlbumListStarred},
+	{"By year", service.AlbumListByYear},
+	{"By genre", service.AlbumListByGenre},
+}
+
+type AlbumsPage struct {
+	Root *tview.Flex
+
+	listFlex *tview.Flex
+
+	typeList    *tview.List
+	albumList   *tview.List
+	filterField *tview.InputField
+
+	// all albums fetched, the offset of the next page
+	albums []service.Album
+	// indexes of the albums shown, filtered and sorted by rating
+	shown []int
+	// only albums rated at least minRating are shown
+	minRating int
+	// highest rated albums first, the server's order otherwise
+	sortByRating bool
+	// the list shown
+	query service.AlbumListQuery
+	// canceled when another list is shown, the albums are fetched with it
+	ctx    context.Context
+	cancel context.CancelFunc
+	// the first list is loaded when the page is opened
+	opened bool
+	// a page is being fetched
+	loading bool
+	// the server has no more albums for query
+	complete bool
+	// pages fetched in a row without an album passing the rating filter
+	unmatchedPages int
+
+	// external refs
+	ui     *Ui
+	logger utils.Logger
+}
+
+func (ui *Ui) createAlbumsPage() *AlbumsPage {
+	albumsPage := AlbumsPage{
+		ui:     ui,
+		logger: ui.logger,
+	}
+
+	// list types
+	albumsPage.typeList = tview.NewList().
+		ShowSecondaryText(false)
+	albumsPage.typeList.Box.
+		SetTitle(" list ").
+		SetTitleAlign(tview.AlignLeft).
+		SetBorder(true)
+	for _, listType := range albumListTypes {
+		albumsPage.typeList.AddItem(listType.name, "", 0, nil)
+	}
+
+	// album list
+	albumsPage.albumList = tview.NewList().
+		ShowSecondaryText(false).
+		SetSelectedFocusOnly(true)
+	albumsPage.albumList.Box.
+		SetTitle(" albums ").
+		SetTitleAlign(tview.AlignLeft).
+		SetBorder(true)
+
+	// year and genre of the byYear and byGenre lists
+	albumsPage.filterField = tview.NewInputField().
+		SetFieldBackgroundColor(tcell.ColorBlack)
+
+	albumsPage.listFlex = tview.NewFlex().SetDirection(tview.FlexColumn).
+		AddItem(albumsPage.typeList, 24, 0, true).
+		AddItem(albumsPage.albumList, 0, 1, false)
+
+	albumsPage.Root = tview.NewFlex().SetDirection(tview.FlexRow)
+	albumsPage.showFilterField("")
+
+	albumsPage.typeList.SetChangedFunc(func(index int, _ string, _ string, _ rune) {
+		albumsPage.selectType(index)
+	})
+	albumsPage.typeList.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Key() {
+		case tcell.KeyRight:
+			ui.app.SetFocus(albumsPage.albumList)
+			return nil
+		case tcell.KeyEnter:
+			if albumsPage.needsFilter() {
+				ui.app.SetFocus(albumsPage.filterField)
+			} else {
+				ui.app.SetFocus(albumsPage.albumList)
+			}
+			return nil
+		}
+
+		if ui.keyBindings.Command(ContextAlbums, event) == "refresh" {
+			albumsPage.reload()
+			return nil
+		}
+		return event
+	})
+
+	albumsPage.albumList.SetChangedFunc(func(index int, _ string, _ string, _ rune) {
+		// fetch the next page before reaching the end
+		if index >= len(albumsPage.shown)-albumsPageSize/4 {
+			albumsPage.loadMore()
+		}
+	})
+	albumsPage.albumList.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyLeft {
+			ui.app.SetFocus(albumsPage.typeList)
+			return nil
+		}
+
+		switch ui.keyBindings.Command(ContextAlbums, event) {
+		case "addToQueue":
+			albumsPage.handleAddAlbumToQueue()
+			return nil
+		case "addToPlaylist":
+			if album := albumsPage.selectedAlbum(); album != nil {
+				ui.showAddToPlaylist(albumsPage.albumList, func(playlist *service.SubsonicPlaylist) {
+					albumsPage.addAlbumToPlaylist(album, playlist)
+				})
+			}
+			return nil
+		case "toggleStar":
+			albumsPage.handleToggleAlbumStar()
+			return nil
+		case "refresh":
+			albumsPage.reload()
+			return nil
+		case "sortByRating":
+			albumsPage.sortByRating = !albumsPage.sortByRating
+			albumsPage.render()
+			return nil
+		case "toggleOffline":
+			if album := albumsPage.selectedAlbum(); album != nil {
+				ui.toggleOffline(service.OfflineAlbum, album.Id, album.Name)
+			}
+			return nil
+		case "filterByRating":
+			// cycle through no filter and at least 1-5 stars
+			albumsPage.minRating = (albumsPage.minRating + 1) % 6
+			albumsPage.unmatchedPages = 0
+			albumsPage.render()
+			return nil
+		case "rate1", "rate2", "rate3", "rate4", "rate5", "clearRating":
+			albumsPage.handleSetAlbumRating(ratingOf(ui.keyBindings.Command(ContextAlbums, event)))
+			return nil
+		}
+		return event
+	})
+
+	albumsPage.filterField.SetDoneFunc(func(key tcell.Key) {
+		switch key {
+		case tcell.KeyEnter:
+			if albumsPage.applyFilter() {
+				ui.app.SetFocus(albumsPage.albumList)
+			}
+		case tcell.KeyEscape, tcell.KeyUp:
+			ui.app.SetFocus(albumsPage.typeList)
+		}
+	})
+
+	return &albumsPage
+}
+
+// open loads the first list when the page is shown the first time.
+func (a *AlbumsPage) open() {
+	if !a.opened {
+		a.opened = true
+		a.selectType(a.typeList.GetCurrentItem())
+	}
+}
+
+// selectType shows the list of albumListTypes[index], byYear and byGenre
+// wait for the filter.
+func (a *AlbumsPage) selectType(index int) {
+	if index < 0 || index >= len(albumListTypes) {
+		return
+	}
+	listType := albumListTypes[index].listType
+
+	switch listType {
+	case service.AlbumListByYear:
+		a.showFilterField("year: ")
+	case service.AlbumListByGenre:
+		a.showFilterField("genre: ")
+	default:
+		a.showFilterField("")
+		a.showList(service.AlbumListQuery{Type: listType})
+		return
+	}
+
+	a.filterField.SetText("")
+	a.showList(service.AlbumListQuery{})
+}
+
+func (a *AlbumsPage) needsFilter() bool {
+	listType := albumListTypes[a.typeList.GetCurrentItem()].listType
+	return listType == service.AlbumListByYear || listType == service.AlbumListByGenre
+}
+
+// applyFilter shows the byYear or byGenre list of the filter field, false if
+// it isn't valid.
+func (a *AlbumsPage) applyFilter() bool {
+	text := strings.TrimSpace(a.filterField.GetText())
+	query := service.AlbumListQuery{Type: albumListTypes[a.typeList.GetCurrentItem()].listType}
+
+	switch query.Type {
+	case service.AlbumListByYear:
+		from, to, ok := parseYears(text)
+		if !ok {
+			a.ui.showMessageBox("Enter a year or a range of years like 1990-1999.")
+			return false
+		}
+		query.FromYear, query.ToYear = from, to
+	case service.AlbumListByGenre:
+		if text == "" {
+			return false
+		}
+		query.Genre = text
+	default:
+		return false
+	}
+
+	a.showList(query)
+	return true
+}
+
+// parseYears parses "1995" or "1990-1999", the range may be descending.
+func parseYears(text string) (from, to int, ok bool) {
+	fromText, toText, isRange := strings.Cut(text, "-")
+	from, err := strconv.Atoi(strings.TrimSpace(fromText))
+	if err != nil {
+		return 0, 0, false
+	}
+	if !isRange {
+		return from, from, true
+	}
+	to, err = strconv.Atoi(strings.TrimSpace(toText))
+	if err != nil {
+		return 0, 0, false
+	}
+	return from, to, true
+}
+
+func (a *AlbumsPage) showFilterField(label string) {
+	a.Root.Clear()
+	a.Root.AddItem(a.listFlex, 0, 1, true)
+
+	if label != "" {
+		a.filterField.SetLabel(label)
+		a.Root.AddItem(a.filterField, 1, 0, false)
+	}
+}
+
+// showList replaces the albums with the first page of query, nothing if it
+// has no type.
+func (a *AlbumsPage) showList(query service.AlbumListQuery) {
+	// pages of the previous list are stale now
+	if a.cancel != nil {
+		a.cancel()
+	}
+	a.ctx, a.cancel = context.WithCancel(a.ui.ctx)
+
+	a.query = query
+	a.albums = nil
+	a.shown = nil
+	a.loading = false
+	a.complete = query.Type == ""
+	a.unmatchedPages = 0
+	a.albumList.Clear()
+	a.updateTitle()
+
+	a.loadMore()
+}
+
+// reload shows the current list again, e.g. to get other random albums.
+func (a *AlbumsPage) reload() {
+	if a.query.Type != "" {
+		a.showList(a.query)
+	}
+}
+
+// loadMore fetches the next page of albums in the background.
+func (a *AlbumsPage) loadMore() {
+	if a.loading || a.complete {
+		return
+	}
+	a.loading = true
+
+	ctx := a.ctx
+	query := a.query
+	query.Size = albumsPageSize
+	query.Offset = len(a.albums)
+	go func() {
+		response, err := a.ui.connection.GetAlbumList(ctx, query)
+		if err != nil && ctx.Err() == nil {
+			a.ui.showError("Loading the albums", err)
+		}
+
+		a.ui.app.QueueUpdateDraw(func() {
+			if ctx.Err() != nil {
+				// another list is shown
+				return
+			}
+			if err != nil {
+				a.loading = false
+				return
+			}
+
+			albums := response.AlbumList.Album
+			if len(albums) < albumsPageSize {
+				a.complete = true
+			}
+			first := len(a.albums)
+			a.albums = append(a.albums, albums...)
+			a.unmatchedPages++
+			for i := first; i < len(a.albums); i++ {
+				if a.albumRating(i) >= a.minRating {
+					a.unmatchedPages = 0
+					break
+				}
+			}
+			a.loading = false
+			a.render()
+		})
+	}()
+}
+
+// render fills the list with the albums passing the rating filter, keeping
+// the selected album. More are fetched if too few are shown.
+func (a *AlbumsPage) render() {
+	var selectedId string
+	if album := a.selectedAlbum(); album != nil {
+		selectedId = album.Id
+	}
+	goBackTo := a.albumList.GetCurrentItem()
+
+	a.shown = a.shown[:0]
+	for i := range a.albums {
+		if a.albumRating(i) >= a.minRating {
+			a.shown = append(a.shown, i)
+		}
+	}
+	if a.sortByRating {
+		sort.SliceStable(a.shown, func(i, j int) bool {
+			return a.albumRating(a.shown[i]) > a.albumRating(a.shown[j])
+		})
+	}
+
+	a.albumList.Clear()
+	for i, index := range a.shown {
+		album := a.albums[index]
+		if album.Id == selectedId {
+			goBackTo = i
+		}
+		a.albumList.AddItem(a.albumText(&album), "", 0, nil)
+	}
+	if goBackTo < len(a.shown) {
+		a.albumList.SetCurrentItem(goBackTo)
+	}
+	a.updateTitle()
+
+	// a filter matching few albums mustn't page through the whole library
+	if len(a.shown) < albumsPageSize/4 && a.unmatchedPages < albumsMaxUnmatchedPages {
+		a.loadMore()
+	}
+}
+
+func (a *AlbumsPage) albumRating(index int) int {
+	return a.ui.rating(a.albums[index].Id, a.albums[index].UserRating)
+}
+
+func (a *AlbumsPage) albumText(album *service.Album) string {
+	offline := a.ui.connection.IsMarkedOffline(service.OfflineAlbum, album.Id)
+	return albumListTextFormat(*album, a.ui.starIdList, a.ui.rating(album.Id, album.UserRating), offline)
+}
+
+// updateOffline updates the offline indicators of the albums shown.
+func (a *AlbumsPage) updateOffline() {
+	for i, index := range a.shown {
+		if i >= a.albumList.GetItemCount() {
+			break
+		}
+		a.albumList.SetItemText(i, a.albumText(&a.albums[index]), "")
+	}
+}
+
+func (a *AlbumsPage) updateTitle() {
+	count := fmt.Sprint(len(a.shown))
+	if !a.complete {
+		count += "+"
+	}
+	var options string
+	if a.minRating > 0 {
+		options += fmt.Sprintf(", rated %d+", a.minRating)
+	}
+	if a.sortByRating {
+		options += ", by rating"
+	}
+	a.albumList.Box.SetTitle(fmt.Sprintf(" albums (%s%s) ", count, options))
+}
+
+func (a *AlbumsPage) selectedAlbum() *service.Album {
+	index := a.albumList.GetCurrentItem()
+	if index < 0 || index >= len(a.shown) {
+		return nil
+	}
+	return &a.albums[a.shown[index]]
+}
+
+func (a *AlbumsPage) handleAddAlbumToQueue() {
+	album := a.selectedAlbum()
+	if album == nil {
+		return
+	}
+
+	response, err := a.ui.connection.GetAlbum(a.ui.ctx, album.Id)
+	if err != nil {
+		a.ui.showError("Adding the album to the queue", err)
+		return
+	}
+	sort.Sort(response.Album.Song)
+	for _, e := range response.Album.Song {
+		a.ui.addSongToQueue(&e)
+	}
+	a.ui.queuePage.UpdateQueue()
+
+	if index := a.albumList.GetCurrentItem(); index+1 < a.albumList.GetItemCount() {
+		a.albumList.SetCurrentItem(index + 1)
+	}
+}
+
+func (a *AlbumsPage) addAlbumToPlaylist(album *service.Album, playlist *service.SubsonicPlaylist) {
+	response, err := a.ui.connection.GetAlbum(a.ui.ctx, album.Id)
+	if err != nil {
+		a.ui.showError("Adding the album to the playlist", err)
+		return
+	}
+	sort.Sort(response.Album.Song)
+	for _, e := range response.Album.Song {
+		if err := a.ui.connection.AddSongToPlaylist(a.ui.ctx, string(playlist.Id), e.Id); err != nil {
+			a.ui.showError("Adding the album to the playlist", err)
+			break
+		}
+	}
+
+	a.ui.playlistPage.UpdatePlaylists()
+}
+
+func (a *AlbumsPage) handleToggleAlbumStar() {
+	album := a.selectedAlbum()
+	if album == nil {
+		return
+	}
+
+	_, remove := a.ui.starIdList[album.Id]
+	if _, err := a.ui.connection.ToggleStar(a.ui.ctx, service.StarAlbum, album.Id, a.ui.starIdList); err != nil {
+		a.ui.showError("Toggling the star", err)
+		return
+	}
+
+	if remove {
+		delete(a.ui.starIdList, album.Id)
+	} else {
+		a.ui.starIdList[album.Id] = struct{}{}
+	}
+
+	index := a.albumList.GetCurrentItem()
+	a.albumList.SetItemText(index, a.albumText(album), "")
+	a.ui.browserPage.UpdateStars()
+	a.ui.favoritesPage.UpdateStars()
+}
+
+func (a *AlbumsPage) handleSetAlbumRating(rating int) {
+	album := a.selectedAlbum()
+	if album == nil {
+		return
+	}
+
+	if a.ui.setRating(album.Id, rating, album.ArtistId) {
+		// the album may be filtered out or move now
+		a.render()
+	}
+}
+
+func albumListTextFormat(album service.Album, starredItems map[string]struct{}, rating int, offline bool) string {
+	text := tview.Escape(album.Name)
+	if album.Artist != "" {
+		text += " [gray]by [white]" + tview.Escape(album.Artist)
+	}
+	if album.Year != 0 {
+		text += fmt.Sprintf(" [gray](%d)[white]", album.Year)
+	}
+	text += formatRating(rating)
+	if _, hasStar := starredItems[album.Id]; hasStar {
+		text += " [red]♥"
+	}
+	return text + formatOffline(offline)
+}
@@ -0,0 +1,207 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package gui
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"github.com/spezifisch/stmps/service"
+	"github.com/spezifisch/stmps/utils"
+)
+
+// BookmarksPage lists the user's bookmarks.
+type BookmarksPage struct {
+	Root *tview.Flex
+
+	bookmarkList *tview.List
+
+	bookmarks []service.Bookmark
+	// the bookmarks are loaded when the page is opened
+	opened bool
+
+	// external refs
+	ui     *Ui
+	logger utils.Logger
+}
+
+func (ui *Ui) createBookmarksPage() *BookmarksPage {
+	bookmarksPage := BookmarksPage{
+		ui:     ui,
+		logger: ui.logger,
+	}
+
+	bookmarksPage.bookmarkList = tview.NewList().
+		ShowSecondaryText(false)
+	bookmarksPage.bookmarkList.Box.
+		SetTitle(" bookmarks ").
+		SetTitleAlign(tview.AlignLeft).
+		SetBorder(true)
+
+	bookmarksPage.Root = tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(bookmarksPage.bookmarkList, 0, 1, true)
+
+	bookmarksPage.bookmarkList.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch ui.keyBindings.Command(ContextBookmarks, event) {
+		case "playBookmark":
+			bookmarksPage.handlePlayBookmark()
+			return nil
+		case "addToQueue":
+			bookmarksPage.handleAddToQueue()
+			return nil
+		case "deleteBookmark":
+			bookmarksPage.handleDeleteBookmark()
+			return nil
+		case "refresh":
+			bookmarksPage.load()
+			return nil
+		}
+		return event
+	})
+
+	return &bookmarksPage
+}
+
+// open loads the bookmarks when the page is shown the first time.
+func (b *BookmarksPage) open() {
+	if !b.opened {
+		b.opened = true
+		b.load()
+	}
+}
+
+// UpdateBookmarks reloads the bookmarks after one was saved automatically.
+// It can be called from any goroutine.
+func (b *BookmarksPage) UpdateBookmarks() {
+	b.ui.app.QueueUpdate(func() {
+		if b.opened {
+			b.load()
+		}
+	})
+}
+
+// load fetches the bookmarks in the background.
+func (b *BookmarksPage) load() {
+	go func() {
+		if err := b.fetch(); err != nil && b.ui.ctx.Err() == nil {
+			b.ui.showError("Loading the bookmarks", err)
+		}
+	}()
+}
+
+// fetch loads the bookmarks, they are also the ones resuming is offered for.
+func (b *BookmarksPage) fetch() error {
+	response, err := b.ui.connection.GetBookmarks(b.ui.ctx)
+	if err != nil {
+		return err
+	}
+	bookmarks := response.Bookmarks.Bookmarks
+	b.ui.autoBookmarks.setPositions(bookmarks)
+
+	b.ui.app.QueueUpdateDraw(func() {
+		b.setBookmarks(bookmarks)
+	})
+	return nil
+}
+
+func (b *BookmarksPage) setBookmarks(bookmarks []service.Bookmark) {
+	b.bookmarks = bookmarks
+
+	current := b.bookmarkList.GetCurrentItem()
+	b.bookmarkList.Clear()
+	for _, bookmark := range bookmarks {
+		b.bookmarkList.AddItem(bookmarkTextFormat(bookmark), "", 0, nil)
+	}
+	if current < len(bookmarks) {
+		b.bookmarkList.SetCurrentItem(current)
+	}
+	b.bookmarkList.Box.SetTitle(fmt.Sprintf(" bookmarks (%d) ", len(bookmarks)))
+}
+
+func (b *BookmarksPage) selectedBookmark() *service.Bookmark {
+	index := b.bookmarkList.GetCurrentItem()
+	if index < 0 || index >= len(b.bookmarks) {
+		return nil
+	}
+	return &b.bookmarks[index]
+}
+
+// handlePlayBookmark plays the selected song from its bookmark right away.
+// It's inserted after the current song, the rest of the queue is kept.
+func (b *BookmarksPage) handlePlayBookmark() {
+	bookmark := b.selectedBookmark()
+	if bookmark == nil {
+		return
+	}
+	entry, position := bookmark.Entry, bookmark.Position/1000
+
+	go func() {
+		item := b.ui.newQueueItem(&entry)
+		// it's already resumed
+		b.ui.autoBookmarks.skipOffer(item.Id)
+
+		queue, current := b.ui.player.GetQueueCopy()
+		index := min(current+1, len(queue))
+		if err := b.ui.player.InsertIntoQueue(index, item); err != nil {
+			b.logger.Error("handlePlayBookmark: %v", err)
+			return
+		}
+		if err := b.ui.player.PlayQueueIndexAt(index, position); err != nil {
+			b.logger.Error("handlePlayBookmark: %v", err)
+			return
+		}
+		if err := b.ui.player.Play(); err != nil {
+			b.logger.Error("handlePlayBookmark: Play: %v", err)
+		}
+		b.ui.app.QueueUpdateDraw(b.ui.queuePage.UpdateQueue)
+	}()
+}
+
+// handleAddToQueue adds the selected song, resuming from the bookmark is
+// offered when it starts.
+func (b *BookmarksPage) handleAddToQueue() {
+	bookmark := b.selectedBookmark()
+	if bookmark == nil {
+		return
+	}
+	b.ui.addSongToQueue(&bookmark.Entry)
+	b.ui.queuePage.UpdateQueue()
+
+	index := b.bookmarkList.GetCurrentItem()
+	if index+1 < b.bookmarkList.GetItemCount() {
+		b.bookmarkList.SetCurrentItem(index + 1)
+	}
+}
+
+func (b *BookmarksPage) handleDeleteBookmark() {
+	bookmark := b.selectedBookmark()
+	if bookmark == nil {
+		return
+	}
+	id := bookmark.Entry.Id
+
+	go func() {
+		err := b.ui.connection.DeleteBookmark(b.ui.ctx, id)
+		if err != nil && !errors.Is(err, service.ErrNotFound) {
+			b.ui.showError("Deleting the bookmark", err)
+			return
+		}
+		b.load()
+	}()
+}
+
+func bookmarkTextFormat(bookmark service.Bookmark) string {
+	text := formatSongForPlaylistEntry(bookmark.Entry) +
+		" [gray](at " + formatPosition(bookmark.Position/1000)
+	if bookmark.Entry.Duration > 0 {
+		text += " of " + formatPosition(int64(bookmark.Entry.Duration))
+	}
+	text += ")"
+	if bookmark.Comment != "" {
+		text += " " + tview.Escape(bookmark.Comment)
+	}
+	return text
+}
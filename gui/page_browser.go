@@ -4,6 +4,7 @@
 package gui
 
 import (
+	"slices"
 	"sort"
 
 	"github.com/gdamore/tcell/v2"
@@ -13,8 +14,7 @@ import (
 )
 
 type BrowserPage struct {
-	Root               *tview.Flex
-	AddToPlaylistModal tview.Primitive
+	Root *tview.Flex
 
 	artistFlex *tview.Flex
 
@@ -47,17 +47,7 @@ func (ui *Ui) createBrowserPage(indexes *[]service.SubsonicIndex) *BrowserPage {
 		SetTitleAlign(tview.AlignLeft).
 		SetBorder(true)
 
-	for _, index := range *indexes {
-		for _, artist := range index.Artists {
-			artistName, err := utils.Normalize(artist.Name)
-			if err != nil {
-				ui.logger.Warn("BrowserPage: Failed to normalize artist name %s", artist.Name)
-			}
-			artistName = tview.Escape(artistName)
-			browserPage.artistList.AddItem(tview.Escape(artistName), "", 0, nil)
-			browserPage.artistIdList = append(browserPage.artistIdList, artist.Id)
-		}
-	}
+	browserPage.setArtists(*indexes)
 
 	// album list
 	browserPage.entityList = tview.NewList().
@@ -102,65 +92,34 @@ func (ui *Ui) createBrowserPage(indexes *[]service.SubsonicIndex) *BrowserPage {
 			return nil
 		}
 
-		switch event.Rune() {
-		case 'a':
+		switch ui.keyBindings.Command(ContextBrowser, event) {
+		case "addToQueue":
 			browserPage.handleAddArtistToQueue()
 			return nil
-		case '/':
+		case "search":
 			browserPage.showSearchField(true)
 			browserPage.search()
 			return nil
-		case 'n':
+		case "searchNext":
 			browserPage.showSearchField(true)
 			browserPage.searchNext()
 			return nil
-		case 'N':
+		case "searchPrev":
 			browserPage.showSearchField(true)
 			browserPage.searchPrev()
 			return nil
-		case 'S':
+		case "addSimilarSongs":
 			browserPage.handleAddRandomSongs("similar")
-		case 'R':
-			goBackTo := browserPage.artistList.GetCurrentItem()
-			// REFRESH artists
-			indexResponse, err := ui.connection.GetIndexes()
-			if err != nil {
-				ui.logger.Error("Error fetching indexes from server: %s", err)
-				return event
-			}
-
-			browserPage.artistList.Clear()
-			browserPage.artistIdList = []string{}
+		case "refresh":
+			// REFRESH artists, albums are fetched again when opened
 			ui.connection.ClearCache()
-
-			// Sort the indexes before adding to the list
-			for _, index := range indexResponse.Indexes {
-				sort.Slice(index.Artists, func(i, j int) bool {
-					artistI, err := utils.Normalize(index.Artists[i].Name)
-					if err != nil {
-						ui.logger.Warn("BrowserPage: Failed to normalize artist name %s", index.Artists[i].Name)
-					}
-					artistJ, err := utils.Normalize(index.Artists[j].Name)
-					if err != nil {
-						ui.logger.Warn("BrowserPage: Failed to normalize artist name %s", index.Artists[j].Name)
-					}
-
-					return artistI < artistJ
-				})
-				for _, artist := range index.Artists {
-					artistName, err := utils.Normalize(artist.Name)
-					if err != nil {
-						ui.logger.Warn("BrowserPage: Failed to normalize artist name %s", artist.Name)
-					}
-					browserPage.artistList.AddItem(tview.Escape(artistName), "", 0, nil)
-					browserPage.artistIdList = append(browserPage.artistIdList, artist.Id)
-				}
-			}
-
-			// Try to put the user to about where they were
-			if goBackTo < browserPage.artistList.GetItemCount() {
-				browserPage.artistList.SetCurrentItem(goBackTo)
+			indexResponse, _, err := ui.connection.RevalidateIndexes(ui.ctx)
+			if err != nil {
+				ui.showError("Refreshing the artists", err)
+				return nil
 			}
+			browserPage.setArtists(indexResponse.Indexes.Index)
+			browserPage.openSelectedArtist()
 			return nil
 		}
 		return event
@@ -172,84 +131,120 @@ func (ui *Ui) createBrowserPage(indexes *[]service.SubsonicIndex) *BrowserPage {
 		}
 	})
 
-	// "add to playlist" modal
-	for _, playlist := range ui.playlists {
-		ui.addToPlaylistList.AddItem(tview.Escape(playlist.Name), "", 0, nil)
-	}
-	ui.addToPlaylistList.SetBorder(true).
-		SetTitle("Add to Playlist")
-
-	addToPlaylistFlex := tview.NewFlex().
-		SetDirection(tview.FlexRow).
-		AddItem(ui.addToPlaylistList, 0, 1, true)
-
-	browserPage.AddToPlaylistModal = makeModal(addToPlaylistFlex, 60, 20)
-
-	ui.addToPlaylistList.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
-		if event.Key() == tcell.KeyEscape {
-			ui.pages.HidePage(PageAddToPlaylist)
-			ui.pages.SwitchToPage(PageBrowser)
-			ui.app.SetFocus(browserPage.entityList)
-			return nil
-		} else if event.Key() == tcell.KeyEnter {
-			playlist := ui.playlists[ui.addToPlaylistList.GetCurrentItem()]
-			browserPage.handleAddSongToPlaylist(&playlist)
-
-			ui.pages.HidePage(PageAddToPlaylist)
-			ui.pages.SwitchToPage(PageBrowser)
-			ui.app.SetFocus(browserPage.entityList)
-			return nil
-		}
-
-		return event
-	})
-
 	browserPage.entityList.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
 		if event.Key() == tcell.KeyLeft {
 			ui.app.SetFocus(browserPage.artistList)
 			return nil
 		}
-		if event.Rune() == 'a' {
+		switch ui.keyBindings.Command(ContextBrowser, event) {
+		case "addToQueue":
 			browserPage.handleAddEntityToQueue()
 			return nil
-		}
-		if event.Rune() == 'y' {
+		case "toggleStar":
 			browserPage.handleToggleEntityStar()
 			return nil
-		}
-		if event.Rune() == 'A' {
-			// only makes sense to add to a playlist if there are playlists
-			if ui.playlistPage.GetCount() > 0 {
-				ui.pages.ShowPage(PageAddToPlaylist)
-				ui.app.SetFocus(ui.addToPlaylistList)
-			} else {
-				ui.showMessageBox("No playlists available. Create one first.")
-			}
+		case "addToPlaylist":
+			ui.showAddToPlaylist(browserPage.entityList, browserPage.handleAddSongToPlaylist)
 			return nil
-		}
-		// REFRESH only the artist
-		if event.Rune() == 'R' {
+		case "refresh":
+			// REFRESH only the artist
 			artistIdx := browserPage.artistList.GetCurrentItem()
 			entity := browserPage.artistIdList[artistIdx]
-			// ui.logger.Printf("refreshing artist idx %d, entity %s (%s)", artistIdx, entity, ui.connection.directoryCache[entity].Directory.Name)
 			ui.connection.RemoveCacheEntry(entity)
 			browserPage.handleEntitySelected(browserPage.artistIdList[artistIdx])
 			return nil
-		}
-		if event.Rune() == 'S' {
+		case "addSimilarSongs":
 			browserPage.handleAddRandomSongs("similar")
+		case "rate1", "rate2", "rate3", "rate4", "rate5", "clearRating":
+			browserPage.handleSetEntityRating(ratingOf(ui.keyBindings.Command(ContextBrowser, event)))
+			return nil
+		case "toggleOffline":
+			browserPage.handleToggleEntityOffline()
+			return nil
 		}
 		return event
 	})
 
 	// open first artist by default so we don't get stuck when there's only one artist
-	if len(browserPage.artistIdList) > 0 {
-		browserPage.handleEntitySelected(browserPage.artistIdList[0])
-	}
+	browserPage.openSelectedArtist()
 
 	return &browserPage
 }
 
+// setArtists fills the artist list from indexes, keeping the selected artist
+// if it's still there.
+func (b *BrowserPage) setArtists(indexes []service.SubsonicIndex) {
+	goBackTo := b.artistList.GetCurrentItem()
+	var selectedId string
+	if goBackTo < len(b.artistIdList) {
+		selectedId = b.artistIdList[goBackTo]
+	}
+
+	b.artistList.Clear()
+	b.artistIdList = []string{}
+
+	// Sort the indexes before adding to the list. They're shared with the
+	// library cache, so a copy is sorted.
+	for _, index := range indexes {
+		artists := slices.Clone(index.Artists)
+		sort.Slice(artists, func(i, j int) bool {
+			artistI, err := utils.Normalize(artists[i].Name)
+			if err != nil {
+				b.logger.Warn("BrowserPage: Failed to normalize artist name %s", artists[i].Name)
+			}
+			artistJ, err := utils.Normalize(artists[j].Name)
+			if err != nil {
+				b.logger.Warn("BrowserPage: Failed to normalize artist name %s", artists[j].Name)
+			}
+
+			return artistI < artistJ
+		})
+		for _, artist := range artists {
+			artistName, err := utils.Normalize(artist.Name)
+			if err != nil {
+				b.logger.Warn("BrowserPage: Failed to normalize artist name %s", artist.Name)
+			}
+			if artist.Id == selectedId {
+				goBackTo = len(b.artistIdList)
+			}
+			b.artistList.AddItem(tview.Escape(artistName), "", 0, nil)
+			b.artistIdList = append(b.artistIdList, artist.Id)
+		}
+	}
+
+	// Try to put the user to about where they were
+	if goBackTo < b.artistList.GetItemCount() {
+		b.artistList.SetCurrentItem(goBackTo)
+	}
+}
+
+// openSelectedArtist shows the albums of the selected artist.
+func (b *BrowserPage) openSelectedArtist() {
+	if index := b.artistList.GetCurrentItem(); index < len(b.artistIdList) {
+		b.handleEntitySelected(b.artistIdList[index])
+	}
+}
+
+// revalidate updates the artists in the background if they changed on the
+// server since they were cached.
+func (b *BrowserPage) revalidate() {
+	response, changed, err := b.ui.connection.RevalidateIndexes(b.ui.ctx)
+	if err != nil {
+		if b.ui.ctx.Err() == nil {
+			b.logger.Error("Revalidating the artists: %v", err)
+		}
+		return
+	}
+	if !changed {
+		return
+	}
+
+	b.ui.app.QueueUpdateDraw(func() {
+		b.setArtists(response.Indexes.Index)
+		b.openSelectedArtist()
+	})
+}
+
 func (b *BrowserPage) showSearchField(visible bool) {
 	b.Root.Clear()
 	b.Root.AddItem(b.artistFlex, 0, 1, true)
@@ -345,8 +340,8 @@ func (b *BrowserPage) handleEntitySelected(directoryId string) {
 		return
 	}
 
-	if response, err := b.ui.connection.GetMusicDirectory(directoryId); err != nil || response == nil {
-		b.logger.Error("handleEntitySelected: GetMusicDirectory %s -- %v", directoryId, err)
+	if response, err := b.ui.connection.GetMusicDirectory(b.ui.ctx, directoryId); err != nil {
+		b.ui.showError("Loading the directory", err)
 		return
 	} else {
 		b.currentDirectory = &response.Directory
@@ -367,7 +362,7 @@ func (b *BrowserPage) handleEntitySelected(directoryId string) {
 
 	for _, entity := range b.currentDirectory.Entities {
 		var handler func()
-		title := entityListTextFormat(entity, b.ui.starIdList) // handles escaping
+		title := entityListTextFormat(entity, b.ui.starIdList, b.ui.rating(entity.Id, entity.UserRating), b.isOffline(entity)) // handles escaping
 
 		if entity.IsDirectory {
 			// it's an album/directory
@@ -403,8 +398,8 @@ func (b *BrowserPage) handleToggleEntityStar() {
 	// If the song is already in the star list, remove it
 	_, remove := b.ui.starIdList[entity.Id]
 
-	if _, err := b.ui.connection.ToggleStar(entity.Id, b.ui.starIdList); err != nil {
-		b.logger.Error("ToggleStar", err)
+	if _, err := b.ui.connection.ToggleStar(b.ui.ctx, service.StarItem, entity.Id, b.ui.starIdList); err != nil {
+		b.ui.showError("Toggling the star", err)
 		return
 	}
 
@@ -415,13 +410,82 @@ func (b *BrowserPage) handleToggleEntityStar() {
 	}
 
 	// update entity list entry
-	text := entityListTextFormat(entity, b.ui.starIdList)
+	text := entityListTextFormat(entity, b.ui.starIdList, b.ui.rating(entity.Id, entity.UserRating), b.isOffline(entity))
 	b.entityList.SetItemText(originalIndex, text, "")
 
 	b.ui.queuePage.UpdateQueue()
+	b.ui.favoritesPage.UpdateStars()
+}
+
+func (b *BrowserPage) handleSetEntityRating(rating int) {
+	currentIndex := b.entityList.GetCurrentItem()
+	originalIndex := currentIndex
+	if b.currentDirectory.Parent != "" {
+		// account for [..] entry that we show, see handleEntitySelected()
+		currentIndex--
+	}
+	if currentIndex < 0 || currentIndex >= len(b.currentDirectory.Entities) {
+		return
+	}
+
+	entity := b.currentDirectory.Entities[currentIndex]
+	if !b.ui.setRating(entity.Id, rating, b.currentDirectory.Id, entity.AlbumId) {
+		return
+	}
+
+	text := entityListTextFormat(entity, b.ui.starIdList, rating, b.isOffline(entity))
+	b.entityList.SetItemText(originalIndex, text, "")
+
+	b.ui.queuePage.UpdateQueue()
+}
+
+func (b *BrowserPage) handleToggleEntityOffline() {
+	currentIndex := b.entityList.GetCurrentItem()
+	if b.currentDirectory.Parent != "" {
+		// account for [..] entry that we show, see handleEntitySelected()
+		currentIndex--
+	}
+	if currentIndex < 0 || currentIndex >= len(b.currentDirectory.Entities) {
+		return
+	}
+
+	entity := b.currentDirectory.Entities[currentIndex]
+	if entity.IsDirectory {
+		b.ui.toggleOffline(service.OfflineDirectory, entity.Id, entity.Title)
+	} else {
+		b.ui.toggleOffline(service.OfflineSong, entity.Id, entity.Title)
+	}
+}
+
+// isOffline reports whether the directory is marked available offline or
+// the song is downloaded.
+func (b *BrowserPage) isOffline(entity service.SubsonicEntity) bool {
+	if entity.IsDirectory {
+		return b.ui.connection.IsMarkedOffline(service.OfflineDirectory, entity.Id)
+	}
+	return b.ui.connection.IsOffline(entity.Id)
+}
+
+// updateOffline updates the offline indicators of the open directory.
+func (b *BrowserPage) updateOffline() {
+	if b.currentDirectory == nil {
+		return
+	}
+	offset := 0
+	if b.currentDirectory.Parent != "" {
+		// the [..] entry
+		offset = 1
+	}
+	for i, entity := range b.currentDirectory.Entities {
+		if i+offset >= b.entityList.GetItemCount() {
+			break
+		}
+		text := entityListTextFormat(entity, b.ui.starIdList, b.ui.rating(entity.Id, entity.UserRating), b.isOffline(entity))
+		b.entityList.SetItemText(i+offset, text, "")
+	}
 }
 
-func entityListTextFormat(entity service.SubsonicEntity, starredItems map[string]struct{}) string {
+func entityListTextFormat(entity service.SubsonicEntity, starredItems map[string]struct{}, rating int, offline bool) string {
 	title, err := utils.Normalize(entity.Title)
 	if err != nil {
 		title = entity.Title
@@ -436,13 +500,13 @@ func entityListTextFormat(entity service.SubsonicEntity, starredItems map[string
 	if hasStar {
 		star = " [red]♥"
 	}
-	return tview.Escape(title) + star
+	return tview.Escape(title) + formatRating(rating) + star + formatOffline(offline)
 }
 
 func (b *BrowserPage) addDirectoryToQueue(entity *service.SubsonicEntity) {
-	response, err := b.ui.connection.GetMusicDirectory(entity.Id)
+	response, err := b.ui.connection.GetMusicDirectory(b.ui.ctx, entity.Id)
 	if err != nil {
-		b.logger.Error("addDirectoryToQueue: GetMusicDirectory %s -- %s", entity.Id, err)
+		b.ui.showError("Adding the directory to the queue", err)
 		return
 	}
 
@@ -516,8 +580,8 @@ func (b *BrowserPage) handleAddSongToPlaylist(playlist *service.SubsonicPlaylist
 	entity := b.currentDirectory.Entities[currentIndex]
 
 	if !entity.IsDirectory {
-		if err := b.ui.connection.AddSongToPlaylist(string(playlist.Id), entity.Id); err != nil {
-			b.logger.Error("AddSongToPlaylist", err)
+		if err := b.ui.connection.AddSongToPlaylist(b.ui.ctx, string(playlist.Id), entity.Id); err != nil {
+			b.ui.showError("Adding the song to the playlist", err)
 			return
 		}
 	}
@@ -0,0 +1,282 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package gui
+
+import (
+	"fmt"
+	"maps"
+	"math/rand"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"github.com/spezifisch/stmps/mpvplayer"
+	"github.com/spezifisch/stmps/service"
+	"github.com/spezifisch/stmps/utils"
+)
+
+// FavoritesPage shows the starred artists, albums and songs.
+type FavoritesPage struct {
+	Root *tview.Flex
+
+	artistList *tview.List
+	albumList  *tview.List
+	songList   *tview.List
+
+	artists []service.Artist
+	albums  []service.Album
+	songs   []service.SubsonicEntity
+
+	// the favorites are loaded when the page is opened
+	opened bool
+
+	// external refs
+	ui     *Ui
+	logger utils.Logger
+}
+
+func (ui *Ui) createFavoritesPage() *FavoritesPage {
+	favoritesPage := FavoritesPage{
+		ui:     ui,
+		logger: ui.logger,
+	}
+
+	newList := func(title string) *tview.List {
+		list := tview.NewList().
+			ShowSecondaryText(false).
+			SetSelectedFocusOnly(true)
+		list.Box.
+			SetTitle(title).
+			SetTitleAlign(tview.AlignLeft).
+			SetBorder(true)
+		return list
+	}
+	favoritesPage.artistList = newList(" starred artists ")
+	favoritesPage.albumList = newList(" starred albums ")
+	favoritesPage.songList = newList(" starred songs ")
+
+	favoritesPage.Root = tview.NewFlex().SetDirection(tview.FlexColumn).
+		AddItem(favoritesPage.artistList, 0, 1, true).
+		AddItem(favoritesPage.albumList, 0, 1, false).
+		AddItem(favoritesPage.songList, 0, 1, false)
+
+	// left and right go to the neighbouring column
+	columns := []*tview.List{favoritesPage.artistList, favoritesPage.albumList, favoritesPage.songList}
+	for i, list := range columns {
+		left := columns[(i+len(columns)-1)%len(columns)]
+		right := columns[(i+1)%len(columns)]
+		list.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+			switch event.Key() {
+			case tcell.KeyLeft:
+				ui.app.SetFocus(left)
+				return nil
+			case tcell.KeyRight:
+				ui.app.SetFocus(right)
+				return nil
+			}
+
+			switch ui.keyBindings.Command(ContextFavorites, event) {
+			case "addToQueue":
+				favoritesPage.handleAddToQueue(list)
+				return nil
+			case "playAll":
+				start := 0
+				if list == favoritesPage.songList {
+					start = favoritesPage.songList.GetCurrentItem()
+				}
+				favoritesPage.playAll(start, false)
+				return nil
+			case "shuffleAll":
+				favoritesPage.playAll(0, true)
+				return nil
+			case "unstar":
+				favoritesPage.handleUnstar(list)
+				return nil
+			case "refresh":
+				favoritesPage.load()
+				return nil
+			}
+			return event
+		})
+	}
+
+	return &favoritesPage
+}
+
+// open loads the favorites when the page is shown the first time.
+func (f *FavoritesPage) open() {
+	if !f.opened {
+		f.opened = true
+		f.load()
+	}
+}
+
+// UpdateStars reloads the favorites after a star was toggled elsewhere.
+func (f *FavoritesPage) UpdateStars() {
+	if f.opened {
+		f.load()
+	}
+}
+
+// load fetches the favorites in the background.
+func (f *FavoritesPage) load() {
+	go func() {
+		response, err := f.ui.connection.GetStarred2(f.ui.ctx)
+		if err != nil {
+			if f.ui.ctx.Err() == nil {
+				f.ui.showError("Loading the favorites", err)
+			}
+			return
+		}
+		// the browser shows the stars by the folder IDs
+		folders, err := f.ui.connection.GetStarred(f.ui.ctx)
+		if err != nil {
+			if f.ui.ctx.Err() == nil {
+				f.ui.showError("Loading the favorites", err)
+			}
+			return
+		}
+
+		f.ui.app.QueueUpdateDraw(func() {
+			f.setStarred(response.Starred2, folders.Starred)
+		})
+	}()
+}
+
+// setStarred shows the starred items and rebuilds the starred IDs from them
+// and the folder based ones, which may differ for artists and albums.
+func (f *FavoritesPage) setStarred(starred, folders service.SubsonicResults) {
+	f.artists = starred.Artist
+	f.albums = starred.Album
+	f.songs = starred.Song
+
+	// items may have been unstarred on other clients, the map is shared with
+	// the queue page
+	previous := maps.Clone(f.ui.starIdList)
+	clear(f.ui.starIdList)
+	for _, results := range []service.SubsonicResults{starred, folders} {
+		for _, artist := range results.Artist {
+			f.ui.starIdList[artist.Id] = struct{}{}
+		}
+		for _, album := range results.Album {
+			f.ui.starIdList[album.Id] = struct{}{}
+		}
+		for _, song := range results.Song {
+			f.ui.starIdList[song.Id] = struct{}{}
+		}
+	}
+	if !maps.Equal(previous, f.ui.starIdList) {
+		f.ui.browserPage.UpdateStars()
+		f.ui.queuePage.UpdateQueue()
+	}
+
+	f.fillList(f.artistList, len(f.artists), func(i int) string {
+		return tview.Escape(f.artists[i].Name)
+	})
+	f.fillList(f.albumList, len(f.albums), func(i int) string {
+		offline := f.ui.connection.IsMarkedOffline(service.OfflineAlbum, f.albums[i].Id)
+		return albumListTextFormat(f.albums[i], nil, f.ui.rating(f.albums[i].Id, f.albums[i].UserRating), offline)
+	})
+	f.fillList(f.songList, len(f.songs), func(i int) string {
+		return formatSongForPlaylistEntry(f.songs[i])
+	})
+	f.updateTitles()
+}
+
+// fillList replaces the items of list, keeping the selection where it was.
+func (f *FavoritesPage) fillList(list *tview.List, count int, text func(i int) string) {
+	current := list.GetCurrentItem()
+	list.Clear()
+	for i := 0; i < count; i++ {
+		list.AddItem(text(i), "", 0, nil)
+	}
+	if current < count {
+		list.SetCurrentItem(current)
+	}
+}
+
+func (f *FavoritesPage) updateTitles() {
+	f.artistList.Box.SetTitle(fmt.Sprintf(" starred artists (%d) ", len(f.artists)))
+	f.albumList.Box.SetTitle(fmt.Sprintf(" starred albums (%d) ", len(f.albums)))
+	f.songList.Box.SetTitle(fmt.Sprintf(" starred songs (%d) ", len(f.songs)))
+}
+
+func (f *FavoritesPage) handleAddToQueue(list *tview.List) {
+	index := list.GetCurrentItem()
+	switch {
+	case list == f.artistList && index < len(f.artists):
+		f.ui.searchPage.addArtistToQueue(f.artists[index])
+	case list == f.albumList && index < len(f.albums):
+		f.ui.searchPage.addAlbumToQueue(f.albums[index])
+	case list == f.songList && index < len(f.songs):
+		f.ui.addSongToQueue(&f.songs[index])
+		f.ui.queuePage.UpdateQueue()
+	default:
+		return
+	}
+
+	if index+1 < list.GetItemCount() {
+		list.SetCurrentItem(index + 1)
+	}
+}
+
+// playAll replaces the queue with the starred songs and plays them from
+// start on, shuffled if shuffle is set.
+func (f *FavoritesPage) playAll(start int, shuffle bool) {
+	if len(f.songs) == 0 {
+		return
+	}
+	songs := append([]service.SubsonicEntity{}, f.songs...)
+
+	go func() {
+		items := make(mpvplayer.PlayerQueue, 0, len(songs))
+		for i := range songs {
+			items = append(items, f.ui.newQueueItem(&songs[i]))
+		}
+		if shuffle {
+			rand.Shuffle(len(items), func(i, j int) {
+				items[i], items[j] = items[j], items[i]
+			})
+		}
+
+		if err := f.ui.player.LoadQueue(items, start, 0, false); err != nil {
+			f.logger.Error("playing the favorites: %v", err)
+		}
+		f.ui.app.QueueUpdateDraw(f.ui.queuePage.UpdateQueue)
+	}()
+}
+
+func (f *FavoritesPage) handleUnstar(list *tview.List) {
+	index := list.GetCurrentItem()
+	var kind, id string
+	switch {
+	case list == f.artistList && index < len(f.artists):
+		kind, id = service.StarArtist, f.artists[index].Id
+	case list == f.albumList && index < len(f.albums):
+		kind, id = service.StarAlbum, f.albums[index].Id
+	case list == f.songList && index < len(f.songs):
+		kind, id = service.StarItem, f.songs[index].Id
+	default:
+		return
+	}
+
+	if _, err := f.ui.connection.ToggleStar(f.ui.ctx, kind, id, f.ui.starIdList); err != nil {
+		f.ui.showError("Unstarring", err)
+		return
+	}
+	delete(f.ui.starIdList, id)
+
+	switch list {
+	case f.artistList:
+		f.artists = append(f.artists[:index], f.artists[index+1:]...)
+	case f.albumList:
+		f.albums = append(f.albums[:index], f.albums[index+1:]...)
+	case f.songList:
+		f.songs = append(f.songs[:index], f.songs[index+1:]...)
+	}
+	list.RemoveItem(index)
+	f.updateTitles()
+
+	f.ui.browserPage.UpdateStars()
+	f.ui.queuePage.UpdateQueue()
+}
@@ -0,0 +1,300 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package gui
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"github.com/spezifisch/stmps/service"
+	"github.com/spezifisch/stmps/utils"
+)
+
+const (
+	// genreSongsPageSize is how many songs of the genre are listed at once
+	genreSongsPageSize = 100
+	// genreQueuePageSize is how many songs are fetched at once when queueing a
+	// whole genre, the most the server returns
+	genreQueuePageSize = 500
+)
+
+type GenresPage struct {
+	Root *tview.Flex
+
+	genreList *tview.List
+	songList  *tview.List
+
+	genres []service.SubsonicGenre
+	songs  []service.SubsonicEntity
+	// the genre whose songs are listed
+	genre string
+	// canceled when another genre is selected, the songs are fetched with it
+	ctx    context.Context
+	cancel context.CancelFunc
+	// the genres are loaded when the page is opened
+	opened bool
+	// a page of songs is being fetched
+	loading bool
+	// the server has no more songs of genre
+	complete bool
+
+	// external refs
+	ui     *Ui
+	logger utils.Logger
+}
+
+func (ui *Ui) createGenresPage() *GenresPage {
+	genresPage := GenresPage{
+		ui:     ui,
+		logger: ui.logger,
+	}
+
+	// genre list
+	genresPage.genreList = tview.NewList().
+		ShowSecondaryText(false)
+	genresPage.genreList.Box.
+		SetTitle(" genre ").
+		SetTitleAlign(tview.AlignLeft).
+		SetBorder(true)
+
+	// song list
+	genresPage.songList = tview.NewList().
+		ShowSecondaryText(false).
+		SetSelectedFocusOnly(true)
+	genresPage.songList.Box.
+		SetTitle(" songs ").
+		SetTitleAlign(tview.AlignLeft).
+		SetBorder(true)
+
+	genresPage.Root = tview.NewFlex().SetDirection(tview.FlexColumn).
+		AddItem(genresPage.genreList, 0, 1, true).
+		AddItem(genresPage.songList, 0, 2, false)
+
+	genresPage.genreList.SetChangedFunc(func(index int, _ string, _ string, _ rune) {
+		if index < len(genresPage.genres) {
+			genresPage.showSongs(genresPage.genres[index].Name)
+		}
+	})
+	genresPage.genreList.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyRight {
+			ui.app.SetFocus(genresPage.songList)
+			return nil
+		}
+
+		switch ui.keyBindings.Command(ContextGenres, event) {
+		case "addToQueue":
+			genresPage.handleQueueGenre(false)
+			return nil
+		case "shuffleGenre":
+			genresPage.handleQueueGenre(true)
+			return nil
+		case "refresh":
+			genresPage.loadGenres()
+			return nil
+		}
+		return event
+	})
+
+	genresPage.songList.SetChangedFunc(func(index int, _ string, _ string, _ rune) {
+		// fetch the next page before reaching the end
+		if index >= len(genresPage.songs)-genreSongsPageSize/4 {
+			genresPage.loadMore()
+		}
+	})
+	genresPage.songList.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyLeft {
+			ui.app.SetFocus(genresPage.genreList)
+			return nil
+		}
+
+		switch ui.keyBindings.Command(ContextGenres, event) {
+		case "addToQueue":
+			index := genresPage.songList.GetCurrentItem()
+			if index < 0 || index >= len(genresPage.songs) {
+				return nil
+			}
+			ui.addSongToQueue(&genresPage.songs[index])
+			ui.queuePage.UpdateQueue()
+			if index+1 < genresPage.songList.GetItemCount() {
+				genresPage.songList.SetCurrentItem(index + 1)
+			}
+			return nil
+		case "shuffleGenre":
+			genresPage.handleQueueGenre(true)
+			return nil
+		case "refresh":
+			genresPage.loadGenres()
+			return nil
+		}
+		return event
+	})
+
+	return &genresPage
+}
+
+// open loads the genres when the page is shown the first time.
+func (g *GenresPage) open() {
+	if !g.opened {
+		g.opened = true
+		g.loadGenres()
+	}
+}
+
+// loadGenres fetches the genres in the background, keeping the selected one
+// if it's still there.
+func (g *GenresPage) loadGenres() {
+	go func() {
+		response, err := g.ui.connection.GetGenres(g.ui.ctx)
+		if err != nil {
+			if g.ui.ctx.Err() == nil {
+				g.ui.showError("Loading the genres", err)
+			}
+			return
+		}
+
+		g.ui.app.QueueUpdateDraw(func() {
+			g.setGenres(response.Genres.Genres)
+		})
+	}()
+}
+
+func (g *GenresPage) setGenres(genres []service.SubsonicGenre) {
+	selected := g.genre
+	g.genres = genres
+
+	g.genreList.Clear()
+	goBackTo := 0
+	for i, genre := range genres {
+		if genre.Name == selected {
+			goBackTo = i
+		}
+		g.genreList.AddItem(genreListTextFormat(genre), "", 0, nil)
+	}
+	g.genreList.Box.SetTitle(fmt.Sprintf(" genre (%d) ", len(genres)))
+
+	if len(genres) == 0 {
+		g.showSongs("")
+		return
+	}
+	// adding the first genre showed its songs, selecting another one shows
+	// its songs instead
+	g.genreList.SetCurrentItem(goBackTo)
+}
+
+// showSongs replaces the songs with the first page of genre's songs, nothing
+// if genre is empty.
+func (g *GenresPage) showSongs(genre string) {
+	// pages of the previous genre are stale now
+	if g.cancel != nil {
+		g.cancel()
+	}
+	g.ctx, g.cancel = context.WithCancel(g.ui.ctx)
+
+	g.genre = genre
+	g.songs = nil
+	g.loading = false
+	g.complete = genre == ""
+	g.songList.Clear()
+	g.updateTitle()
+
+	g.loadMore()
+}
+
+// loadMore fetches the next page of songs in the background.
+func (g *GenresPage) loadMore() {
+	if g.loading || g.complete {
+		return
+	}
+	g.loading = true
+
+	ctx := g.ctx
+	genre := g.genre
+	offset := len(g.songs)
+	go func() {
+		response, err := g.ui.connection.GetSongsByGenre(ctx, genre, genreSongsPageSize, offset)
+		if err != nil && ctx.Err() == nil {
+			g.ui.showError("Loading the songs of the genre", err)
+		}
+
+		g.ui.app.QueueUpdateDraw(func() {
+			if ctx.Err() != nil {
+				// another genre is shown
+				return
+			}
+			if err != nil {
+				g.loading = false
+				return
+			}
+
+			songs := response.SongsByGenre.Song
+			if len(songs) < genreSongsPageSize {
+				g.complete = true
+			}
+			for _, song := range songs {
+				g.songs = append(g.songs, song)
+				g.songList.AddItem(formatSongForPlaylistEntry(song), "", 0, nil)
+			}
+			// adding the first song selects it, which must not fetch the next
+			// page already
+			g.loading = false
+			g.updateTitle()
+		})
+	}()
+}
+
+func (g *GenresPage) updateTitle() {
+	if g.complete {
+		g.songList.Box.SetTitle(fmt.Sprintf(" songs (%d) ", len(g.songs)))
+	} else {
+		g.songList.Box.SetTitle(fmt.Sprintf(" songs (%d+) ", len(g.songs)))
+	}
+}
+
+// handleQueueGenre adds all songs of the selected genre to the queue in the
+// background, large genres take many requests.
+func (g *GenresPage) handleQueueGenre(shuffle bool) {
+	index := g.genreList.GetCurrentItem()
+	if index < 0 || index >= len(g.genres) {
+		return
+	}
+	go g.queueGenre(g.genres[index].Name, shuffle)
+}
+
+func (g *GenresPage) queueGenre(genre string, shuffle bool) {
+	var songs []service.SubsonicEntity
+	for offset := 0; ; offset += genreQueuePageSize {
+		response, err := g.ui.connection.GetSongsByGenre(g.ui.ctx, genre, genreQueuePageSize, offset)
+		if err != nil {
+			if g.ui.ctx.Err() == nil {
+				g.ui.showError("Adding the genre to the queue", err)
+			}
+			return
+		}
+		songs = append(songs, response.SongsByGenre.Song...)
+		if len(response.SongsByGenre.Song) < genreQueuePageSize {
+			break
+		}
+	}
+
+	items := g.ui.newQueueItems(songs)
+	if shuffle {
+		rand.Shuffle(len(items), func(i, j int) {
+			items[i], items[j] = items[j], items[i]
+		})
+	}
+	g.logger.Info("adding %d songs of genre %s to the queue", len(items), genre)
+	queue, _ := g.ui.player.GetQueueCopy()
+	if err := g.ui.player.InsertIntoQueue(len(queue), items...); err != nil {
+		g.logger.Error("adding genre %s to the queue: %v", genre, err)
+		return
+	}
+	g.ui.app.QueueUpdateDraw(g.ui.queuePage.UpdateQueue)
+}
+
+func genreListTextFormat(genre service.SubsonicGenre) string {
+	return fmt.Sprintf("%s [gray](%d songs, %d albums)", tview.Escape(genre.Name), genre.SongCount, genre.AlbumCount)
+}
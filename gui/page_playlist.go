@@ -50,7 +50,7 @@ func (ui *Ui) createPlaylistPage() *PlaylistPage {
 
 	// add the playlists
 	for _, playlist := range ui.playlists {
-		playlistPage.playlistList.AddItem(tview.Escape(playlist.Name), "", 0, nil)
+		playlistPage.playlistList.AddItem(playlistPage.playlistTextFormat(playlist), "", 0, nil)
 	}
 
 	// right half: songs of selected playlist
@@ -106,18 +106,20 @@ func (ui *Ui) createPlaylistPage() *PlaylistPage {
 			ui.app.SetFocus(playlistPage.selectedPlaylist)
 			return nil
 		}
-		if event.Rune() == 'a' {
+		switch ui.keyBindings.Command(ContextPlaylists, event) {
+		case "addToQueue":
 			playlistPage.handleAddPlaylistToQueue()
 			return nil
-		}
-		if event.Rune() == 'n' {
+		case "newPlaylist":
 			ui.pages.ShowPage(PageNewPlaylist)
 			ui.app.SetFocus(ui.playlistPage.newPlaylistInput)
 			return nil
-		}
-		if event.Rune() == 'd' {
+		case "deletePlaylist":
 			ui.pages.ShowPage(PageDeletePlaylist)
 			return nil
+		case "toggleOffline":
+			playlistPage.handleTogglePlaylistOffline()
+			return nil
 		}
 
 		return event
@@ -128,9 +130,13 @@ func (ui *Ui) createPlaylistPage() *PlaylistPage {
 			ui.app.SetFocus(playlistPage.playlistList)
 			return nil
 		}
-		if event.Rune() == 'a' {
+		switch ui.keyBindings.Command(ContextPlaylists, event) {
+		case "addToQueue":
 			playlistPage.handleAddPlaylistSongToQueue()
 			return nil
+		case "toggleOffline":
+			playlistPage.handleToggleSongOffline()
+			return nil
 		}
 		return event
 	})
@@ -204,6 +210,7 @@ func (p *PlaylistPage) UpdatePlaylists() {
 	}
 	spinnerMax := len(spinnerText) - 1
 	playlistsButton := buttonOrder[PAGE_PLAYLISTS]
+	playlistsKey := p.ui.menuWidget.buttonKey(playlistsButton)
 	stop := make(chan bool)
 	go func() {
 		var idx int
@@ -215,11 +222,11 @@ func (p *PlaylistPage) UpdatePlaylists() {
 				p.ui.app.QueueUpdateDraw(func() {
 					var format string
 					if playlistsButton == p.ui.menuWidget.activeButton {
-						format = "%d: [::b][red]%c[white]%s[::-]"
+						format = "%s: [::b][red]%c[white]%s[::-]"
 					} else {
-						format = "%d: [red]%c[white]%s"
+						format = "%s: [red]%c[white]%s"
 					}
-					label := fmt.Sprintf(format, PAGE_PLAYLISTS+1, spinnerText[idx], playlistsButton)
+					label := fmt.Sprintf(format, playlistsKey, spinnerText[idx], playlistsButton)
 					p.ui.menuWidget.buttons[playlistsButton].SetLabel(label)
 					idx++
 					if idx > spinnerMax {
@@ -230,11 +237,11 @@ func (p *PlaylistPage) UpdatePlaylists() {
 				p.ui.app.QueueUpdateDraw(func() {
 					var format string
 					if playlistsButton == p.ui.menuWidget.activeButton {
-						format = "%d: [::b]%s[::-]"
+						format = "%s: [::b]%s[::-]"
 					} else {
-						format = "%d: %s"
+						format = "%s: %s"
 					}
-					label := fmt.Sprintf(format, PAGE_PLAYLISTS+1, playlistsButton)
+					label := fmt.Sprintf(format, playlistsKey, playlistsButton)
 					p.ui.menuWidget.buttons[playlistsButton].SetLabel(label)
 				})
 				close(stop)
@@ -244,9 +251,9 @@ func (p *PlaylistPage) UpdatePlaylists() {
 	}()
 
 	go func() {
-		response, err := p.ui.connection.GetPlaylists()
+		response, err := p.ui.connection.GetPlaylists(p.ui.ctx)
 		if err != nil {
-			p.logger.Error("GetPlaylists", err)
+			p.ui.showError("Loading the playlists", err)
 			p.isUpdating = false
 			stop <- true
 			return
@@ -274,7 +281,7 @@ func (p *PlaylistPage) UpdatePlaylists() {
 }
 
 func (p *PlaylistPage) addPlaylist(playlist service.SubsonicPlaylist) {
-	p.playlistList.AddItem(tview.Escape(playlist.Name), "", 0, nil)
+	p.playlistList.AddItem(p.playlistTextFormat(playlist), "", 0, nil)
 	p.ui.addToPlaylistList.AddItem(tview.Escape(playlist.Name), "", 0, nil)
 }
 
@@ -327,21 +334,73 @@ func (p *PlaylistPage) handlePlaylistSelected(playlist service.SubsonicPlaylist)
 
 	for _, entity := range playlist.Entries {
 		handler := makeSongHandler(&entity, p.ui, entity.Artist)
-		line := formatSongForPlaylistEntry(entity)
+		line := formatSongForPlaylistEntry(entity) + formatOffline(p.ui.connection.IsOffline(entity.Id))
 		p.selectedPlaylist.AddItem(line, "", 0, handler)
 	}
 }
 
+func (p *PlaylistPage) handleTogglePlaylistOffline() {
+	index := p.playlistList.GetCurrentItem()
+	if index < 0 || index >= len(p.ui.playlists) {
+		return
+	}
+	playlist := p.ui.playlists[index]
+	p.ui.toggleOffline(service.OfflinePlaylist, string(playlist.Id), playlist.Name)
+}
+
+func (p *PlaylistPage) handleToggleSongOffline() {
+	playlistIndex := p.playlistList.GetCurrentItem()
+	entityIndex := p.selectedPlaylist.GetCurrentItem()
+	if playlistIndex < 0 || playlistIndex >= len(p.ui.playlists) {
+		return
+	}
+	if entityIndex < 0 || entityIndex >= len(p.ui.playlists[playlistIndex].Entries) {
+		return
+	}
+	entity := p.ui.playlists[playlistIndex].Entries[entityIndex]
+	p.ui.toggleOffline(service.OfflineSong, entity.Id, entity.Title)
+}
+
+// updateOffline updates the offline indicators of the playlists and the
+// songs of the selected one.
+func (p *PlaylistPage) updateOffline() {
+	for i, playlist := range p.ui.playlists {
+		if i >= p.playlistList.GetItemCount() {
+			break
+		}
+		p.playlistList.SetItemText(i, p.playlistTextFormat(playlist), "")
+	}
+
+	index := p.playlistList.GetCurrentItem()
+	if index < 0 || index >= len(p.ui.playlists) {
+		return
+	}
+	for i, entity := range p.ui.playlists[index].Entries {
+		if i >= p.selectedPlaylist.GetItemCount() {
+			break
+		}
+		line := formatSongForPlaylistEntry(entity) + formatOffline(p.ui.connection.IsOffline(entity.Id))
+		p.selectedPlaylist.SetItemText(i, line, "")
+	}
+}
+
+// playlistTextFormat shows the playlist's name and whether it's marked
+// available offline
+func (p *PlaylistPage) playlistTextFormat(playlist service.SubsonicPlaylist) string {
+	offline := p.ui.connection.IsMarkedOffline(service.OfflinePlaylist, string(playlist.Id))
+	return tview.Escape(playlist.Name) + formatOffline(offline)
+}
+
 func (p *PlaylistPage) newPlaylist(name string) {
-	response, err := p.ui.connection.CreatePlaylist("", name, nil)
+	response, err := p.ui.connection.CreatePlaylist(p.ui.ctx, "", name, nil)
 	if err != nil {
-		p.logger.Error("newPlaylist: CreatePlaylist %s -- %s", name, err)
+		p.ui.showError("Creating the playlist", err)
 		return
 	}
 
 	p.ui.playlists = append(p.ui.playlists, response.Playlist)
 
-	p.playlistList.AddItem(tview.Escape(response.Playlist.Name), "", 0, nil)
+	p.playlistList.AddItem(p.playlistTextFormat(response.Playlist), "", 0, nil)
 	p.ui.addToPlaylistList.AddItem(tview.Escape(response.Playlist.Name), "", 0, nil)
 }
 
@@ -361,7 +420,13 @@ func (p *PlaylistPage) deletePlaylist(index int) {
 
 	p.playlistList.RemoveItem(index)
 	p.ui.addToPlaylistList.RemoveItem(index)
-	if err := p.ui.connection.DeletePlaylist(string(playlist.Id)); err != nil {
-		p.logger.Error("deletePlaylist", err)
+	if err := p.ui.connection.DeletePlaylist(p.ui.ctx, string(playlist.Id)); err != nil {
+		p.ui.showError("Deleting the playlist", err)
+		// bring the list back in line with the server
+		p.UpdatePlaylists()
+		return
+	}
+	if p.ui.connection.IsMarkedOffline(service.OfflinePlaylist, string(playlist.Id)) {
+		p.ui.toggleOffline(service.OfflinePlaylist, string(playlist.Id), playlist.Name)
 	}
 }
@@ -0,0 +1,418 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package gui
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"github.com/spezifisch/stmps/mpvplayer"
+	"github.com/spezifisch/stmps/service"
+	"github.com/spezifisch/stmps/utils"
+)
+
+// newestEpisodesCount is how many episodes the newest episodes entry shows
+const newestEpisodesCount = 30
+
+// PodcastsPage lists the subscribed podcast channels and their episodes.
+type PodcastsPage struct {
+	Root           *tview.Flex
+	SubscribeModal tview.Primitive
+	DeleteModal    *tview.Modal
+
+	channelList    *tview.List
+	episodeList    *tview.List
+	subscribeInput *tview.InputField
+
+	channels []service.PodcastChannel
+	newest   []service.PodcastEpisode
+	// episodes shown in episodeList, of the channel with ID shownChannel or
+	// the newest ones if it's ""
+	episodes     []service.PodcastEpisode
+	shownChannel string
+	// the channels are loaded when the page is opened
+	opened bool
+
+	// external refs
+	ui     *Ui
+	logger utils.Logger
+}
+
+func (ui *Ui) createPodcastsPage() *PodcastsPage {
+	podcastsPage := PodcastsPage{
+		ui:     ui,
+		logger: ui.logger,
+	}
+
+	podcastsPage.channelList = tview.NewList().
+		ShowSecondaryText(false).
+		SetSelectedFocusOnly(true)
+	podcastsPage.channelList.Box.
+		SetTitle(" channels ").
+		SetTitleAlign(tview.AlignLeft).
+		SetBorder(true)
+	podcastsPage.channelList.SetChangedFunc(func(int, string, string, rune) {
+		podcastsPage.showEpisodes()
+	})
+
+	podcastsPage.episodeList = tview.NewList().
+		ShowSecondaryText(false).
+		SetSelectedFocusOnly(true)
+	podcastsPage.episodeList.Box.
+		SetTitle(" episodes ").
+		SetTitleAlign(tview.AlignLeft).
+		SetBorder(true)
+
+	podcastsPage.Root = tview.NewFlex().SetDirection(tview.FlexColumn).
+		AddItem(podcastsPage.channelList, 0, 1, true).
+		AddItem(podcastsPage.episodeList, 0, 2, false)
+
+	podcastsPage.channelList.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyRight {
+			ui.app.SetFocus(podcastsPage.episodeList)
+			return nil
+		}
+		return podcastsPage.handleInput(event, podcastsPage.channelList)
+	})
+	podcastsPage.episodeList.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyLeft {
+			ui.app.SetFocus(podcastsPage.channelList)
+			return nil
+		}
+		return podcastsPage.handleInput(event, podcastsPage.episodeList)
+	})
+
+	// "subscribe" modal
+	podcastsPage.subscribeInput = tview.NewInputField().
+		SetLabel("Feed URL: ").
+		SetFieldWidth(60)
+	podcastsPage.subscribeInput.SetDoneFunc(func(key tcell.Key) {
+		ui.pages.HidePage(PageSubscribePodcast)
+		ui.app.SetFocus(podcastsPage.channelList)
+		if key == tcell.KeyEnter {
+			podcastsPage.subscribe(podcastsPage.subscribeInput.GetText())
+		}
+	})
+	subscribeFlex := tview.NewFlex().
+		SetDirection(tview.FlexRow).
+		AddItem(podcastsPage.subscribeInput, 0, 1, true)
+	subscribeFlex.SetTitle("Subscribe to podcast").
+		SetBorder(true)
+	podcastsPage.SubscribeModal = makeModal(subscribeFlex, 74, 3)
+
+	// asks before unsubscribing, see confirmUnsubscribe
+	podcastsPage.DeleteModal = tview.NewModal().
+		SetBackgroundColor(tcell.ColorBlack)
+
+	return &podcastsPage
+}
+
+func (p *PodcastsPage) handleInput(event *tcell.EventKey, list *tview.List) *tcell.EventKey {
+	switch p.ui.keyBindings.Command(ContextPodcasts, event) {
+	case "addToQueue":
+		p.handleAddToQueue(list)
+	case "subscribe":
+		p.subscribeInput.SetText("")
+		p.ui.pages.ShowPage(PageSubscribePodcast)
+		p.ui.pages.SendToFront(PageSubscribePodcast)
+		p.ui.app.SetFocus(p.subscribeInput)
+	case "unsubscribe":
+		p.confirmUnsubscribe()
+	case "downloadEpisode":
+		if episode := p.selectedEpisode(); episode != nil {
+			p.serverAction("Downloading the episode", episode.Id, p.ui.connection.DownloadPodcastEpisode)
+		}
+	case "deleteEpisode":
+		if episode := p.selectedEpisode(); episode != nil {
+			p.serverAction("Deleting the episode", episode.Id, p.ui.connection.DeletePodcastEpisode)
+		}
+	case "refresh":
+		p.refresh()
+	default:
+		return event
+	}
+	return nil
+}
+
+// open loads the channels when the page is shown the first time, later it
+// only updates the resume positions.
+func (p *PodcastsPage) open() {
+	if !p.opened {
+		p.opened = true
+		p.load()
+		return
+	}
+	p.showEpisodes()
+}
+
+// load fetches the channels with their episodes and the newest episodes in
+// the background.
+func (p *PodcastsPage) load() {
+	go func() {
+		response, err := p.ui.connection.GetPodcasts(p.ui.ctx, "", true)
+		if err != nil {
+			if p.ui.ctx.Err() == nil {
+				p.ui.showError("Loading the podcasts", err)
+			}
+			return
+		}
+		channels := response.Podcasts.Channels
+
+		response, err = p.ui.connection.GetNewestPodcasts(p.ui.ctx, newestEpisodesCount)
+		if err != nil {
+			if p.ui.ctx.Err() == nil {
+				p.ui.showError("Loading the newest episodes", err)
+			}
+			return
+		}
+
+		p.ui.app.QueueUpdateDraw(func() {
+			p.setPodcasts(channels, response.NewestPodcasts.Episodes)
+		})
+	}()
+}
+
+// refresh lets the server check the feeds for new episodes. The server does
+// it in the background, so the new episodes may only show up on the next
+// refresh.
+func (p *PodcastsPage) refresh() {
+	go func() {
+		if err := p.ui.connection.RefreshPodcasts(p.ui.ctx); err != nil {
+			p.ui.showError("Refreshing the podcasts", err)
+			return
+		}
+		p.load()
+	}()
+}
+
+func (p *PodcastsPage) setPodcasts(channels []service.PodcastChannel, newest []service.PodcastEpisode) {
+	p.channels = channels
+	p.newest = newest
+
+	current := p.channelList.GetCurrentItem()
+	p.channelList.Clear()
+	p.channelList.AddItem("[::b]Newest episodes", "", 0, nil)
+	for _, channel := range channels {
+		p.channelList.AddItem(podcastChannelTextFormat(channel), "", 0, nil)
+	}
+	if current < p.channelList.GetItemCount() {
+		p.channelList.SetCurrentItem(current)
+	}
+	p.channelList.Box.SetTitle(fmt.Sprintf(" channels (%d) ", len(channels)))
+
+	p.showEpisodes()
+}
+
+// selectedChannel returns the channel selected in the channel list, nil for
+// the newest episodes.
+func (p *PodcastsPage) selectedChannel() *service.PodcastChannel {
+	index := p.channelList.GetCurrentItem() - 1
+	if index < 0 || index >= len(p.channels) {
+		return nil
+	}
+	return &p.channels[index]
+}
+
+func (p *PodcastsPage) selectedEpisode() *service.PodcastEpisode {
+	index := p.episodeList.GetCurrentItem()
+	if index < 0 || index >= len(p.episodes) {
+		return nil
+	}
+	return &p.episodes[index]
+}
+
+// showEpisodes fills the episode list with those of the selected channel.
+func (p *PodcastsPage) showEpisodes() {
+	channelId := ""
+	if channel := p.selectedChannel(); channel != nil {
+		channelId = channel.Id
+		p.episodes = channel.Episodes
+		p.episodeList.Box.SetTitle(fmt.Sprintf(" %s (%d) ", tview.Escape(channel.Title), len(p.episodes)))
+	} else {
+		p.episodes = p.newest
+		p.episodeList.Box.SetTitle(fmt.Sprintf(" newest episodes (%d) ", len(p.episodes)))
+	}
+
+	// the selection is kept when the same channel is reloaded
+	current := p.episodeList.GetCurrentItem()
+	if channelId != p.shownChannel {
+		current = 0
+		p.shownChannel = channelId
+	}
+	p.episodeList.Clear()
+	for _, episode := range p.episodes {
+		var position int64
+		if episode.StreamId != "" {
+			position = p.ui.player.EpisodePosition(episode.StreamId)
+		}
+		p.episodeList.AddItem(podcastEpisodeTextFormat(episode, position), "", 0, nil)
+	}
+	if current < len(p.episodes) {
+		p.episodeList.SetCurrentItem(current)
+	}
+}
+
+// handleAddToQueue adds the selected episode, or all downloaded episodes of
+// the selected channel, oldest first.
+func (p *PodcastsPage) handleAddToQueue(list *tview.List) {
+	var episodes []service.PodcastEpisode
+	if list == p.episodeList {
+		episode := p.selectedEpisode()
+		if episode == nil {
+			return
+		}
+		if episode.StreamId == "" {
+			p.ui.showMessageBox("The episode isn't downloaded on the server yet.")
+			return
+		}
+		episodes = append(episodes, *episode)
+	} else {
+		// the channels list the newest episodes first
+		for i := len(p.episodes) - 1; i >= 0; i-- {
+			if p.episodes[i].StreamId != "" {
+				episodes = append(episodes, p.episodes[i])
+			}
+		}
+		if len(episodes) == 0 {
+			p.ui.showMessageBox("No episodes are downloaded on the server yet.")
+			return
+		}
+	}
+
+	items := make(mpvplayer.PlayerQueue, 0, len(episodes))
+	for _, episode := range episodes {
+		items = append(items, p.newEpisodeQueueItem(episode))
+	}
+	queue, _ := p.ui.player.GetQueueCopy()
+	if err := p.ui.player.InsertIntoQueue(len(queue), items...); err != nil {
+		p.logger.Error("adding episodes to the queue: %v", err)
+		return
+	}
+	p.ui.queuePage.UpdateQueue()
+
+	index := list.GetCurrentItem()
+	if index+1 < list.GetItemCount() {
+		list.SetCurrentItem(index + 1)
+	}
+}
+
+// newEpisodeQueueItem makes a queue item streaming the downloaded episode,
+// it resumes where it was left.
+func (p *PodcastsPage) newEpisodeQueueItem(episode service.PodcastEpisode) mpvplayer.QueueItem {
+	channelTitle := episode.Album
+	for _, channel := range p.channels {
+		if channel.Id == episode.ChannelId {
+			channelTitle = channel.Title
+			break
+		}
+	}
+	artist := episode.Artist
+	if artist == "" {
+		artist = channelTitle
+	}
+
+	return mpvplayer.QueueItem{
+		Id:         episode.StreamId,
+		Uri:        p.ui.connection.GetPlayUrl(&service.SubsonicEntity{Id: episode.StreamId}),
+		Title:      episode.Title,
+		Artist:     artist,
+		Album:      channelTitle,
+		Duration:   episode.Duration,
+		CoverArtId: episode.CoverArt,
+		Podcast:    true,
+	}
+}
+
+func (p *PodcastsPage) subscribe(feedUrl string) {
+	feedUrl = strings.TrimSpace(feedUrl)
+	if feedUrl == "" {
+		return
+	}
+	go func() {
+		if err := p.ui.connection.CreatePodcastChannel(p.ui.ctx, feedUrl); err != nil {
+			p.ui.showError("Subscribing to the podcast", err)
+			return
+		}
+		p.load()
+	}()
+}
+
+// confirmUnsubscribe asks whether to unsubscribe from the selected channel.
+func (p *PodcastsPage) confirmUnsubscribe() {
+	channel := p.selectedChannel()
+	if channel == nil {
+		return
+	}
+	id := channel.Id
+
+	p.DeleteModal.SetText(fmt.Sprintf("Unsubscribe from %s? Its downloaded episodes are deleted on the server.", channel.Title)).
+		ClearButtons().
+		AddButtons([]string{"Unsubscribe", "Cancel"}).
+		SetDoneFunc(func(_ int, label string) {
+			p.ui.pages.HidePage(PageDeletePodcast)
+			p.ui.app.SetFocus(p.channelList)
+			if label == "Unsubscribe" {
+				p.serverAction("Unsubscribing from the podcast", id, p.ui.connection.DeletePodcastChannel)
+			}
+		})
+	p.ui.pages.ShowPage(PageDeletePodcast)
+	p.ui.pages.SendToFront(PageDeletePodcast)
+	p.ui.app.SetFocus(p.DeleteModal)
+}
+
+// serverAction runs a server action on the channel or episode with ID id
+// in the background and reloads the podcasts.
+func (p *PodcastsPage) serverAction(action, id string, run func(ctx context.Context, id string) error) {
+	go func() {
+		if err := run(p.ui.ctx, id); err != nil {
+			p.ui.showError(action, err)
+			return
+		}
+		p.load()
+	}()
+}
+
+func podcastChannelTextFormat(channel service.PodcastChannel) string {
+	text := tview.Escape(channel.Title)
+	if channel.Status == service.PodcastStatusError {
+		text += " [red](error)"
+	}
+	return text
+}
+
+// podcastEpisodeTextFormat shows the title, publish date, duration, download
+// status and the position the episode resumes at if it's not 0.
+func podcastEpisodeTextFormat(episode service.PodcastEpisode, position int64) string {
+	var details []string
+	if len(episode.PublishDate) >= 10 {
+		// only the date of the ISO 8601 time
+		details = append(details, episode.PublishDate[:10])
+	}
+	if episode.Duration > 0 {
+		minutes, seconds := utils.IntSecondsToMinAndSec(episode.Duration)
+		details = append(details, fmt.Sprintf("%02d:%02d", minutes, seconds))
+	}
+	if position > 0 {
+		minutes, seconds := utils.SecondsToMinAndSec(position)
+		details = append(details, fmt.Sprintf("resumes at %02d:%02d", minutes, seconds))
+	}
+
+	text := tview.Escape(episode.Title)
+	if len(details) > 0 {
+		text += " [gray](" + strings.Join(details, ", ") + ")"
+	}
+	switch episode.Status {
+	case service.PodcastStatusCompleted:
+	case service.PodcastStatusDownloading:
+		text += " [yellow]downloading"
+	case service.PodcastStatusError:
+		text += " [red]download failed"
+	default:
+		text += " [gray]not downloaded"
+	}
+	return text
+}
@@ -11,6 +11,8 @@ import (
 	"image"
 	"image/png"
 	"os"
+	"strconv"
+	"strings"
 	"text/template"
 	"time"
 
@@ -23,20 +25,31 @@ import (
 
 // TODO show total # of entries somewhere (top?)
 
-// columns: star, title, artist, duration
+// columns: star, offline, title, artist, rating, duration
 const (
-	queueDataColumns = 4
+	queueDataColumns = 6
 	starIcon         = "♥"
+	ratingIcon       = "★"
 )
 
+// coverArtSize is requested from the server, the art is rendered in a few
+// terminal cells so the original size would be a waste
+const coverArtSize = 300
+
 // data for rendering queue table
 type queueData struct {
 	tview.TableContentReadOnly
 
 	// our copy of the queue
 	playerQueue mpvplayer.PlayerQueue
+	// index of the current song, the songs above it have been played
+	currentIndex int
 	// we also need to know which elements are starred
 	starIdList map[string]struct{}
+	// ratings changed since the songs were queued
+	ratings map[string]int
+	// reports whether a song is played from the offline cache
+	isOffline func(id string) bool
 }
 
 var _ tview.TableContent = (*queueData)(nil)
@@ -51,6 +64,15 @@ type QueuePage struct {
 	coverArt   *tview.Image
 	currentArt image.Image
 
+	// lyrics of the playing song, nil if it has none
+	lyricsView *tview.TextView
+	lyrics     *service.StructuredLyrics
+	// highlighted line of synced lyrics
+	lyricsLine int
+
+	// codec and bitrate of the playing song, shown in its song info
+	audioFormat string
+
 	// external refs
 	ui     *Ui
 	logger utils.Logger
@@ -96,51 +118,40 @@ func (ui *Ui) createQueuePage() *QueuePage {
 		SetTitleAlign(tview.AlignLeft).
 		SetBorder(true)
 	queuePage.queueList.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
-		if event.Key() == tcell.KeyDelete || event.Rune() == 'd' {
+		switch ui.keyBindings.Command(ContextQueue, event) {
+		case "deleteSelected":
 			queuePage.handleDeleteFromQueue()
-		} else {
-			switch event.Rune() {
-			case 'y':
-				queuePage.handleToggleStar()
-			case 'j':
-				queuePage.moveSongDown()
-			case 'k':
-				queuePage.moveSongUp()
-			case 's':
-				if len(queuePage.queueData.playerQueue) == 0 {
-					queuePage.logger.Info("no items in queue to save")
-					return nil
-				}
-				queuePage.ui.ShowSelectPlaylist()
-			case 'S':
-				queuePage.shuffle()
-			case 'l':
-				go func() {
-					ssr, err := queuePage.ui.connection.LoadPlayQueue()
-					if err != nil {
-						queuePage.logger.Error("unable to load play queue from server: %s", err)
-						return
-					}
-					queuePage.queueList.Clear()
-					queuePage.queueData.Clear()
-					if ssr.PlayQueue.Entries != nil {
-						for _, ent := range ssr.PlayQueue.Entries {
-							ui.addSongToQueue(&ent)
-						}
-						ui.queuePage.UpdateQueue()
-						if err := ui.player.Play(); err != nil {
-							queuePage.logger.Error("error playing: %s", err)
-						}
-						if err = ui.player.Seek(ssr.PlayQueue.Position); err != nil {
-							queuePage.logger.Error("unable to seek to position %s: %s", time.Duration(ssr.PlayQueue.Position)*time.Second, err)
-						}
-						_ = ui.player.Pause()
-					}
-				}()
-
-			default:
-				return event
+		case "playSelected":
+			queuePage.handlePlaySelected()
+		case "toggleStar":
+			queuePage.handleToggleStar()
+		case "rate1", "rate2", "rate3", "rate4", "rate5", "clearRating":
+			queuePage.handleSetRating(ratingOf(ui.keyBindings.Command(ContextQueue, event)))
+		case "moveDown":
+			queuePage.moveSongDown()
+		case "moveUp":
+			queuePage.moveSongUp()
+		case "saveQueue":
+			if len(queuePage.queueData.playerQueue) == 0 {
+				queuePage.logger.Info("no items in queue to save")
+				return nil
 			}
+			queuePage.ui.ShowSelectPlaylist()
+		case "shuffleQueue":
+			queuePage.shuffle()
+		case "loadServerQueue":
+			go func() {
+				ssr, err := queuePage.ui.connection.LoadPlayQueue(queuePage.ui.ctx)
+				if err != nil {
+					ui.showError("Loading the queue from the server", err)
+					return
+				}
+				if ssr.PlayQueue.Entries != nil {
+					ui.loadPlayQueue(ssr.PlayQueue)
+				}
+			}()
+		default:
+			return event
 		}
 
 		return nil
@@ -164,29 +175,42 @@ func (ui *Ui) createQueuePage() *QueuePage {
 	infoFlex.SetBorder(true)
 	infoFlex.SetTitle(" song info ")
 
+	// lyrics of the playing song, the current line is highlighted
+	queuePage.lyricsView = tview.NewTextView().
+		SetDynamicColors(true).
+		SetRegions(true).
+		SetWordWrap(true)
+	queuePage.lyricsView.SetBorder(true).
+		SetTitle(" lyrics ").
+		SetTitleAlign(tview.AlignLeft)
+	queuePage.setLyrics(nil)
+
 	// flex wrapper
 	queuePage.Root = tview.NewFlex().SetDirection(tview.FlexColumn).
 		AddItem(queuePage.queueList, 0, 2, true).
-		AddItem(infoFlex, 0, 1, false)
+		AddItem(infoFlex, 0, 1, false).
+		AddItem(queuePage.lyricsView, 0, 1, false)
 
 	// private data
 	queuePage.queueData = queueData{
 		starIdList: ui.starIdList,
+		ratings:    ui.ratings,
+		isOffline:  ui.connection.IsOffline,
 	}
 
 	return &queuePage
 }
 
 func (q *QueuePage) changeSelection(row, column int) {
-	q.songInfo.Clear()
 	if row >= len(q.queueData.playerQueue) || row < 0 || column < 0 {
+		q.songInfo.Clear()
 		q.coverArt.SetImage(STMPS_LOGO)
 		return
 	}
 	highlightedTrack := q.queueData.playerQueue[row]
 	art := STMPS_LOGO
 	if highlightedTrack.CoverArtId != "" {
-		if nart, err := q.ui.connection.GetCoverArt(highlightedTrack.CoverArtId); err == nil {
+		if nart, err := q.ui.connection.GetCoverArt(q.ui.ctx, highlightedTrack.CoverArtId, coverArtSize); err == nil {
 			if nart != nil {
 				art = nart
 			}
@@ -197,7 +221,95 @@ func (q *QueuePage) changeSelection(row, column int) {
 	if q.currentArt != art {
 		q.coverArt.SetImage(art)
 	}
-	_ = q.songInfoTemplate.Execute(q.songInfo, highlightedTrack)
+	q.showSongInfo(row)
+}
+
+// songInfoData is rendered by songInfoTemplate
+type songInfoData struct {
+	mpvplayer.QueueItem
+	// codec and bitrate, only known for the playing song
+	Stream string
+}
+
+// showSongInfo renders the song info of the queue entry at row.
+func (q *QueuePage) showSongInfo(row int) {
+	data := songInfoData{QueueItem: q.queueData.playerQueue[row]}
+	if row == q.queueData.currentIndex {
+		data.Stream = q.audioFormat
+	}
+	q.songInfo.Clear()
+	_ = q.songInfoTemplate.Execute(q.songInfo, data)
+}
+
+// setAudioFormat updates the codec and bitrate of the playing song, the
+// cover art isn't reloaded for it.
+func (q *QueuePage) setAudioFormat(codec string, bitrate int64) {
+	audioFormat := formatAudioFormat(codec, bitrate)
+	if audioFormat == q.audioFormat {
+		return
+	}
+	q.audioFormat = audioFormat
+
+	row, _ := q.queueList.GetSelection()
+	if row == q.queueData.currentIndex && row >= 0 && row < len(q.queueData.playerQueue) {
+		q.showSongInfo(row)
+	}
+}
+
+// loadLyrics fetches the lyrics of song in the background and shows them if
+// it's still playing by then.
+func (q *QueuePage) loadLyrics(song mpvplayer.QueueItem) {
+	var lyrics *service.StructuredLyrics
+	if song.Id != "" && !song.Live {
+		var err error
+		lyrics, err = q.ui.connection.GetLyrics(q.ui.ctx, song.Id, song.Artist, song.Title)
+		if err != nil {
+			q.logger.Error("error fetching lyrics for %s: %v", song.Title, err)
+		}
+	}
+
+	q.ui.app.QueueUpdateDraw(func() {
+		if current, err := q.ui.player.GetPlayingTrack(); err == nil && current.Id == song.Id {
+			q.setLyrics(lyrics)
+		}
+	})
+}
+
+func (q *QueuePage) setLyrics(lyrics *service.StructuredLyrics) {
+	q.lyrics = lyrics
+	q.lyricsLine = -1
+	q.lyricsView.Highlight()
+
+	if lyrics == nil {
+		q.lyricsView.SetText("[::d]no lyrics[::-]")
+		return
+	}
+	var text strings.Builder
+	for i, line := range lyrics.Lines {
+		// regions allow highlighting the line
+		fmt.Fprintf(&text, "[\"%d\"]%s[\"\"]\n", i, tview.Escape(line.Value))
+	}
+	q.lyricsView.SetText(text.String()).
+		ScrollToBeginning()
+}
+
+// updateLyrics highlights the line of synced lyrics sung at position
+// (seconds) and scrolls to it.
+func (q *QueuePage) updateLyrics(position int64) {
+	if q.lyrics == nil {
+		return
+	}
+	line := q.lyrics.LineAt(time.Duration(position) * time.Second)
+	if line == q.lyricsLine {
+		return
+	}
+	q.lyricsLine = line
+	if line < 0 {
+		q.lyricsView.Highlight()
+		return
+	}
+	q.lyricsView.Highlight(strconv.Itoa(line)).
+		ScrollToHighlight()
 }
 
 func (q *QueuePage) UpdateQueue() {
@@ -225,6 +337,23 @@ func (q *QueuePage) handleDeleteFromQueue() {
 	q.updateQueue()
 }
 
+// button handler
+func (q *QueuePage) handlePlaySelected() {
+	currentIndex, err := q.getSelectedItem()
+	if err != nil {
+		return
+	}
+
+	if err := q.ui.player.PlayQueueIndex(currentIndex); err != nil {
+		q.logger.Error("handlePlaySelected", err)
+		return
+	}
+	if err := q.ui.player.Play(); err != nil {
+		q.logger.Error("handlePlaySelected: Play", err)
+	}
+	q.updateQueue()
+}
+
 // button handler
 func (q *QueuePage) handleToggleStar() {
 	starIdList := q.queueData.starIdList
@@ -240,13 +369,17 @@ func (q *QueuePage) handleToggleStar() {
 		q.logger.Error("handleToggleStar", err)
 		return
 	}
+	if entity.Live {
+		// radio stations can't be starred
+		return
+	}
 
 	// If the song is already in the star list, remove it
 	_, remove := starIdList[entity.Id]
 
 	// update on server
-	if _, err = q.ui.connection.ToggleStar(entity.Id, starIdList); err != nil {
-		q.ui.showMessageBox("ToggleStar failed")
+	if _, err = q.ui.connection.ToggleStar(q.ui.ctx, service.StarItem, entity.Id, starIdList); err != nil {
+		q.ui.showError("Toggling the star", err)
 		return // fail, assume not toggled
 	}
 
@@ -257,6 +390,28 @@ func (q *QueuePage) handleToggleStar() {
 	}
 
 	q.ui.browserPage.UpdateStars()
+	q.ui.favoritesPage.UpdateStars()
+}
+
+func (q *QueuePage) handleSetRating(rating int) {
+	currentIndex, err := q.getSelectedItem()
+	if err != nil {
+		q.logger.Error("handleSetRating", err)
+		return
+	}
+
+	entity, err := q.ui.player.GetQueueItem(currentIndex)
+	if err != nil {
+		q.logger.Error("handleSetRating", err)
+		return
+	}
+	if entity.Live {
+		return
+	}
+
+	if q.ui.setRating(entity.Id, rating, entity.AlbumId) {
+		q.updateQueue()
+	}
 }
 
 // re-read queue data from mpvplayer which is the authoritative source for the queue
@@ -264,7 +419,7 @@ func (q *QueuePage) updateQueue() {
 	queueWasEmpty := len(q.queueData.playerQueue) == 0
 
 	// tell tview table to update its data
-	q.queueData.playerQueue = q.ui.player.GetQueueCopy()
+	q.queueData.playerQueue, q.queueData.currentIndex = q.ui.player.GetQueueCopy()
 	q.queueList.SetContent(&q.queueData)
 
 	// by default we're scrolled down after initially adding rows, fix this
@@ -277,7 +432,7 @@ func (q *QueuePage) updateQueue() {
 }
 
 // moveSongUp moves the currently selected song up in the queue
-// If the selected song isn't the third or higher, this is a NOP
+// If the selected song is the first one, this is a NOP
 // and no error is reported.
 func (q *QueuePage) moveSongUp() {
 	if len(q.queueData.playerQueue) == 0 {
@@ -294,11 +449,6 @@ func (q *QueuePage) moveSongUp() {
 		return
 	}
 
-	if currentIndex == 1 {
-		// An error here won't affect re-arranging the queue.
-		_ = q.ui.player.Stop()
-	}
-
 	// remove the item from the queue
 	q.ui.player.MoveSongUp(currentIndex)
 	q.queueList.Select(currentIndex-1, column)
@@ -320,11 +470,6 @@ func (q *QueuePage) moveSongDown() {
 		return
 	}
 
-	if currentIndex == 0 {
-		// An error here won't affect re-arranging the queue.
-		_ = q.ui.player.Stop()
-	}
-
 	if currentIndex > queueLen-2 {
 		q.logger.Debug("moveSongDown: can't move last song")
 		return
@@ -355,9 +500,12 @@ func (q *QueuePage) saveQueue(playlistName string) {
 	// a more complex diffing algorithm, and much more code.
 	// Consequently, this version of save() uses the more simple
 	// brute-force approach of always using createPlaylist().
-	songIds := make([]string, len(q.queueData.playerQueue))
-	for i, it := range q.queueData.playerQueue {
-		songIds[i] = it.Id
+	songIds := make([]string, 0, len(q.queueData.playerQueue))
+	for _, it := range q.queueData.playerQueue {
+		// playlists can't hold radio stations
+		if !it.Live {
+			songIds = append(songIds, it.Id)
+		}
 	}
 
 	var playlistId string
@@ -371,15 +519,13 @@ func (q *QueuePage) saveQueue(playlistName string) {
 	var err error
 	if playlistId == "" {
 		q.logger.Info("Saving %d items to playlist %s", len(q.queueData.playerQueue), playlistName)
-		response, err = q.ui.connection.CreatePlaylist("", playlistName, songIds)
+		response, err = q.ui.connection.CreatePlaylist(q.ui.ctx, "", playlistName, songIds)
 	} else {
 		q.logger.Info("Replacing playlist %s with %d", playlistId, len(q.queueData.playerQueue))
-		response, err = q.ui.connection.CreatePlaylist(playlistId, "", songIds)
+		response, err = q.ui.connection.CreatePlaylist(q.ui.ctx, playlistId, "", songIds)
 	}
 	if err != nil {
-		message := fmt.Sprintf("Error saving queue: %s", err)
-		q.ui.showMessageBox(message)
-		q.logger.Error(message)
+		q.ui.showError("Saving the queue", err)
 	} else {
 		if playlistId != "" {
 			for i, pl := range q.ui.playlists {
@@ -396,18 +542,14 @@ func (q *QueuePage) saveQueue(playlistName string) {
 	}
 }
 
-// shuffle randomly shuffles entries in the queue, updates it, and moves
-// the selected-item to the new first entry.
+// shuffle randomly shuffles the upcoming entries in the queue and updates it.
+// Played songs and the current song stay where they are.
 func (q *QueuePage) shuffle() {
 	if len(q.queueData.playerQueue) == 0 {
 		return
 	}
 
-	// An error here won't affect re-arranging the queue.
-	_ = q.ui.player.Stop()
 	q.ui.player.Shuffle()
-
-	q.queueList.Select(0, 0)
 	q.updateQueue()
 }
 
@@ -418,6 +560,15 @@ func (q *queueData) GetCell(row, column int) *tview.TableCell {
 	}
 	song := q.playerQueue[row]
 
+	// played songs are grayed out, the current one is highlighted
+	textColor := tcell.ColorDefault
+	attributes := tcell.AttrNone
+	if row < q.currentIndex {
+		textColor = tcell.ColorGray
+	} else if row == q.currentIndex {
+		attributes = tcell.AttrBold
+	}
+
 	switch column {
 	case 0: // star
 		text := " "
@@ -433,24 +584,58 @@ func (q *queueData) GetCell(row, column int) *tview.TableCell {
 			MaxWidth:    1,
 			Transparent: true,
 		}
-	case 1: // title
+	case 1: // offline
+		text := " "
+		if !song.Live && q.isOffline(song.Id) {
+			text = offlineIcon
+		}
+		return &tview.TableCell{
+			Text:        text,
+			Color:       tcell.ColorGreen,
+			Expansion:   0,
+			MaxWidth:    1,
+			Transparent: true,
+		}
+	case 2: // title
 		return &tview.TableCell{
 			Text:        tview.Escape(song.Title),
+			Color:       textColor,
+			Attributes:  attributes,
 			Expansion:   1,
 			Transparent: true,
 		}
-	case 2: // artist
+	case 3: // artist
 		return &tview.TableCell{
 			Text:        tview.Escape(song.Artist),
+			Color:       textColor,
+			Attributes:  attributes,
 			Expansion:   1,
 			Transparent: true,
 		}
-	case 3: // duration
+	case 4: // rating
+		rating, ok := q.ratings[song.Id]
+		if !ok {
+			rating = song.Rating
+		}
+		return &tview.TableCell{
+			Text:        ratingStars(rating),
+			Align:       tview.AlignRight,
+			Color:       tcell.ColorYellow,
+			Expansion:   0,
+			MaxWidth:    5,
+			Transparent: true,
+		}
+	case 5: // duration
 		min, sec := utils.IntSecondsToMinAndSec(song.Duration)
 		text := fmt.Sprintf("%3d:%02d", min, sec)
+		if song.Live {
+			text = "live"
+		}
 		return &tview.TableCell{
 			Text:        text,
 			Align:       tview.AlignRight,
+			Color:       textColor,
+			Attributes:  attributes,
 			Expansion:   0,
 			MaxWidth:    6,
 			Transparent: true,
@@ -474,7 +659,8 @@ var songInfoTemplateString = `[blue::b]Title:[-:-:-:-] [green::i]{{.Title}}[-:-:
 [blue::b]Artist:[-:-:-:-] [::i]{{.Artist}}[-:-:-:-]
 [blue::b]Album:[-:-:-:-] [::i]{{.GetAlbum}}[-:-:-:-]
 [blue::b]Disc:[-:-:-:-] [::i]{{.GetDiscNumber}}[-:-:-:-]  [blue::b]Track:[-:-:-:-] [::i]{{.GetTrackNumber}}[-:-:-:-]
-[blue::b]Year:[-:-:-:-] [::i]{{.GetYear}}[-:-:-:-]
+{{if .Stream}}[blue::b]Stream:[-:-:-:-] [::i]{{.Stream}}[-:-:-:-]
+{{end}}[blue::b]Year:[-:-:-:-] [::i]{{.GetYear}}[-:-:-:-]
 `
 
 //go:embed stmps_logo.png
@@ -0,0 +1,289 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package gui
+
+import (
+	"fmt"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"github.com/spezifisch/stmps/mpvplayer"
+	"github.com/spezifisch/stmps/service"
+	"github.com/spezifisch/stmps/utils"
+)
+
+// RadioPage lists the internet radio stations configured on the server.
+type RadioPage struct {
+	Root         *tview.Flex
+	StationModal tview.Primitive
+	DeleteModal  *tview.Modal
+
+	stationList   *tview.List
+	stationForm   *tview.Form
+	nameField     *tview.InputField
+	streamField   *tview.InputField
+	homePageField *tview.InputField
+
+	stations []service.InternetRadioStation
+	// ID of the station edited in the form, "" for a new one
+	editedId string
+	// the stations are loaded when the page is opened
+	opened bool
+
+	// external refs
+	ui     *Ui
+	logger utils.Logger
+}
+
+func (ui *Ui) createRadioPage() *RadioPage {
+	radioPage := RadioPage{
+		ui:     ui,
+		logger: ui.logger,
+	}
+
+	radioPage.stationList = tview.NewList().
+		ShowSecondaryText(false)
+	radioPage.stationList.Box.
+		SetTitle(" radio stations ").
+		SetTitleAlign(tview.AlignLeft).
+		SetBorder(true)
+
+	radioPage.Root = tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(radioPage.stationList, 0, 1, true)
+
+	radioPage.stationList.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch ui.keyBindings.Command(ContextRadio, event) {
+		case "playStation":
+			radioPage.handlePlayStation()
+			return nil
+		case "addToQueue":
+			radioPage.handleAddToQueue()
+			return nil
+		case "newStation":
+			radioPage.showForm(nil)
+			return nil
+		case "editStation":
+			if station := radioPage.selectedStation(); station != nil {
+				radioPage.showForm(station)
+			}
+			return nil
+		case "deleteStation":
+			radioPage.confirmDelete()
+			return nil
+		case "refresh":
+			radioPage.load()
+			return nil
+		}
+		return event
+	})
+
+	// form to add or edit a station
+	radioPage.nameField = tview.NewInputField().
+		SetLabel("Name: ").
+		SetFieldWidth(50)
+	radioPage.streamField = tview.NewInputField().
+		SetLabel("Stream URL: ").
+		SetFieldWidth(50)
+	radioPage.homePageField = tview.NewInputField().
+		SetLabel("Homepage URL: ").
+		SetFieldWidth(50)
+	radioPage.stationForm = tview.NewForm().
+		AddFormItem(radioPage.nameField).
+		AddFormItem(radioPage.streamField).
+		AddFormItem(radioPage.homePageField).
+		AddButton("Save", radioPage.saveForm).
+		AddButton("Cancel", radioPage.closeForm).
+		SetCancelFunc(radioPage.closeForm)
+	radioPage.stationForm.SetBorder(true)
+	radioPage.StationModal = makeModal(radioPage.stationForm, 70, 11)
+
+	// asks before deleting a station, see confirmDelete
+	radioPage.DeleteModal = tview.NewModal().
+		SetBackgroundColor(tcell.ColorBlack)
+
+	return &radioPage
+}
+
+// open loads the stations when the page is shown the first time.
+func (r *RadioPage) open() {
+	if !r.opened {
+		r.opened = true
+		r.load()
+	}
+}
+
+// load fetches the stations in the background.
+func (r *RadioPage) load() {
+	go func() {
+		response, err := r.ui.connection.GetInternetRadioStations(r.ui.ctx)
+		if err != nil {
+			if r.ui.ctx.Err() == nil {
+				r.ui.showError("Loading the radio stations", err)
+			}
+			return
+		}
+
+		r.ui.app.QueueUpdateDraw(func() {
+			r.setStations(response.InternetRadioStations.Stations)
+		})
+	}()
+}
+
+func (r *RadioPage) setStations(stations []service.InternetRadioStation) {
+	r.stations = stations
+
+	current := r.stationList.GetCurrentItem()
+	r.stationList.Clear()
+	for _, station := range stations {
+		r.stationList.AddItem(radioStationTextFormat(station), "", 0, nil)
+	}
+	if current < len(stations) {
+		r.stationList.SetCurrentItem(current)
+	}
+	r.stationList.Box.SetTitle(fmt.Sprintf(" radio stations (%d) ", len(stations)))
+}
+
+func (r *RadioPage) selectedStation() *service.InternetRadioStation {
+	index := r.stationList.GetCurrentItem()
+	if index < 0 || index >= len(r.stations) {
+		return nil
+	}
+	return &r.stations[index]
+}
+
+// handlePlayStation plays the selected station right away. It's inserted
+// after the current song, the rest of the queue is kept.
+func (r *RadioPage) handlePlayStation() {
+	station := r.selectedStation()
+	if station == nil {
+		return
+	}
+
+	queue, current := r.ui.player.GetQueueCopy()
+	index := min(current+1, len(queue))
+	if err := r.ui.player.InsertIntoQueue(index, newRadioQueueItem(*station)); err != nil {
+		r.logger.Error("handlePlayStation", err)
+		return
+	}
+	if err := r.ui.player.PlayQueueIndex(index); err != nil {
+		r.logger.Error("handlePlayStation", err)
+		return
+	}
+	if err := r.ui.player.Play(); err != nil {
+		r.logger.Error("handlePlayStation: Play", err)
+	}
+	r.ui.queuePage.UpdateQueue()
+}
+
+func (r *RadioPage) handleAddToQueue() {
+	station := r.selectedStation()
+	if station == nil {
+		return
+	}
+
+	item := newRadioQueueItem(*station)
+	r.ui.player.AddToQueue(&item)
+	r.ui.queuePage.UpdateQueue()
+
+	index := r.stationList.GetCurrentItem()
+	if index+1 < r.stationList.GetItemCount() {
+		r.stationList.SetCurrentItem(index + 1)
+	}
+}
+
+// showForm opens the station form, filled with station if it's edited.
+func (r *RadioPage) showForm(station *service.InternetRadioStation) {
+	if station == nil {
+		station = &service.InternetRadioStation{}
+		r.stationForm.SetTitle(" New radio station ")
+	} else {
+		r.stationForm.SetTitle(" Edit radio station ")
+	}
+	r.editedId = station.Id
+	r.nameField.SetText(station.Name)
+	r.streamField.SetText(station.StreamUrl)
+	r.homePageField.SetText(station.HomePageUrl)
+	r.stationForm.SetFocus(0)
+
+	r.ui.pages.ShowPage(PageRadioStation)
+	r.ui.pages.SendToFront(PageRadioStation)
+	r.ui.app.SetFocus(r.stationForm)
+}
+
+func (r *RadioPage) closeForm() {
+	r.ui.pages.HidePage(PageRadioStation)
+	r.ui.app.SetFocus(r.stationList)
+}
+
+func (r *RadioPage) saveForm() {
+	name := r.nameField.GetText()
+	streamUrl := r.streamField.GetText()
+	homePageUrl := r.homePageField.GetText()
+	if name == "" || streamUrl == "" {
+		r.stationForm.SetTitle(" Name and stream URL are required ")
+		return
+	}
+	r.closeForm()
+
+	var err error
+	if r.editedId == "" {
+		err = r.ui.connection.CreateInternetRadioStation(r.ui.ctx, name, streamUrl, homePageUrl)
+	} else {
+		err = r.ui.connection.UpdateInternetRadioStation(r.ui.ctx, r.editedId, name, streamUrl, homePageUrl)
+	}
+	if err != nil {
+		r.ui.showError("Saving the radio station", err)
+		return
+	}
+	r.load()
+}
+
+// confirmDelete asks whether to delete the selected station.
+func (r *RadioPage) confirmDelete() {
+	station := r.selectedStation()
+	if station == nil {
+		return
+	}
+	id := station.Id
+
+	r.DeleteModal.SetText(fmt.Sprintf("Delete the radio station %s?", station.Name)).
+		ClearButtons().
+		AddButtons([]string{"Delete", "Cancel"}).
+		SetDoneFunc(func(_ int, label string) {
+			r.ui.pages.HidePage(PageDeleteRadioStation)
+			r.ui.app.SetFocus(r.stationList)
+			if label == "Delete" {
+				r.deleteStation(id)
+			}
+		})
+	r.ui.pages.ShowPage(PageDeleteRadioStation)
+	r.ui.pages.SendToFront(PageDeleteRadioStation)
+	r.ui.app.SetFocus(r.DeleteModal)
+}
+
+func (r *RadioPage) deleteStation(id string) {
+	if err := r.ui.connection.DeleteInternetRadioStation(r.ui.ctx, id); err != nil {
+		r.ui.showError("Deleting the radio station", err)
+		return
+	}
+	r.load()
+}
+
+// newRadioQueueItem makes a live queue item playing station.
+func newRadioQueueItem(station service.InternetRadioStation) mpvplayer.QueueItem {
+	return mpvplayer.QueueItem{
+		Id:    station.Id,
+		Uri:   station.StreamUrl,
+		Title: station.Name,
+		Live:  true,
+	}
+}
+
+func radioStationTextFormat(station service.InternetRadioStation) string {
+	text := tview.Escape(station.Name)
+	if station.HomePageUrl != "" {
+		text += " [gray](" + tview.Escape(station.HomePageUrl) + ")"
+	}
+	return text
+}
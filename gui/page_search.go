@@ -4,6 +4,7 @@
 package gui
 
 import (
+	"context"
 	"fmt"
 	"sort"
 	"strings"
@@ -14,6 +15,13 @@ import (
 	"github.com/spezifisch/stmps/utils"
 )
 
+// searchQuery is a search started from the search field, its ctx is canceled
+// when the next one starts
+type searchQuery struct {
+	ctx   context.Context
+	query string
+}
+
 type SearchPage struct {
 	Root               *tview.Flex
 	AddToPlaylistModal tview.Primitive
@@ -29,6 +37,9 @@ type SearchPage struct {
 	albums  []*service.Album
 	songs   []*service.SubsonicEntity
 
+	// cancels the running search, only used on the ui goroutine
+	cancelSearch context.CancelFunc
+
 	// external refs
 	ui     *Ui
 	logger utils.Logger
@@ -89,17 +100,10 @@ func (ui *Ui) createSearchPage() *SearchPage {
 		case tcell.KeyRight:
 			ui.app.SetFocus(searchPage.albumList)
 			return nil
-		case tcell.KeyEnter:
-			if len(searchPage.artists) != 0 {
-				idx := searchPage.artistList.GetCurrentItem()
-				searchPage.addArtistToQueue(searchPage.artists[idx])
-				return nil
-			}
-			return event
 		}
 
-		switch event.Rune() {
-		case 'a':
+		switch ui.keyBindings.Command(ContextSearch, event) {
+		case "addToQueue":
 			if len(searchPage.artists) != 0 {
 				idx := searchPage.artistList.GetCurrentItem()
 				searchPage.logger.Info("artistList adding (%d) %s", idx, searchPage.artists[idx].Name)
@@ -107,7 +111,7 @@ func (ui *Ui) createSearchPage() *SearchPage {
 				return nil
 			}
 			return event
-		case '/':
+		case "focusSearch":
 			searchPage.ui.app.SetFocus(searchPage.searchField)
 			return nil
 		}
@@ -122,17 +126,13 @@ func (ui *Ui) createSearchPage() *SearchPage {
 		case tcell.KeyRight:
 			ui.app.SetFocus(searchPage.songList)
 			return nil
-		case tcell.KeyEnter:
-			if len(searchPage.albums) != 0 {
-				idx := searchPage.albumList.GetCurrentItem()
-				searchPage.addAlbumToQueue(searchPage.albums[idx])
-				return nil
-			}
-			return event
 		}
 
-		switch event.Rune() {
-		case 'a':
+		switch name := ui.keyBindings.Command(ContextSearch, event); name {
+		case "rate1", "rate2", "rate3", "rate4", "rate5", "clearRating":
+			searchPage.handleSetAlbumRating(ratingOf(name))
+			return nil
+		case "addToQueue":
 			if len(searchPage.albums) != 0 {
 				idx := searchPage.albumList.GetCurrentItem()
 				searchPage.logger.Info("albumList adding (%d) %s", idx, searchPage.albums[idx].Name)
@@ -140,7 +140,7 @@ func (ui *Ui) createSearchPage() *SearchPage {
 				return nil
 			}
 			return event
-		case '/':
+		case "focusSearch":
 			searchPage.ui.app.SetFocus(searchPage.searchField)
 			return nil
 		}
@@ -155,39 +155,40 @@ func (ui *Ui) createSearchPage() *SearchPage {
 		case tcell.KeyRight:
 			ui.app.SetFocus(searchPage.artistList)
 			return nil
-		case tcell.KeyEnter:
-			if len(searchPage.artists) != 0 {
-				idx := searchPage.songList.GetCurrentItem()
-				ui.addSongToQueue(searchPage.songs[idx])
-				ui.queuePage.UpdateQueue()
-				return nil
-			}
-			return event
 		}
 
-		switch event.Rune() {
-		case 'a':
-			if len(searchPage.artists) != 0 {
+		switch name := ui.keyBindings.Command(ContextSearch, event); name {
+		case "rate1", "rate2", "rate3", "rate4", "rate5", "clearRating":
+			searchPage.handleSetSongRating(ratingOf(name))
+			return nil
+		case "addToQueue":
+			if len(searchPage.songs) != 0 {
 				idx := searchPage.songList.GetCurrentItem()
 				ui.addSongToQueue(searchPage.songs[idx])
-				ui.queuePage.updateQueue()
+				ui.queuePage.UpdateQueue()
 				return nil
 			}
 			return event
-		case '/':
+		case "focusSearch":
 			searchPage.ui.app.SetFocus(searchPage.searchField)
 			return nil
 		}
 
 		return event
 	})
-	search := make(chan string, 5)
+	search := make(chan searchQuery, 5)
 	searchPage.searchField.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
 		switch event.Key() {
 		case tcell.KeyUp, tcell.KeyESC:
 			searchPage.aproposFocus()
 		case tcell.KeyEnter:
-			search <- ""
+			// results of the previous query are stale now
+			if searchPage.cancelSearch != nil {
+				searchPage.cancelSearch()
+			}
+			ctx, cancel := context.WithCancel(ui.ctx)
+			searchPage.cancelSearch = cancel
+
 			searchPage.artistList.Clear()
 			searchPage.artists = make([]*service.Artist, 0)
 			searchPage.albumList.Clear()
@@ -195,8 +196,7 @@ func (ui *Ui) createSearchPage() *SearchPage {
 			searchPage.songList.Clear()
 			searchPage.songs = make([]*service.SubsonicEntity, 0)
 
-			queryStr := searchPage.searchField.GetText()
-			search <- queryStr
+			search <- searchQuery{ctx, searchPage.searchField.GetText()}
 		default:
 			return event
 		}
@@ -207,31 +207,34 @@ func (ui *Ui) createSearchPage() *SearchPage {
 	return &searchPage
 }
 
-func (s *SearchPage) search(search chan string) {
-	var query string
+func (s *SearchPage) search(search chan searchQuery) {
+	var current searchQuery
 	var artOff, albOff, songOff int
 	more := make(chan bool, 5)
 	for {
-		// quit searching if we receive an interrupt
+		// a new query interrupts fetching more results of the previous one
 		select {
-		case query = <-search:
+		case current = <-search:
 			artOff = 0
 			albOff = 0
 			songOff = 0
-			s.logger.Info("searching for %q [%d, %d, %d]", query, artOff, albOff, songOff)
+			s.logger.Info("searching for %q [%d, %d, %d]", current.query, artOff, albOff, songOff)
 			for len(more) > 0 {
 				<-more
 			}
-			if query == "" {
+			if current.query == "" {
 				continue
 			}
 		case <-more:
-			s.logger.Info("fetching more %q [%d, %d, %d]", query, artOff, albOff, songOff)
+			s.logger.Info("fetching more %q [%d, %d, %d]", current.query, artOff, albOff, songOff)
 		}
-		res, err := s.ui.connection.Search(query, artOff, albOff, songOff)
+		ctx := current.ctx
+		res, err := s.ui.connection.Search(ctx, current.query, artOff, albOff, songOff)
 		if err != nil {
-			s.logger.Error("SearchPage.search", err)
-			return
+			if ctx.Err() == nil {
+				s.ui.showError("Searching", err)
+			}
+			continue
 		}
 		// Quit searching if there are no more results
 		if len(res.SearchResults.Artist) == 0 &&
@@ -240,8 +243,12 @@ func (s *SearchPage) search(search chan string) {
 			continue
 		}
 
-		query = strings.ToLower(query)
+		query := strings.ToLower(current.query)
 		s.ui.app.QueueUpdate(func() {
+			if ctx.Err() != nil {
+				// superseded by a new query
+				return
+			}
 			for _, artist := range res.SearchResults.Artist {
 				if strings.Contains(strings.ToLower(artist.Name), query) {
 					s.artistList.AddItem(tview.Escape(artist.Name), "", 0, nil)
@@ -251,14 +258,14 @@ func (s *SearchPage) search(search chan string) {
 			s.artistList.Box.SetTitle(fmt.Sprintf(" artist matches (%d) ", len(s.artists)))
 			for _, album := range res.SearchResults.Album {
 				if strings.Contains(strings.ToLower(album.Name), query) {
-					s.albumList.AddItem(tview.Escape(album.Name), "", 0, nil)
+					s.albumList.AddItem(s.albumText(&album), "", 0, nil)
 					s.albums = append(s.albums, &album)
 				}
 			}
 			s.albumList.Box.SetTitle(fmt.Sprintf(" album matches (%d) ", len(s.albums)))
 			for _, song := range res.SearchResults.Song {
 				if strings.Contains(strings.ToLower(song.Title), query) {
-					s.songList.AddItem(tview.Escape(song.Title), "", 0, nil)
+					s.songList.AddItem(s.songText(&song), "", 0, nil)
 					s.songs = append(s.songs, &song)
 				}
 			}
@@ -273,17 +280,17 @@ func (s *SearchPage) search(search chan string) {
 }
 
 func (s *SearchPage) addArtistToQueue(entity service.Ider) {
-	response, err := s.ui.connection.GetArtist(entity.ID())
+	response, err := s.ui.connection.GetArtist(s.ui.ctx, entity.ID())
 	if err != nil {
-		s.logger.Error("addArtistToQueue: GetArtist %s -- %s", entity.ID(), err)
+		s.ui.showError("Adding the artist to the queue", err)
 		return
 	}
 
 	artistId := response.Artist.Id
 	for _, album := range response.Artist.Album {
-		response, err = s.ui.connection.GetAlbum(album.Id)
+		response, err = s.ui.connection.GetAlbum(s.ui.ctx, album.Id)
 		if err != nil {
-			s.logger.Error("error getting album %s while adding artist to queue -- %s", album.Id, err)
+			s.ui.showError("Adding the artist to the queue", err)
 			return
 		}
 		sort.Sort(response.Album.Song)
@@ -313,9 +320,9 @@ func (s *SearchPage) addArtistToQueue(entity service.Ider) {
 }
 
 func (s *SearchPage) addAlbumToQueue(entity service.Ider) {
-	response, err := s.ui.connection.GetAlbum(entity.ID())
+	response, err := s.ui.connection.GetAlbum(s.ui.ctx, entity.ID())
 	if err != nil {
-		s.logger.Error("addToQueue: GetMusicDirectory %s -- %s", entity.ID(), err)
+		s.ui.showError("Adding the album to the queue", err)
 		return
 	}
 	sort.Sort(response.Album.Song)
@@ -325,6 +332,37 @@ func (s *SearchPage) addAlbumToQueue(entity service.Ider) {
 	s.ui.queuePage.UpdateQueue()
 }
 
+func (s *SearchPage) albumText(album *service.Album) string {
+	return tview.Escape(album.Name) + formatRating(s.ui.rating(album.Id, album.UserRating))
+}
+
+func (s *SearchPage) songText(song *service.SubsonicEntity) string {
+	return tview.Escape(song.Title) + formatRating(s.ui.rating(song.Id, song.UserRating))
+}
+
+func (s *SearchPage) handleSetAlbumRating(rating int) {
+	idx := s.albumList.GetCurrentItem()
+	if idx < 0 || idx >= len(s.albums) {
+		return
+	}
+	album := s.albums[idx]
+	if s.ui.setRating(album.Id, rating, album.ArtistId) {
+		s.albumList.SetItemText(idx, s.albumText(album), "")
+	}
+}
+
+func (s *SearchPage) handleSetSongRating(rating int) {
+	idx := s.songList.GetCurrentItem()
+	if idx < 0 || idx >= len(s.songs) {
+		return
+	}
+	song := s.songs[idx]
+	if s.ui.setRating(song.Id, rating, song.Parent, song.AlbumId) {
+		s.songList.SetItemText(idx, s.songText(song), "")
+		s.ui.queuePage.UpdateQueue()
+	}
+}
+
 func (s *SearchPage) aproposFocus() {
 	if len(s.artists) != 0 {
 		s.ui.app.SetFocus(s.artistList)
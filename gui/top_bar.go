@@ -6,14 +6,20 @@ import (
 	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
 	"github.com/spezifisch/stmps/consts"
+	"github.com/spezifisch/stmps/mpvplayer"
 	"github.com/spezifisch/stmps/utils"
 )
 
 type TopBar struct {
 	Row             *tview.Flex
 	startStopStatus *tview.TextView
+	profileStatus   *tview.TextView
+	repeatStatus    *tview.TextView
 	playerStatus    *tview.TextView
 
+	// a live stream is playing, it has no duration
+	live bool
+
 	// external refs
 	// ui     *Ui
 	logger utils.Logger
@@ -28,6 +34,16 @@ func InitTopBar(logger utils.Logger) *TopBar {
 		return action, nil
 	})
 
+	profileStatus := tview.NewTextView().
+		SetTextAlign(tview.AlignRight).
+		SetDynamicColors(true).
+		SetScrollable(false)
+
+	repeatStatus := tview.NewTextView().
+		SetTextAlign(tview.AlignRight).
+		SetDynamicColors(true).
+		SetScrollable(false)
+
 	playerStatus := tview.NewTextView().
 		SetTextAlign(tview.AlignRight).
 		SetDynamicColors(true).
@@ -35,11 +51,15 @@ func InitTopBar(logger utils.Logger) *TopBar {
 
 	row := tview.NewFlex().SetDirection(tview.FlexColumn).
 		AddItem(startStopStatus, 0, 1, false).
+		AddItem(profileStatus, 16, 0, false).
+		AddItem(repeatStatus, 20, 0, false).
 		AddItem(playerStatus, 20, 1, false)
 
 	ret := &TopBar{
 		Row:             row,
 		startStopStatus: startStopStatus,
+		profileStatus:   profileStatus,
+		repeatStatus:    repeatStatus,
 		playerStatus:    playerStatus,
 		logger:          logger,
 	}
@@ -55,6 +75,7 @@ func (t *TopBar) setActivityBase() {
 }
 
 func (t *TopBar) SetActivityStop() {
+	t.live = false
 	t.startStopStatus.SetText("[red::b]Stopped[::-]")
 }
 
@@ -68,6 +89,7 @@ func (t *TopBar) SetActivityPlaying(artist string, title string) {
 	title = tview.Escape(title)
 	artist = tview.Escape(artist)
 	text := fmt.Sprintf("[green::b]Playing[::-] [white]%s[::-] [gray]by[::-] [white]%s[::-]", title, artist)
+	t.live = false
 	t.startStopStatus.SetText(text)
 }
 
@@ -81,9 +103,47 @@ func (t *TopBar) SetActivityPause(artist string, title string) {
 	title = tview.Escape(title)
 	artist = tview.Escape(artist)
 	text := fmt.Sprintf("[yellow::b]Paused[::-] [white]%s[::-] [gray]by[::-] [white]%s[::-]", title, artist)
+	t.live = false
+	t.startStopStatus.SetText(text)
+}
+
+// SetActivityStream shows the live stream of station and the title it sent
+// last, if any
+func (t *TopBar) SetActivityStream(paused bool, station string, title string) {
+	activity := "[green::b]Playing[::-]"
+	if paused {
+		activity = "[yellow::b]Paused[::-]"
+	}
+	station = tview.Escape(station)
+	var text string
+	if title == "" {
+		text = fmt.Sprintf("%s [white]%s[::-]", activity, station)
+	} else {
+		text = fmt.Sprintf("%s [white]%s[::-] [gray]on[::-] [white]%s[::-]", activity, tview.Escape(title), station)
+	}
+	t.live = true
 	t.startStopStatus.SetText(text)
 }
 
+// SetRepeatMode shows the repeat mode, nothing if repeat is off
+func (t *TopBar) SetRepeatMode(mode mpvplayer.RepeatMode) {
+	if mode == mpvplayer.RepeatOff {
+		t.repeatStatus.SetText("")
+		return
+	}
+	t.repeatStatus.SetText(fmt.Sprintf("[::b][%s][::-]", mode))
+}
+
+// SetStreamProfile shows the name of the stream profile, nothing for the
+// original files
+func (t *TopBar) SetStreamProfile(profile utils.StreamProfile) {
+	if profile.Name == utils.OriginalStreamProfile.Name {
+		t.profileStatus.SetText("")
+		return
+	}
+	t.profileStatus.SetText(fmt.Sprintf("[::b][%s][::-]", tview.Escape(profile.Name)))
+}
+
 func (t *TopBar) SetPlayerState(volume int64, position int64, duration int64) {
 	position = max(position, 0)
 	duration = max(duration, 0)
@@ -91,6 +151,11 @@ func (t *TopBar) SetPlayerState(volume int64, position int64, duration int64) {
 	positionMin, positionSec := utils.SecondsToMinAndSec(position)
 	durationMin, durationSec := utils.SecondsToMinAndSec(duration)
 
-	text := fmt.Sprintf("[%d%%][::b][%02d:%02d/%02d:%02d]", volume, positionMin, positionSec, durationMin, durationSec)
+	var text string
+	if t.live {
+		text = fmt.Sprintf("[%d%%][::b][%02d:%02d/live]", volume, positionMin, positionSec)
+	} else {
+		text = fmt.Sprintf("[%d%%][::b][%02d:%02d/%02d:%02d]", volume, positionMin, positionSec, durationMin, durationSec)
+	}
 	t.playerStatus.SetText(text)
 }
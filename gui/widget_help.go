@@ -4,10 +4,7 @@
 package gui
 
 import (
-	"strings"
-
 	"github.com/rivo/tview"
-	"github.com/spezifisch/stmps/consts"
 )
 
 type HelpWidget struct {
@@ -47,28 +44,14 @@ func (ui *Ui) createHelpWidget() (m *HelpWidget) {
 	return
 }
 
-func (h *HelpWidget) RenderHelp(context string) {
-	leftText := "[::b]Playback[::-]\n" + tview.Escape(strings.TrimSpace(consts.HelpPlayback))
+func (h *HelpWidget) RenderHelp(page string) {
+	leftText := "[::b]Playback[::-]\n" + tview.Escape(h.ui.keyBindings.Help(ContextGlobal))
 	h.leftColumn.SetText(leftText)
 
+	// the log page has no bindings of its own
 	rightText := ""
-	switch context {
-	case PageBrowser:
-		rightText = "[::b]Browser[::-]\n" + tview.Escape(strings.TrimSpace(consts.HelpPageBrowser))
-
-	case PageQueue:
-		rightText = "[::b]Queue[::-]\n" + tview.Escape(strings.TrimSpace(consts.HelpPageQueue))
-
-	case PagePlaylists:
-		rightText = "[::b]Playlists[::-]\n" + tview.Escape(strings.TrimSpace(consts.HelpPagePlaylists))
-
-	case PageSearch:
-		rightText = "[::b]Search[::-]\n" + tview.Escape(strings.TrimSpace(consts.HelpSearchPage))
-
-	case PageLog:
-		fallthrough
-	default:
-		// no text
+	if context, ok := pageContexts[page]; ok {
+		rightText = "[::b]" + context + "[::-]\n" + tview.Escape(h.ui.keyBindings.Help(context))
 	}
 
 	h.rightColumn.SetText(rightText)
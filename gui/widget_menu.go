@@ -32,9 +32,31 @@ const (
 	PAGE_PLAYLISTS
 	PAGE_SEARCH
 	PAGE_LOG
+	PAGE_ALBUMS
+	PAGE_GENRES
+	PAGE_FAVORITES
+	PAGE_RADIO
+	PAGE_PODCASTS
+	PAGE_BOOKMARKS
 )
 
-var buttonOrder = []string{PageBrowser, PageQueue, PagePlaylists, PageSearch, PageLog}
+var buttonOrder = []string{PageBrowser, PageQueue, PagePlaylists, PageSearch, PageLog, PageAlbums, PageGenres, PageFavorites, PageRadio, PagePodcasts, PageBookmarks}
+
+// pageCommands are the global commands showing the pages, their keys label
+// the buttons
+var pageCommands = map[string]string{
+	PageBrowser:   "showBrowser",
+	PageQueue:     "showQueue",
+	PagePlaylists: "showPlaylists",
+	PageSearch:    "showSearch",
+	PageLog:       "showLog",
+	PageAlbums:    "showAlbums",
+	PageGenres:    "showGenres",
+	PageFavorites: "showFavorites",
+	PageRadio:     "showRadio",
+	PagePodcasts:  "showPodcasts",
+	PageBookmarks: "showBookmarks",
+}
 
 func (ui *Ui) createMenuWidget() (m *MenuWidget) {
 	m = &MenuWidget{
@@ -75,8 +97,8 @@ func (ui *Ui) createMenuWidget() (m *MenuWidget) {
 	m.buttonsRight.AddItem(quitButton, 9, 0, false)
 
 	m.Root = tview.NewFlex().SetDirection(tview.FlexColumn).
-		AddItem(m.buttonsLeft, 0, 4, false).
-		AddItem(m.buttonsRight, 0, 2, false)
+		AddItem(m.buttonsLeft, 0, 1, false).
+		AddItem(m.buttonsRight, 19, 0, false)
 
 	// clear background
 	m.Root.Box = tview.NewBox()
@@ -98,8 +120,9 @@ func (m *MenuWidget) createPageButtons() {
 		})
 
 		m.buttons[page] = button
-		// add button
-		m.buttonsLeft.AddItem(button, 15, 0, false)
+		// add button, with room for the playlist spinner
+		width := tview.TaggedStringWidth(m.buttonKey(page)+": "+page) + 2
+		m.buttonsLeft.AddItem(button, width, 0, false)
 
 		// add spacer
 		if i < len(buttonOrder)-1 {
@@ -108,13 +131,22 @@ func (m *MenuWidget) createPageButtons() {
 	}
 }
 
+// buttonKey returns the key showing page, "-" if it isn't bound.
+func (m *MenuWidget) buttonKey(page string) string {
+	keys := m.ui.keyBindings.Keys(ContextGlobal, pageCommands[page])
+	if len(keys) == 0 {
+		return "-"
+	}
+	return tview.Escape(keys[0])
+}
+
 func (m *MenuWidget) updatePageButtons() {
-	for i, page := range buttonOrder {
+	for _, page := range buttonOrder {
 		var text string
 		if page == m.activeButton {
-			text = fmt.Sprintf("%d: [::b]%s[::-]", i+1, page)
+			text = fmt.Sprintf("%s: [::b]%s[::-]", m.buttonKey(page), page)
 		} else {
-			text = fmt.Sprintf("%d: %s", i+1, page)
+			text = fmt.Sprintf("%s: %s", m.buttonKey(page), page)
 		}
 
 		m.buttons[page].SetLabel(text)
@@ -0,0 +1,106 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package gui
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/rivo/tview"
+	"github.com/spezifisch/stmps/service"
+)
+
+// ServerInfoWidget shows what the server supports, see
+// service.Capabilities.
+type ServerInfoWidget struct {
+	Root *tview.TextView
+
+	// visible reflects whether the modal is shown
+	visible bool
+
+	// external references
+	ui *Ui
+}
+
+// optionalFeatures are the features depending on OpenSubsonic extensions
+var optionalFeatures = []struct {
+	name      string
+	extension string
+}{
+	{"Synced lyrics", service.ExtensionSongLyrics},
+	{"Form POST requests", service.ExtensionFormPost},
+	{"Seeking in transcoded songs", service.ExtensionTranscodeOffset},
+	{"API key authentication", service.ExtensionAPIKeyAuth},
+}
+
+func (ui *Ui) createServerInfoWidget() (s *ServerInfoWidget) {
+	s = &ServerInfoWidget{
+		ui: ui,
+	}
+
+	s.Root = tview.NewTextView().
+		SetTextAlign(tview.AlignLeft).
+		SetDynamicColors(true)
+	s.Root.Box.SetBorder(true).SetTitle(" Server Info ")
+
+	return
+}
+
+func (s *ServerInfoWidget) Render() {
+	capabilities := s.ui.connection.Capabilities()
+
+	var text strings.Builder
+	line := func(name, value string) {
+		fmt.Fprintf(&text, "%-28s %s\n", name, tview.Escape(value))
+	}
+
+	text.WriteString("[::b]Server[::-]\n")
+	line("URL", s.ui.connection.Conf().Host)
+	if capabilities.ServerType != "" {
+		line("Type", strings.TrimSpace(capabilities.ServerType+" "+capabilities.ServerVersion))
+	}
+	if capabilities.APIVersion != "" {
+		line("API version", capabilities.APIVersion)
+	} else {
+		line("API version", "unknown, the server wasn't reachable on startup")
+	}
+	line("OpenSubsonic", yesNo(capabilities.OpenSubsonic))
+
+	text.WriteString("\n[::b]Features[::-]\n")
+	for _, feature := range optionalFeatures {
+		value := yesNo(capabilities.Supports(feature.extension))
+		if feature.extension == service.ExtensionAPIKeyAuth && s.ui.connection.UsesAPIKey() {
+			value = "in use"
+		}
+		line(feature.name, value)
+	}
+
+	if len(capabilities.Extensions) > 0 {
+		text.WriteString("\n[::b]Extensions[::-]\n")
+		names := make([]string, 0, len(capabilities.Extensions))
+		for name := range capabilities.Extensions {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		for _, name := range names {
+			versions := make([]string, len(capabilities.Extensions[name]))
+			for i, version := range capabilities.Extensions[name] {
+				versions[i] = strconv.Itoa(version)
+			}
+			line(name, "version "+strings.Join(versions, ", "))
+		}
+	}
+
+	s.Root.SetText(text.String())
+	s.Root.ScrollToBeginning()
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
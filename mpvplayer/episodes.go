@@ -0,0 +1,81 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package mpvplayer
+
+import (
+	"maps"
+	"sync"
+)
+
+// episodePositions remembers where podcast episodes were left, by the queue
+// item's Id, in seconds
+type episodePositions struct {
+	mu        sync.Mutex
+	positions map[string]int64
+}
+
+// EpisodePosition returns where the podcast episode with queue item ID id
+// resumes, 0 if it starts from the beginning.
+func (p *Player) EpisodePosition(id string) int64 {
+	p.episodes.mu.Lock()
+	defer p.episodes.mu.Unlock()
+	return p.episodes.positions[id]
+}
+
+// EpisodePositions returns a copy of all remembered episode positions.
+func (p *Player) EpisodePositions() map[string]int64 {
+	p.episodes.mu.Lock()
+	defer p.episodes.mu.Unlock()
+	return maps.Clone(p.episodes.positions)
+}
+
+// SetEpisodePositions replaces the remembered episode positions, e.g. with
+// the ones of a saved state.
+func (p *Player) SetEpisodePositions(positions map[string]int64) {
+	p.episodes.mu.Lock()
+	defer p.episodes.mu.Unlock()
+	p.episodes.positions = maps.Clone(positions)
+}
+
+// rememberEpisodePosition stores position if the current item is a podcast
+// episode. It's forgotten once the episode is finished, see ResumeFrom.
+func (p *Player) rememberEpisodePosition(position int64) {
+	if p.replaceInProgress.Load() {
+		// the position may still be the one of the previous item
+		return
+	}
+	current, ok := p.queue.Current()
+	if !ok || !current.Podcast {
+		return
+	}
+	duration := int64(current.Duration)
+	if duration <= 0 {
+		duration = p.State.Duration
+	}
+	resume, finished := ResumeFrom(position, duration)
+	if !resume && !finished {
+		return
+	}
+
+	p.episodes.mu.Lock()
+	defer p.episodes.mu.Unlock()
+	if finished {
+		delete(p.episodes.positions, current.Id)
+		return
+	}
+	if p.episodes.positions == nil {
+		p.episodes.positions = map[string]int64{}
+	}
+	p.episodes.positions[current.Id] = position
+}
+
+// resumePosition returns where the current item starts if it's a podcast
+// episode that was left before.
+func (p *Player) resumePosition() int64 {
+	current, ok := p.queue.Current()
+	if !ok || !current.Podcast {
+		return 0
+	}
+	return p.EpisodePosition(current.Id)
+}
@@ -0,0 +1,53 @@
+package mpvplayer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEpisodePositions(t *testing.T) {
+	var p Player
+	p.queue.Append(
+		QueueItem{Id: "st-1", Duration: 600, Podcast: true},
+		QueueItem{Id: "so-1", Duration: 600},
+	)
+	require.NoError(t, p.queue.SetCurrent(0))
+
+	p.rememberEpisodePosition(5)
+	assert.Zero(t, p.EpisodePosition("st-1"), "positions right after loading are ignored")
+	p.rememberEpisodePosition(120)
+	assert.Equal(t, int64(120), p.EpisodePosition("st-1"))
+	assert.Equal(t, int64(120), p.resumePosition())
+
+	// finished episodes start over
+	p.rememberEpisodePosition(590)
+	assert.Zero(t, p.EpisodePosition("st-1"))
+
+	p.SetEpisodePositions(map[string]int64{"st-1": 300})
+	require.NoError(t, p.queue.SetCurrent(1))
+	p.rememberEpisodePosition(120)
+	assert.Zero(t, p.resumePosition(), "songs don't resume")
+	assert.Equal(t, map[string]int64{"st-1": 300}, p.EpisodePositions())
+}
+
+func TestResumeFrom(t *testing.T) {
+	testCases := []struct {
+		name               string
+		position, duration int64
+		resume, finished   bool
+	}{
+		{"too early", 5, 600, false, false},
+		{"middle", 120, 600, true, false},
+		{"near the end", 590, 600, false, true},
+		{"unknown duration", 5000, 0, true, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resume, finished := ResumeFrom(tc.position, tc.duration)
+			assert.Equal(t, tc.resume, resume)
+			assert.Equal(t, tc.finished, finished)
+		})
+	}
+}
@@ -28,6 +28,9 @@ func (p *Player) EventLoop() {
 	if err := p.instance.ObserveProperty(0, string(Volume), mpv.FORMAT_INT64); err != nil {
 		p.logger.Error("Observe3", err)
 	}
+	if err := p.instance.ObserveProperty(0, string(IcyTitle), mpv.FORMAT_STRING); err != nil {
+		p.logger.Error("Observe4", err)
+	}
 
 	for evt := range p.mpvEvents {
 		if evt == nil {
@@ -41,56 +44,93 @@ func (p *Player) EventLoop() {
 			propChangeEvent := (*C.struct_mpv_event_property)(evt.Data)
 			name := Property(C.GoString((*C.char)(propChangeEvent.name)))
 
+			if name == IcyTitle {
+				// unavailable once the stream ends or for songs
+				title := ""
+				if mpv.Format(propChangeEvent.format) != mpv.FORMAT_NONE {
+					title, _ = p.getPropertyString(IcyTitle)
+				}
+				if title != p.GetStreamTitle() {
+					p.streamTitle.Store(title)
+					p.sendGuiDataEvent(EventStreamTitle, title)
+				}
+				continue
+			}
 			if mpv.Format(propChangeEvent.format) == mpv.FORMAT_NONE {
+				if name == Duration {
+					// live streams have none
+					p.State.Duration = 0
+				}
 				continue
 			}
 			if name == PlaybackTime {
-				position := p.getPlayerStateProperty(evt.Event_Id, PlaybackTime)
+				position := p.getPlayerStateProperty(evt.Event_Id, PlaybackTime) + p.streamOffset.Load()
 				p.State.Position = position
 				p.remoteState.timePos = float64(position)
+				p.rememberEpisodePosition(position)
 			} else if name == Duration {
 				duration := p.getPlayerStateProperty(evt.Event_Id, Duration)
+				if duration > 0 {
+					// streams starting at an offset only last the rest of the song
+					duration += p.streamOffset.Load()
+				}
 				p.State.Duration = duration
 			} else if name == Volume {
 				volume := p.getPlayerStateProperty(evt.Event_Id, Volume)
 				p.State.Volume = volume
 			}
 			p.sendGuiDataEvent(EventStatus, StatusUpdate{})
-		} else if evt.Event_Id == mpv.EVENT_END_FILE && !p.replaceInProgress {
+		} else if evt.Event_Id == mpv.EVENT_END_FILE && !p.replaceInProgress.Load() {
 			// we don't want to update anything if we're in the process of replacing the current track
 
-			if p.stopped {
+			if p.stopped.Load() {
 				// this is feedback for a user-requested stop
 				// don't delete the first track so it gets started from the beginning when pressing play
 				p.logger.Info("mpv.EventLoop: mpv stopped")
-				p.stopped = true
+				p.stopped.Store(true)
 				p.sendGuiEvent(EventStopped)
-			} else {
-				// advance queue and play next track
-				if len(p.queue) > 0 {
-					p.queue = p.queue[1:]
+			} else if mode := p.GetRepeatMode(); mode == RepeatOne {
+				// play the same track again, mpv already has it appended
+				if current, ok := p.queue.Current(); ok && !p.nextQueued.Load() {
+					if err := p.instance.Command([]string{"loadfile", current.Uri}); err != nil {
+						p.logger.Error("mpv.EventLoop: load current", err)
+					}
 				}
-
-				if len(p.queue) > 0 {
-					if err := p.instance.Command([]string{"loadfile", p.queue[0].Uri}); err != nil {
-						p.logger.Error("mpv.EventLoop: load next", err)
+			} else if mode == StopAfterCurrent {
+				// advance queue so play continues with the next track, but stop for now
+				p.logger.Info("mpv.EventLoop: stopping after current")
+				p.queue.Skip(1, false)
+				p.SetRepeatMode(RepeatOff)
+				p.stopped.Store(true)
+				p.sendGuiEvent(EventStopped)
+			} else {
+				// advance queue, mpv continues with the appended next track
+				if next, ok := p.advance(1); ok {
+					if !p.nextQueued.Load() {
+						if err := p.instance.Command([]string{"loadfile", next.Uri}); err != nil {
+							p.logger.Error("mpv.EventLoop: load next", err)
+						}
 					}
 				} else {
 					// no remaining tracks
 					p.logger.Info("mpv.EventLoop: stopping (auto)")
-					p.stopped = true
+					p.stopped.Store(true)
 					p.sendGuiEvent(EventStopped)
 				}
 			}
 		} else if evt.Event_Id == mpv.EVENT_START_FILE {
-			p.replaceInProgress = false
-			p.stopped = false
-
-			currentSong := QueueItem{}
-			if len(p.queue) > 0 {
-				currentSong = p.queue[0]
+			p.replaceInProgress.Store(false)
+			p.stopped.Store(false)
+			p.streamOffset.Store(p.pendingOffset.Swap(0))
+			p.syncNext()
+			p.applyReplayGain()
+			if p.offsetReload.Swap(false) {
+				// it's the same song, seeked in
+				continue
 			}
 
+			currentSong, _ := p.queue.Current()
+
 			if paused, err := p.IsPaused(); err != nil {
 				p.logger.Error("mpv.EventLoop: IsPaused", err)
 			} else if !paused {
@@ -98,6 +138,17 @@ func (p *Player) EventLoop() {
 			} else {
 				p.sendGuiDataEvent(EventPaused, currentSong)
 			}
+		} else if evt.Event_Id == mpv.EVENT_FILE_LOADED {
+			position := p.pendingSeek.Swap(0)
+			if position == 0 && p.streamOffset.Load() == 0 {
+				// streams starting at an offset were loaded to resume
+				position = p.resumePosition()
+			}
+			if position > 0 {
+				if err := p.SeekAbsolute(int(position)); err != nil {
+					p.logger.Error("mpv.EventLoop: seek to restored position", err)
+				}
+			}
 		} else if evt.Event_Id == mpv.EVENT_IDLE || evt.Event_Id == mpv.EVENT_NONE {
 			continue
 		} else {
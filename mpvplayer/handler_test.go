@@ -0,0 +1,217 @@
+package mpvplayer
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/spezifisch/stmps/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/supersonic-app/go-mpv"
+)
+
+// fakeMpv records the commands sent to it and tracks whether a file is
+// loaded and paused.
+type fakeMpv struct {
+	mu       sync.Mutex
+	idle     bool
+	paused   bool
+	commands [][]string
+}
+
+func (m *fakeMpv) Command(command []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.commands = append(m.commands, command)
+	switch {
+	case command[0] == "stop":
+		m.idle = true
+	case command[0] == "loadfile" && len(command) == 2:
+		m.idle = false
+	}
+	return nil
+}
+
+func (m *fakeMpv) SetProperty(name string, format mpv.Format, data interface{}) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if Property(name) == Pause {
+		m.paused = data.(bool)
+	}
+	return nil
+}
+
+func (m *fakeMpv) GetProperty(name string, format mpv.Format) (interface{}, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch Property(name) {
+	case IdleActive:
+		return m.idle, nil
+	case Pause:
+		return m.paused, nil
+	default:
+		return nil, errors.New("property unavailable")
+	}
+}
+
+func (m *fakeMpv) ObserveProperty(replyUserdata uint64, name string, format mpv.Format) error {
+	return nil
+}
+
+func (m *fakeMpv) TerminateDestroy() {}
+
+// loaded returns the URIs of the files loaded to be played.
+func (m *fakeMpv) loaded() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var uris []string
+	for _, command := range m.commands {
+		if command[0] == "loadfile" && len(command) == 2 {
+			uris = append(uris, command[1])
+		}
+	}
+	return uris
+}
+
+type eventRecorder struct {
+	mu     sync.Mutex
+	events []UiEvent
+}
+
+func (r *eventRecorder) SendEvent(event UiEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+// playing returns the IDs of the songs EventPlaying was sent for.
+func (r *eventRecorder) playing() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var ids []string
+	for _, event := range r.events {
+		if event.Type == EventPlaying {
+			ids = append(ids, event.Data.(QueueItem).Id)
+		}
+	}
+	return ids
+}
+
+// newTestPlayer returns a player on a fake mpv with its event loop running.
+func newTestPlayer(t *testing.T) (*Player, *fakeMpv, *eventRecorder) {
+	logger := utils.InitLogger(utils.Fatal)
+	instance := &fakeMpv{idle: true}
+	events := &eventRecorder{}
+	p := &Player{
+		instance:      instance,
+		mpvEvents:     make(chan *mpv.Event),
+		eventConsumer: events,
+		logger:        &logger,
+	}
+	p.stopped.Store(true)
+
+	done := make(chan struct{})
+	go func() {
+		p.EventLoop()
+		close(done)
+	}()
+	t.Cleanup(func() {
+		p.mpvEvents <- nil
+		<-done
+	})
+	return p, instance, events
+}
+
+// sendEvents hands events to the event loop and waits until it handled them.
+func sendEvents(p *Player, ids ...mpv.EventId) {
+	for _, id := range ids {
+		p.mpvEvents <- &mpv.Event{Event_Id: id}
+	}
+	// received once the previous ones are handled
+	p.mpvEvents <- &mpv.Event{Event_Id: mpv.EVENT_NONE}
+}
+
+func streams(ids ...string) PlayerQueue {
+	items := makeItems(ids...)
+	for i := range items {
+		items[i].Uri = "stream/" + items[i].Id
+	}
+	return items
+}
+
+// run with -race
+func TestPlayerConcurrentControl(t *testing.T) {
+	p, instance, _ := newTestPlayer(t)
+	require.NoError(t, p.LoadQueue(streams("a", "b", "c"), 0, 0, false))
+	sendEvents(p, mpv.EVENT_START_FILE)
+
+	// gui side controls
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			assert.NoError(t, p.PlayQueueIndex(i%3))
+			assert.NoError(t, p.Pause())
+			if i%10 == 0 {
+				assert.NoError(t, p.Stop())
+			}
+		}
+	}()
+
+	// mpv switching files
+	for i := 0; i < 100; i++ {
+		sendEvents(p, mpv.EVENT_END_FILE, mpv.EVENT_START_FILE)
+	}
+	wg.Wait()
+	assert.True(t, slices.Contains(instance.loaded(), "stream/c"))
+}
+
+func TestLoadQueueWhilePlaying(t *testing.T) {
+	p, instance, events := newTestPlayer(t)
+	require.NoError(t, p.LoadQueue(streams("a", "b"), 0, 0, false))
+	sendEvents(p, mpv.EVENT_START_FILE)
+
+	// the replaced song ends before the new one starts
+	require.NoError(t, p.LoadQueue(streams("c", "d", "e"), 1, 0, false))
+	sendEvents(p, mpv.EVENT_END_FILE, mpv.EVENT_START_FILE)
+
+	assert.Equal(t, 1, p.queue.CurrentIndex())
+	assert.Equal(t, []string{"stream/a", "stream/d"}, instance.loaded())
+	assert.Equal(t, []string{"a", "d"}, events.playing())
+}
+
+func TestPlayPreviousTrackAfterQueueEnded(t *testing.T) {
+	p, instance, events := newTestPlayer(t)
+	require.NoError(t, p.LoadQueue(streams("a", "b"), 1, 0, false))
+	sendEvents(p, mpv.EVENT_START_FILE)
+
+	// the last song ends
+	require.NoError(t, instance.Command([]string{"stop"}))
+	sendEvents(p, mpv.EVENT_END_FILE)
+	require.Equal(t, 2, p.queue.CurrentIndex())
+	require.True(t, p.stopped.Load())
+
+	require.NoError(t, p.PlayPreviousTrack())
+	sendEvents(p, mpv.EVENT_START_FILE)
+	assert.Equal(t, 1, p.queue.CurrentIndex())
+	assert.Equal(t, []string{"stream/b", "stream/b"}, instance.loaded())
+	assert.Equal(t, []string{"b", "b"}, events.playing())
+}
+
+// playing all favorites replaces the queue and starts at its first song
+func TestLoadQueueFromStartWhilePlaying(t *testing.T) {
+	p, instance, events := newTestPlayer(t)
+	require.NoError(t, p.LoadQueue(streams("a", "b"), 1, 0, false))
+	sendEvents(p, mpv.EVENT_START_FILE)
+
+	for _, items := range []PlayerQueue{streams("c", "d"), streams("d", "c")} {
+		require.NoError(t, p.LoadQueue(items, 0, 0, false))
+		sendEvents(p, mpv.EVENT_END_FILE, mpv.EVENT_START_FILE)
+		assert.Equal(t, 0, p.queue.CurrentIndex())
+	}
+	assert.Equal(t, []string{"stream/b", "stream/c", "stream/d"}, instance.loaded())
+	assert.Equal(t, []string{"b", "c", "d"}, events.playing())
+}
@@ -27,6 +27,16 @@ func (p *Player) getPropertyInt64(name Property) (int64, error) {
 	return value.(int64), err
 }
 
+func (p *Player) getPropertyString(name Property) (string, error) {
+	value, err := p.instance.GetProperty(string(name), mpv.FORMAT_STRING)
+	if err != nil {
+		return "", err
+	} else if value == nil {
+		return "", errors.New("nil value")
+	}
+	return value.(string), err
+}
+
 func (p *Player) getPropertyBool(name Property) (bool, error) {
 	value, err := p.instance.GetProperty(string(name), mpv.FORMAT_FLAG)
 	if err != nil {
@@ -15,6 +15,11 @@ const (
 	EventPaused
 	// UI status update, data: StatusUpdate
 	EventStatus
+	// repeat mode changed, data: RepeatMode
+	EventRepeatMode
+	// title sent by a live stream changed, data: string, empty if there is
+	// none
+	EventStreamTitle
 )
 
 type UiEvent struct {
@@ -5,25 +5,52 @@ package mpvplayer
 
 import (
 	"errors"
-	"math/rand"
 	"strconv"
+	"sync/atomic"
 
 	"github.com/spezifisch/stmps/remote"
 	"github.com/spezifisch/stmps/utils"
 	"github.com/supersonic-app/go-mpv"
 )
 
-type PlayerQueue []QueueItem
+// mpvInstance is the part of the mpv client the player uses.
+type mpvInstance interface {
+	Command(command []string) error
+	SetProperty(name string, format mpv.Format, data interface{}) error
+	GetProperty(name string, format mpv.Format) (interface{}, error)
+	ObserveProperty(replyUserdata uint64, name string, format mpv.Format) error
+	TerminateDestroy()
+}
 
 type Player struct {
-	instance      *mpv.Mpv
+	instance      mpvInstance
 	mpvEvents     chan *mpv.Event
 	eventConsumer EventConsumer
-	queue         PlayerQueue
+	queue         queue
 	logger        utils.Logger
 
-	replaceInProgress bool
-	stopped           bool
+	// set by the gui and the event loop
+	replaceInProgress atomic.Bool
+	stopped           atomic.Bool
+	// position to seek to once the next file is loaded, see RestoreState
+	pendingSeek atomic.Int64
+	repeatMode  atomic.Int32
+	// whether the next song is appended to mpv's playlist, see syncNext
+	nextQueued atomic.Bool
+	// ReplayGainMode
+	replayGainMode atomic.Value
+	// string, see GetStreamTitle
+	streamTitle atomic.Value
+	// func(QueueItem, int64) string, see SetOffsetUri
+	offsetUri atomic.Value
+	// seconds into the song the loaded stream starts at, and the offset of
+	// the stream being loaded
+	streamOffset  atomic.Int64
+	pendingOffset atomic.Int64
+	// the file being loaded is the current song at another offset
+	offsetReload atomic.Bool
+	// see EpisodePosition
+	episodes episodePositions
 
 	State struct {
 		Volume   int64
@@ -58,14 +85,12 @@ func NewPlayer(logger utils.Logger, options map[string]string) (player *Player,
 		return
 	}
 	player = &Player{
-		instance:          m,
-		mpvEvents:         make(chan *mpv.Event),
-		eventConsumer:     nil, // must be set by calling RegisterEventConsumer()
-		queue:             make([]QueueItem, 0),
-		logger:            logger,
-		replaceInProgress: false,
-		stopped:           true,
+		instance:      m,
+		mpvEvents:     make(chan *mpv.Event),
+		eventConsumer: nil, // must be set by calling RegisterEventConsumer()
+		logger:        logger,
 	}
+	player.stopped.Store(true)
 
 	go player.mpvEngineEventHandler(m)
 	return
@@ -87,40 +112,144 @@ func (p *Player) RegisterEventConsumer(consumer EventConsumer) {
 	p.eventConsumer = consumer
 }
 
+// songs that have played longer than this restart instead of going back to
+// the previous song
+const previousTrackRestartSeconds = 3
+
 func (p *Player) PlayNextTrack() error {
-	if len(p.queue) >= 1 {
-		// advance queue if any tracks left
-		p.queue = p.queue[1:]
-
-		if len(p.queue) > 0 {
-			// replace currently playing song with next song
-			if loaded, err := p.IsSongLoaded(); err != nil {
-				p.logger.Error("PlayNextTrack", err)
-			} else if loaded {
-				p.replaceInProgress = true
-				if err := p.temporaryStop(); err != nil {
-					p.logger.Error("temporaryStop", err)
-				}
-				return p.instance.Command([]string{"loadfile", p.queue[0].Uri})
-			}
-		} else {
-			// stop with empty queue
-			if err := p.Stop(); err != nil {
-				p.logger.Error("Stop", err)
-			}
+	return p.skip(1)
+}
+
+// PlayQueueIndex makes the queue item at index the current song.
+func (p *Player) PlayQueueIndex(index int) error {
+	if err := p.queue.SetCurrent(index); err != nil {
+		return err
+	}
+	next, _ := p.queue.Current()
+	return p.replaceCurrent(next)
+}
+
+// PlayQueueIndexAt plays the song at index from position seconds on.
+func (p *Player) PlayQueueIndexAt(index int, position int64) error {
+	p.pendingSeek.Store(position)
+	if err := p.PlayQueueIndex(index); err != nil {
+		p.pendingSeek.Store(0)
+		return err
+	}
+	return nil
+}
+
+// PlayPreviousTrack restarts the current song if it has been playing for a
+// while, otherwise it goes back to the previous song. If no song is loaded,
+// e.g. after the queue ran out, the previous song starts playing.
+func (p *Player) PlayPreviousTrack() error {
+	loaded, err := p.IsSongLoaded()
+	if err != nil {
+		return err
+	}
+
+	atStart := p.queue.CurrentIndex() == 0 && p.GetRepeatMode() != RepeatAll
+	if loaded && (atStart || p.GetTimePos() > previousTrackRestartSeconds) {
+		return p.SeekAbsolute(0)
+	} else if atStart {
+		return nil
+	}
+	if !loaded {
+		if _, ok := p.advance(-1); !ok {
+			return nil
 		}
-	} else {
-		// queue empty
+		return p.Play()
+	}
+	return p.skip(-1)
+}
+
+// advance moves the cursor by count songs and returns the new current song.
+// With RepeatAll it wraps around at the ends of the queue.
+func (p *Player) advance(count int) (QueueItem, bool) {
+	return p.queue.Skip(count, p.GetRepeatMode() == RepeatAll)
+}
+
+// skip moves the cursor by count songs and plays the new current song, if
+// a song was loaded. It stops at the end of the queue.
+func (p *Player) skip(count int) error {
+	next, ok := p.advance(count)
+	if !ok {
+		// stop at the end of the queue
 		if err := p.Stop(); err != nil {
 			p.logger.Error("Stop", err)
 		}
+		return nil
+	}
+	return p.replaceCurrent(next)
+}
+
+// replaceCurrent replaces the currently playing song with next, if a song
+// was loaded.
+func (p *Player) replaceCurrent(next QueueItem) error {
+	if loaded, err := p.IsSongLoaded(); err != nil {
+		p.logger.Error("IsSongLoaded", err)
+	} else if loaded {
+		p.replaceInProgress.Store(true)
+		if err := p.temporaryStop(); err != nil {
+			p.logger.Error("temporaryStop", err)
+		}
+		return p.instance.Command([]string{"loadfile", next.Uri})
 	}
 	return nil
 }
 
+// upcoming returns the song to play after the current one ends, according to
+// the repeat mode.
+func (p *Player) upcoming() (QueueItem, bool) {
+	switch p.GetRepeatMode() {
+	case RepeatOne:
+		return p.queue.Current()
+	case StopAfterCurrent:
+		return QueueItem{}, false
+	case RepeatAll:
+		return p.queue.Peek(1, true)
+	default:
+		return p.queue.Peek(1, false)
+	}
+}
+
+// syncNext makes the upcoming song the only entry after the current one in
+// mpv's playlist, so mpv can prefetch it and switch to it without a gap. It
+// has to be called whenever the queue or the repeat mode change.
+func (p *Player) syncNext() {
+	if loaded, err := p.IsSongLoaded(); err != nil || !loaded {
+		return
+	}
+
+	// removes everything but the current song
+	if err := p.instance.Command([]string{"playlist-clear"}); err != nil {
+		p.logger.Error("syncNext: playlist-clear", err)
+		return
+	}
+
+	next, ok := p.upcoming()
+	if ok {
+		if err := p.instance.Command([]string{"loadfile", next.Uri, "append"}); err != nil {
+			p.logger.Error("syncNext: append", err)
+			ok = false
+		}
+	}
+	p.nextQueued.Store(ok)
+}
+
 func (p *Player) PlayUri(id, uri, title, artist, album string, duration, track, disc int, coverArtId string) error {
-	p.queue = []QueueItem{{id, uri, title, artist, duration, album, track, coverArtId, disc}}
-	p.replaceInProgress = true
+	p.queue.Replace(PlayerQueue{{
+		Id:          id,
+		Uri:         uri,
+		Title:       title,
+		Artist:      artist,
+		Duration:    duration,
+		Album:       album,
+		TrackNumber: track,
+		CoverArtId:  coverArtId,
+		DiscNumber:  disc,
+	}})
+	p.replaceInProgress.Store(true)
 	if ip, e := p.IsPaused(); ip && e == nil {
 		if err := p.Pause(); err != nil {
 			p.logger.Error("Pause", err)
@@ -131,7 +260,7 @@ func (p *Player) PlayUri(id, uri, title, artist, album string, duration, track,
 
 func (p *Player) Stop() error {
 	p.logger.Info("stopping (user)")
-	p.stopped = true
+	p.stopped.Store(true)
 	return p.instance.Command([]string{"stop"})
 }
 
@@ -177,7 +306,7 @@ func (p *Player) Pause() (err error) {
 		return
 	}
 
-	if loaded && !p.stopped {
+	if loaded && !p.stopped.Load() {
 		// toggle pause if not stopped
 		err = p.instance.Command([]string{"cycle", "pause"})
 		if err != nil {
@@ -186,10 +315,7 @@ func (p *Player) Pause() (err error) {
 		}
 		paused = !paused
 
-		currentSong := QueueItem{}
-		if len(p.queue) > 0 {
-			currentSong = p.queue[0]
-		}
+		currentSong, _ := p.queue.Current()
 
 		if paused {
 			p.sendGuiDataEvent(EventPaused, currentSong)
@@ -197,16 +323,15 @@ func (p *Player) Pause() (err error) {
 			p.sendGuiDataEvent(EventUnpaused, currentSong)
 		}
 	} else {
-		if len(p.queue) > 0 {
-			currentSong := p.queue[0]
+		if currentSong, ok := p.queue.Current(); ok {
 			err = p.instance.Command([]string{"loadfile", currentSong.Uri})
 			if err != nil {
 				p.logger.Error("loadfile", err)
 				return
 			}
 
-			if p.stopped {
-				p.stopped = false
+			if p.stopped.Load() {
+				p.stopped.Store(false)
 				if err = p.instance.SetProperty("pause", mpv.FORMAT_FLAG, false); err != nil {
 					p.logger.Error("setprop pause", err)
 				}
@@ -217,7 +342,7 @@ func (p *Player) Pause() (err error) {
 				p.sendGuiDataEvent(EventUnpaused, currentSong)
 			}
 		} else {
-			p.stopped = true
+			p.stopped.Store(true)
 			p.sendGuiEvent(EventStopped)
 		}
 	}
@@ -245,82 +370,180 @@ func (p *Player) AdjustVolume(increment int) error {
 }
 
 func (p *Player) Seek(increment int) error {
+	if uri, position := p.offsetStream(int64(p.GetTimePos()) + int64(increment)); uri != "" {
+		return p.loadAtOffset(uri, position)
+	}
 	return p.instance.Command([]string{"seek", strconv.Itoa(increment)})
 }
 
+// SetOffsetUri sets how the stream of a queue item starting position seconds
+// into it is built, for streams mpv can't seek in like transcoded ones. uri
+// returns "" if mpv can seek in the item's stream.
+func (p *Player) SetOffsetUri(uri func(item QueueItem, position int64) string) {
+	p.offsetUri.Store(uri)
+}
+
+// offsetStream returns the stream of the current song starting at position,
+// "" if mpv seeks in the loaded one.
+func (p *Player) offsetStream(position int64) (string, int64) {
+	offsetUri, ok := p.offsetUri.Load().(func(QueueItem, int64) string)
+	if !ok {
+		return "", 0
+	}
+	current, ok := p.queue.Current()
+	if !ok {
+		return "", 0
+	}
+	position = max(position, 0)
+	return offsetUri(current, position), position
+}
+
+// loadAtOffset replaces the loaded stream of the current song with uri,
+// which starts position seconds into the song
+func (p *Player) loadAtOffset(uri string, position int64) error {
+	p.pendingOffset.Store(position)
+	p.offsetReload.Store(true)
+	p.replaceInProgress.Store(true)
+	if err := p.instance.Command([]string{"loadfile", uri}); err != nil {
+		p.pendingOffset.Store(0)
+		p.offsetReload.Store(false)
+		p.replaceInProgress.Store(false)
+		return err
+	}
+	return nil
+}
+
 // accessed from gui context
 func (p *Player) ClearQueue() {
 	if err := p.Stop(); err != nil {
 		p.logger.Error("Stop", err)
 	}
-	p.queue = make([]QueueItem, 0) // TODO mutex queue access
+	p.queue.Clear()
 }
 
 func (p *Player) DeleteQueueItem(index int) {
-	// TODO mutex queue access
-	if index >= len(p.queue) {
-		p.logger.Warn("DeleteQueueItem bad index %d (len %d)", index, len(p.queue))
-	} else if len(p.queue) > 1 {
-		if index == 0 {
-			if err := p.PlayNextTrack(); err != nil {
-				p.logger.Error("PlayNextTrack", err)
-			}
-		} else {
-			p.queue = append(p.queue[:index], p.queue[index+1:]...)
+	wasCurrent := index == p.queue.CurrentIndex()
+	if err := p.queue.Remove(index); err != nil {
+		p.logger.Warn("DeleteQueueItem(%d): %v", index, err)
+		return
+	}
+	if !wasCurrent {
+		p.syncNext()
+		return
+	}
+
+	// the next song took the deleted one's place
+	if next, ok := p.queue.Current(); ok {
+		if err := p.replaceCurrent(next); err != nil {
+			p.logger.Error("DeleteQueueItem", err)
 		}
-	} else {
-		p.ClearQueue()
+	} else if err := p.Stop(); err != nil {
+		p.logger.Error("Stop", err)
 	}
 }
 
 func (p *Player) AddToQueue(item *QueueItem) {
-	p.queue = append(p.queue, *item)
+	p.queue.Append(*item)
+	p.syncNext()
 }
 
-func (p *Player) MoveSongUp(index int) {
-	if index < 1 {
-		p.logger.Debug("MoveSongUp(%d) can't move top item", index)
-		return
+// InsertIntoQueue inserts items so that the first one ends up at index.
+func (p *Player) InsertIntoQueue(index int, items ...QueueItem) error {
+	if err := p.queue.Insert(index, items...); err != nil {
+		return err
 	}
-	if index >= len(p.queue) {
-		p.logger.Debug("MoveSongUp(%d) not that many songs in queue", index)
-		return
+	p.syncNext()
+	return nil
+}
+
+// MoveQueueItems moves count items starting at from so that the first of
+// them ends up at index to.
+func (p *Player) MoveQueueItems(from, count, to int) error {
+	if err := p.queue.Move(from, count, to); err != nil {
+		return err
 	}
-	p.queue[index-1], p.queue[index] = p.queue[index], p.queue[index-1]
+	p.syncNext()
+	return nil
 }
 
-func (p *Player) MoveSongDown(index int) {
-	if index < 0 {
-		p.logger.Debug("MoveSongUp(%d) invalid index", index)
+// ReplaceQueue replaces the whole queue with items. Playback isn't changed.
+func (p *Player) ReplaceQueue(items PlayerQueue) {
+	p.queue.Replace(items)
+	p.syncNext()
+}
+
+// UpdateUris replaces the URIs of the queued songs with the ones uri returns,
+// e.g. after the stream settings changed. The current song keeps playing its
+// old stream.
+func (p *Player) UpdateUris(uri func(item QueueItem) string) {
+	p.queue.Update(func(item *QueueItem) {
+		item.Uri = uri(*item)
+	})
+	p.syncNext()
+}
+
+// LoadQueue replaces the queue with items and loads items[current], seeking to
+// position seconds once it's loaded. If paused is set, playback waits for the
+// user. A current index past the end selects the last item from its start.
+func (p *Player) LoadQueue(items PlayerQueue, current int, position int64, paused bool) error {
+	p.queue.Replace(items)
+	if current < 0 || len(items) == 0 {
+		return nil
+	}
+	if current >= len(items) {
+		current = len(items) - 1
+		position = 0
+	}
+	if err := p.queue.SetCurrent(current); err != nil {
+		return err
+	}
+
+	if err := p.instance.SetProperty(string(Pause), mpv.FORMAT_FLAG, paused); err != nil {
+		return err
+	}
+	p.pendingSeek.Store(position)
+	p.stopped.Store(false)
+	if loaded, err := p.IsSongLoaded(); err != nil {
+		p.logger.Error("IsSongLoaded", err)
+	} else if loaded {
+		// the old queue's song ends without advancing the new queue
+		p.replaceInProgress.Store(true)
+		if err := p.temporaryStop(); err != nil {
+			p.logger.Error("temporaryStop", err)
+		}
+	}
+	return p.instance.Command([]string{"loadfile", items[current].Uri})
+}
+
+func (p *Player) MoveSongUp(index int) {
+	if err := p.queue.Move(index, 1, index-1); err != nil {
+		p.logger.Debug("MoveSongUp(%d): %v", index, err)
 		return
 	}
-	if index >= len(p.queue)-1 {
-		p.logger.Debug("MoveSongUp(%d) can't move last song down", index)
+	p.syncNext()
+}
+
+func (p *Player) MoveSongDown(index int) {
+	if err := p.queue.Move(index, 1, index+1); err != nil {
+		p.logger.Debug("MoveSongDown(%d): %v", index, err)
 		return
 	}
-	p.queue[index], p.queue[index+1] = p.queue[index+1], p.queue[index]
+	p.syncNext()
 }
 
 func (p *Player) Shuffle() {
-	max := len(p.queue)
-	for range max / 2 {
-		ra := rand.Intn(max)
-		rb := rand.Intn(max)
-		p.queue[ra], p.queue[rb] = p.queue[rb], p.queue[ra]
-	}
+	p.queue.Shuffle()
+	p.syncNext()
 }
 
 func (p *Player) GetQueueItem(index int) (QueueItem, error) {
-	if index < 0 || index >= len(p.queue) {
-		return QueueItem{}, errors.New("invalid queue entry")
-	}
-	return p.queue[index], nil
+	return p.queue.Get(index)
 }
 
-func (p *Player) GetQueueCopy() PlayerQueue {
-	cpy := make(PlayerQueue, len(p.queue))
-	copy(cpy, p.queue)
-	return cpy
+// GetQueueCopy returns a consistent snapshot of the queue and the index of
+// the current song, which is the queue length once it has been played.
+func (p *Player) GetQueueCopy() (PlayerQueue, int) {
+	return p.queue.Snapshot()
 }
 
 // accessed from background context
@@ -333,10 +556,10 @@ func (p *Player) GetPlayingTrack() (QueueItem, error) {
 		return QueueItem{}, errors.New("not playing")
 	}
 
-	if len(p.queue) == 0 { // TODO mutex queue access
+	currentSong, ok := p.queue.Current()
+	if !ok {
 		return QueueItem{}, errors.New("queue empty")
 	}
-	currentSong := p.queue[0]
 	return currentSong, nil
 }
 
@@ -361,6 +584,21 @@ func (p *Player) OnSongChange(cb func(track remote.TrackInterface)) {
 	p.cbOnSongChange = append(p.cbOnSongChange, cb)
 }
 
+// GetStreamTitle returns the title a live stream sent last, usually the
+// artist and title of the song playing on the station.
+func (p *Player) GetStreamTitle() string {
+	title, _ := p.streamTitle.Load().(string)
+	return title
+}
+
+// GetAudioFormat returns the codec and bitrate in bit/s mpv decodes the
+// playing song with, "" and 0 while they are unknown.
+func (p *Player) GetAudioFormat() (codec string, bitrate int64) {
+	codec, _ = p.getPropertyString(AudioCodecName)
+	bitrate, _ = p.getPropertyInt64(AudioBitrate)
+	return
+}
+
 func (p *Player) GetTimePos() float64 {
 	return p.remoteState.timePos
 }
@@ -370,6 +608,9 @@ func (p *Player) IsSeeking() (bool, error) {
 }
 
 func (p *Player) SeekAbsolute(position int) error {
+	if uri, offset := p.offsetStream(int64(position)); uri != "" {
+		return p.loadAtOffset(uri, offset)
+	}
 	return p.instance.Command([]string{"seek", strconv.Itoa(position), "absolute"})
 }
 
@@ -386,9 +627,6 @@ func (p *Player) NextTrack() error {
 	return p.PlayNextTrack()
 }
 
-func (p *Player) PreviousTrack() (err error) {
-	if err = p.Stop(); err != nil {
-		return
-	}
-	return p.Pause()
+func (p *Player) PreviousTrack() error {
+	return p.PlayPreviousTrack()
 }
@@ -5,7 +5,13 @@ type Property string
 const (
 	PlaybackTime Property = "playback-time"
 	Duration     Property = "duration"
-	Volume       Property = "Volume"
+	Volume       Property = "volume"
 	IdleActive   Property = "idle-active"
 	Pause        Property = "pause"
+	VolumeGain   Property = "volume-gain"
+	// title of the current show or song sent by a live stream
+	IcyTitle Property = "metadata/by-key/icy-title"
+	// what mpv decodes, after the server transcoded it
+	AudioCodecName Property = "audio-codec-name"
+	AudioBitrate   Property = "audio-bitrate"
 )
@@ -0,0 +1,220 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package mpvplayer
+
+import (
+	"errors"
+	"math/rand"
+	"slices"
+	"sync"
+)
+
+var ErrInvalidQueueIndex = errors.New("invalid queue index")
+
+type PlayerQueue []QueueItem
+
+// queue is the player's list of songs with a cursor on the current song. The
+// songs before the cursor have been played and make up the history.
+// It is accessed from the gui and the mpv event loop, so every method takes
+// the lock and leaves the queue in a consistent state.
+type queue struct {
+	mu    sync.RWMutex
+	items PlayerQueue
+	// index of the current song, len(items) once the queue has been played
+	// to the end
+	current int
+}
+
+func (q *queue) Len() int {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	return len(q.items)
+}
+
+func (q *queue) Get(index int) (QueueItem, error) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if index < 0 || index >= len(q.items) {
+		return QueueItem{}, ErrInvalidQueueIndex
+	}
+	return q.items[index], nil
+}
+
+// Current returns the current item, false if there is none
+func (q *queue) Current() (QueueItem, bool) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.current >= len(q.items) {
+		return QueueItem{}, false
+	}
+	return q.items[q.current], true
+}
+
+func (q *queue) CurrentIndex() int {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	return q.current
+}
+
+// SetCurrent moves the cursor to index
+func (q *queue) SetCurrent(index int) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if index < 0 || index >= len(q.items) {
+		return ErrInvalidQueueIndex
+	}
+	q.current = index
+	return nil
+}
+
+// Snapshot returns a copy of the whole queue and the current index
+func (q *queue) Snapshot() (PlayerQueue, int) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	return slices.Clone(q.items), q.current
+}
+
+func (q *queue) Append(items ...QueueItem) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.items = append(q.items, items...)
+}
+
+// Insert inserts items so that the first one ends up at index. index may be
+// the queue length to append. Items inserted at the cursor end up before the
+// current song.
+func (q *queue) Insert(index int, items ...QueueItem) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if index < 0 || index > len(q.items) {
+		return ErrInvalidQueueIndex
+	}
+	if index < q.current || (index == q.current && q.current < len(q.items)) {
+		q.current += len(items)
+	}
+	q.items = slices.Insert(q.items, index, items...)
+	return nil
+}
+
+// Remove removes the item at index. If it's the current one, the next item
+// becomes current.
+func (q *queue) Remove(index int) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if index < 0 || index >= len(q.items) {
+		return ErrInvalidQueueIndex
+	}
+	if index < q.current {
+		q.current--
+	}
+	q.items = slices.Delete(q.items, index, index+1)
+	return nil
+}
+
+// Move moves count items starting at from so that the first of them ends up
+// at index to. The cursor stays on the current song.
+func (q *queue) Move(from, count, to int) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if count < 1 || from < 0 || from+count > len(q.items) || to < 0 || to+count > len(q.items) {
+		return ErrInvalidQueueIndex
+	}
+
+	switch {
+	case q.current >= len(q.items):
+		// played to the end, nothing to follow
+	case q.current >= from && q.current < from+count:
+		q.current += to - from
+	default:
+		if q.current >= from+count {
+			q.current -= count
+		}
+		if q.current >= to {
+			q.current += count
+		}
+	}
+
+	moved := slices.Clone(q.items[from : from+count])
+	rest := slices.Delete(q.items, from, from+count)
+	q.items = slices.Insert(rest, to, moved...)
+	return nil
+}
+
+// Replace replaces all items, the first one becomes current
+func (q *queue) Replace(items PlayerQueue) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.items = slices.Clone(items)
+	q.current = 0
+}
+
+func (q *queue) Clear() {
+	q.Replace(nil)
+}
+
+// Skip moves the cursor by count items, backwards if negative, and returns the
+// new current item. Without wrap the cursor stops at either end and false is
+// returned past the last item. With wrap it continues at the other end.
+func (q *queue) Skip(count int, wrap bool) (QueueItem, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.items) == 0 {
+		return QueueItem{}, false
+	}
+
+	q.current = q.offset(count, wrap)
+	if q.current == len(q.items) {
+		return QueueItem{}, false
+	}
+	return q.items[q.current], true
+}
+
+// Peek returns the item Skip would move to, without moving the cursor.
+func (q *queue) Peek(count int, wrap bool) (QueueItem, bool) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if len(q.items) == 0 {
+		return QueueItem{}, false
+	}
+
+	index := q.offset(count, wrap)
+	if index == len(q.items) {
+		return QueueItem{}, false
+	}
+	return q.items[index], true
+}
+
+// offset returns the index count items away from the cursor, see Skip. The
+// lock must be held and the queue must not be empty.
+func (q *queue) offset(count int, wrap bool) int {
+	if wrap {
+		return ((q.current+count)%len(q.items) + len(q.items)) % len(q.items)
+	}
+	return min(max(q.current+count, 0), len(q.items))
+}
+
+// Update calls f for every item, it may change them in place
+func (q *queue) Update(f func(item *QueueItem)) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i := range q.items {
+		f(&q.items[i])
+	}
+}
+
+// Shuffle shuffles the songs after the current one. If the queue has been
+// played to the end, all songs are shuffled and it starts over.
+func (q *queue) Shuffle() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	start := q.current + 1
+	if q.current >= len(q.items) {
+		q.current = 0
+		start = 0
+	}
+	upcoming := q.items[start:]
+	rand.Shuffle(len(upcoming), func(i, j int) {
+		upcoming[i], upcoming[j] = upcoming[j], upcoming[i]
+	})
+}
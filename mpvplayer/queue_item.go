@@ -14,9 +14,19 @@ type QueueItem struct {
 	Artist      string
 	Duration    int
 	Album       string
+	AlbumId     string
 	TrackNumber int
 	CoverArtId  string
 	DiscNumber  int
+	ReplayGain  ReplayGain
+	// 1-5 stars when the song was queued, 0 if unrated
+	Rating int
+	// a live stream like an internet radio station: it has no duration, Id
+	// is the station's and Uri doesn't point to the server
+	Live bool
+	// a podcast episode: Id is its stream ID and playback resumes where it
+	// was left, see Player.EpisodePosition
+	Podcast bool
 }
 
 var _ remote.TrackInterface = (*QueueItem)(nil)
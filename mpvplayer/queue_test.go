@@ -0,0 +1,263 @@
+package mpvplayer
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func makeItems(ids ...string) PlayerQueue {
+	items := make(PlayerQueue, len(ids))
+	for i, id := range ids {
+		items[i] = QueueItem{Id: id}
+	}
+	return items
+}
+
+func queueIds(items PlayerQueue) []string {
+	ids := make([]string, len(items))
+	for i, item := range items {
+		ids[i] = item.Id
+	}
+	return ids
+}
+
+func snapshotIds(q *queue) []string {
+	items, _ := q.Snapshot()
+	return queueIds(items)
+}
+
+func TestQueueInsertAndRemove(t *testing.T) {
+	var q queue
+	q.Append(makeItems("a", "d")...)
+
+	require.NoError(t, q.Insert(1, makeItems("b", "c")...))
+	require.NoError(t, q.Insert(4, makeItems("e")...))
+	assert.Equal(t, []string{"a", "b", "c", "d", "e"}, snapshotIds(&q))
+
+	assert.ErrorIs(t, q.Insert(6, makeItems("x")...), ErrInvalidQueueIndex)
+	assert.ErrorIs(t, q.Remove(5), ErrInvalidQueueIndex)
+
+	require.NoError(t, q.Remove(2))
+	assert.Equal(t, []string{"a", "b", "d", "e"}, snapshotIds(&q))
+}
+
+func TestQueueMove(t *testing.T) {
+	testCases := []struct {
+		from, count, to int
+		expected        []string
+	}{
+		{0, 1, 1, []string{"b", "a", "c", "d", "e"}},
+		{4, 1, 3, []string{"a", "b", "c", "e", "d"}},
+		{1, 2, 3, []string{"a", "d", "e", "b", "c"}},
+		{3, 2, 0, []string{"d", "e", "a", "b", "c"}},
+		{1, 3, 1, []string{"a", "b", "c", "d", "e"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%d+%d->%d", tc.from, tc.count, tc.to), func(t *testing.T) {
+			var q queue
+			q.Replace(makeItems("a", "b", "c", "d", "e"))
+			require.NoError(t, q.Move(tc.from, tc.count, tc.to))
+			assert.Equal(t, tc.expected, snapshotIds(&q))
+		})
+	}
+
+	var q queue
+	q.Replace(makeItems("a", "b", "c"))
+	assert.ErrorIs(t, q.Move(0, 1, -1), ErrInvalidQueueIndex)
+	assert.ErrorIs(t, q.Move(2, 1, 3), ErrInvalidQueueIndex)
+	assert.ErrorIs(t, q.Move(1, 3, 0), ErrInvalidQueueIndex)
+	assert.ErrorIs(t, q.Move(0, 0, 1), ErrInvalidQueueIndex)
+	assert.Equal(t, []string{"a", "b", "c"}, snapshotIds(&q))
+}
+
+func TestQueueSkip(t *testing.T) {
+	var q queue
+	_, ok := q.Skip(1, false)
+	assert.False(t, ok)
+
+	q.Replace(makeItems("a", "b", "c"))
+	next, ok := q.Skip(2, false)
+	assert.True(t, ok)
+	assert.Equal(t, "c", next.Id)
+
+	// played songs stay in the queue
+	_, ok = q.Skip(5, false)
+	assert.False(t, ok)
+	assert.Equal(t, 3, q.Len())
+	assert.Equal(t, 3, q.CurrentIndex())
+
+	next, ok = q.Skip(-1, false)
+	assert.True(t, ok)
+	assert.Equal(t, "c", next.Id)
+
+	next, _ = q.Skip(-5, false)
+	assert.Equal(t, "a", next.Id)
+}
+
+func TestQueueSkipWrap(t *testing.T) {
+	var q queue
+	_, ok := q.Skip(1, true)
+	assert.False(t, ok)
+
+	q.Replace(makeItems("a", "b", "c"))
+	next, ok := q.Skip(4, true)
+	assert.True(t, ok)
+	assert.Equal(t, "b", next.Id)
+
+	next, _ = q.Skip(-2, true)
+	assert.Equal(t, "c", next.Id)
+	assert.Equal(t, []string{"a", "b", "c"}, snapshotIds(&q))
+}
+
+func TestQueuePeek(t *testing.T) {
+	var q queue
+	_, ok := q.Peek(1, false)
+	assert.False(t, ok)
+
+	q.Replace(makeItems("a", "b"))
+	next, ok := q.Peek(1, false)
+	assert.True(t, ok)
+	assert.Equal(t, "b", next.Id)
+	assert.Equal(t, 0, q.CurrentIndex())
+
+	q.Skip(1, false)
+	_, ok = q.Peek(1, false)
+	assert.False(t, ok)
+	next, _ = q.Peek(1, true)
+	assert.Equal(t, "a", next.Id)
+}
+
+func TestQueueCursorFollowsEdits(t *testing.T) {
+	var q queue
+	q.Replace(makeItems("a", "b", "c", "d"))
+	require.NoError(t, q.SetCurrent(2))
+
+	current := func() string {
+		item, _ := q.Current()
+		return item.Id
+	}
+
+	require.NoError(t, q.Insert(0, makeItems("x")...))
+	assert.Equal(t, "c", current())
+	require.NoError(t, q.Insert(4, makeItems("y")...))
+	assert.Equal(t, "c", current())
+
+	require.NoError(t, q.Remove(0))
+	assert.Equal(t, "c", current())
+	assert.Equal(t, 2, q.CurrentIndex())
+
+	// moving the current song or songs around it
+	require.NoError(t, q.Move(2, 1, 0))
+	assert.Equal(t, "c", current())
+	assert.Equal(t, 0, q.CurrentIndex())
+	require.NoError(t, q.Move(3, 2, 0))
+	assert.Equal(t, "c", current())
+	assert.Equal(t, []string{"y", "d", "c", "a", "b"}, snapshotIds(&q))
+
+	// removing the current song makes the next one current
+	require.NoError(t, q.Remove(2))
+	assert.Equal(t, "a", current())
+
+	// songs appended after the end become current
+	q.Skip(10, false)
+	_, ok := q.Current()
+	assert.False(t, ok)
+	q.Append(makeItems("z")...)
+	assert.Equal(t, "z", current())
+
+	assert.ErrorIs(t, q.SetCurrent(5), ErrInvalidQueueIndex)
+}
+
+func TestQueueShuffleKeepsHistory(t *testing.T) {
+	var q queue
+	q.Replace(makeItems("a", "b", "c", "d", "e", "f"))
+	require.NoError(t, q.SetCurrent(1))
+
+	q.Shuffle()
+	ids := snapshotIds(&q)
+	assert.Equal(t, []string{"a", "b"}, ids[:2])
+	assert.ElementsMatch(t, []string{"c", "d", "e", "f"}, ids[2:])
+	assert.Equal(t, 1, q.CurrentIndex())
+}
+
+func TestRepeatModeCycle(t *testing.T) {
+	mode := RepeatOff
+	for _, want := range []RepeatMode{RepeatAll, RepeatOne, StopAfterCurrent, RepeatOff} {
+		mode = mode.Next()
+		assert.Equal(t, want, mode)
+	}
+}
+
+func TestQueueSnapshotIsCopy(t *testing.T) {
+	var q queue
+	items := makeItems("a", "b")
+	q.Replace(items)
+	items[0].Id = "changed"
+
+	snapshot, _ := q.Snapshot()
+	snapshot[1].Id = "changed"
+	assert.Equal(t, []string{"a", "b"}, snapshotIds(&q))
+}
+
+func TestQueueUpdate(t *testing.T) {
+	var q queue
+	q.Replace(makeItems("a", "b"))
+	require.NoError(t, q.SetCurrent(1))
+
+	q.Update(func(item *QueueItem) {
+		item.Uri = "stream/" + item.Id
+	})
+	items, current := q.Snapshot()
+	assert.Equal(t, 1, current)
+	assert.Equal(t, "stream/a", items[0].Uri)
+	assert.Equal(t, "stream/b", items[1].Uri)
+}
+
+// run with -race
+func TestQueueConcurrentAccess(t *testing.T) {
+	var q queue
+	var wg sync.WaitGroup
+
+	// gui side edits
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			q.Append(QueueItem{Id: fmt.Sprint(i)})
+			_ = q.Move(0, 1, q.Len()-1)
+			if i%10 == 0 {
+				q.Shuffle()
+			}
+		}
+	}()
+
+	// mpv event loop advancing
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 500; i++ {
+			q.Skip(1, i%3 == 0)
+			q.Current()
+		}
+	}()
+
+	// ui redraws
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			snapshot, current := q.Snapshot()
+			assert.LessOrEqual(t, current, len(snapshot))
+			for _, item := range snapshot {
+				assert.NotEmpty(t, item.Id)
+			}
+		}
+	}()
+
+	wg.Wait()
+}
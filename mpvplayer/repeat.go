@@ -0,0 +1,88 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package mpvplayer
+
+import (
+	"errors"
+
+	"github.com/spezifisch/stmps/remote"
+)
+
+var ErrInvalidLoopStatus = errors.New("invalid loop status")
+
+// RepeatMode decides what happens when a song ends.
+type RepeatMode int32
+
+const (
+	// play the queue once
+	RepeatOff RepeatMode = iota
+	// start over at the top when the queue runs out
+	RepeatAll
+	// play the current song again
+	RepeatOne
+	// stop when the current song ends, then go back to RepeatOff
+	StopAfterCurrent
+)
+
+func (m RepeatMode) String() string {
+	switch m {
+	case RepeatAll:
+		return "repeat all"
+	case RepeatOne:
+		return "repeat one"
+	case StopAfterCurrent:
+		return "stop after current"
+	default:
+		return "repeat off"
+	}
+}
+
+// Next returns the mode that follows m when cycling through the modes.
+func (m RepeatMode) Next() RepeatMode {
+	return (m + 1) % (StopAfterCurrent + 1)
+}
+
+func (p *Player) GetRepeatMode() RepeatMode {
+	return RepeatMode(p.repeatMode.Load())
+}
+
+// SetRepeatMode changes the repeat mode and notifies the gui.
+func (p *Player) SetRepeatMode(mode RepeatMode) {
+	p.repeatMode.Store(int32(mode))
+	p.syncNext()
+	p.sendGuiDataEvent(EventRepeatMode, mode)
+}
+
+func (p *Player) CycleRepeatMode() RepeatMode {
+	mode := p.GetRepeatMode().Next()
+	p.SetRepeatMode(mode)
+	return mode
+}
+
+// GetLoopStatus maps the repeat mode to MPRIS' LoopStatus, which has no
+// equivalent for StopAfterCurrent.
+func (p *Player) GetLoopStatus() remote.LoopStatus {
+	switch p.GetRepeatMode() {
+	case RepeatAll:
+		return remote.LoopPlaylist
+	case RepeatOne:
+		return remote.LoopTrack
+	default:
+		return remote.LoopNone
+	}
+}
+
+func (p *Player) SetLoopStatus(status remote.LoopStatus) error {
+	switch status {
+	case remote.LoopPlaylist:
+		p.SetRepeatMode(RepeatAll)
+	case remote.LoopTrack:
+		p.SetRepeatMode(RepeatOne)
+	case remote.LoopNone:
+		p.SetRepeatMode(RepeatOff)
+	default:
+		return ErrInvalidLoopStatus
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package mpvplayer
+
+import (
+	"math"
+
+	"github.com/supersonic-app/go-mpv"
+)
+
+// ReplayGain holds a song's loudness normalization values, gains in dB.
+// Unknown gains are nil, unknown peaks zero.
+type ReplayGain struct {
+	TrackGain *float64
+	AlbumGain *float64
+	TrackPeak float64
+	AlbumPeak float64
+	// added to the track or album gain, e.g. the Opus output gain
+	BaseGain float64
+	// used if neither the track nor the album gain is known
+	FallbackGain float64
+}
+
+type ReplayGainMode string
+
+const (
+	ReplayGainOff   ReplayGainMode = "off"
+	ReplayGainTrack ReplayGainMode = "track"
+	ReplayGainAlbum ReplayGainMode = "album"
+	// album gain while an album is played in order, track gain otherwise
+	ReplayGainAuto ReplayGainMode = "auto"
+)
+
+// ParseReplayGainMode returns the mode named s, ReplayGainOff if it's unknown.
+func ParseReplayGainMode(s string) ReplayGainMode {
+	switch mode := ReplayGainMode(s); mode {
+	case ReplayGainTrack, ReplayGainAlbum, ReplayGainAuto:
+		return mode
+	default:
+		return ReplayGainOff
+	}
+}
+
+func (p *Player) SetReplayGainMode(mode ReplayGainMode) {
+	p.replayGainMode.Store(mode)
+	if mode == ReplayGainOff {
+		// reset once, applyReplayGain leaves mpv alone while it's off
+		if err := p.instance.SetProperty(string(VolumeGain), mpv.FORMAT_DOUBLE, 0.0); err != nil {
+			p.logger.Error("SetReplayGainMode", err)
+		}
+		return
+	}
+	p.applyReplayGain()
+}
+
+func (p *Player) GetReplayGainMode() ReplayGainMode {
+	if mode, ok := p.replayGainMode.Load().(ReplayGainMode); ok {
+		return mode
+	}
+	return ReplayGainOff
+}
+
+// applyReplayGain sets mpv's volume-gain for the current song
+func (p *Player) applyReplayGain() {
+	mode := p.GetReplayGainMode()
+	if mode == ReplayGainOff {
+		return
+	}
+	items, current := p.queue.Snapshot()
+	gain := replayGain(items, current, mode)
+	if err := p.instance.SetProperty(string(VolumeGain), mpv.FORMAT_DOUBLE, gain); err != nil {
+		p.logger.Error("applyReplayGain", err)
+	}
+}
+
+// replayGain returns the gain in dB for items[current], reduced so its peak
+// doesn't clip.
+func replayGain(items PlayerQueue, current int, mode ReplayGainMode) float64 {
+	if mode == ReplayGainOff || current < 0 || current >= len(items) {
+		return 0
+	}
+	rg := items[current].ReplayGain
+
+	useAlbum := mode == ReplayGainAlbum ||
+		(mode == ReplayGainAuto && playingAlbum(items, current))
+
+	var known *float64
+	var peak float64
+	switch {
+	case useAlbum && rg.AlbumGain != nil:
+		known, peak = rg.AlbumGain, rg.AlbumPeak
+	case rg.TrackGain != nil:
+		known, peak = rg.TrackGain, rg.TrackPeak
+	case rg.AlbumGain != nil:
+		known, peak = rg.AlbumGain, rg.AlbumPeak
+	default:
+		return rg.BaseGain + rg.FallbackGain
+	}
+
+	gain := rg.BaseGain + *known
+	if peak > 0 {
+		// peak is linear, 1.0 is full scale
+		gain = min(gain, -20*math.Log10(peak))
+	}
+	return gain
+}
+
+// playingAlbum reports whether items[current] is played as part of its album,
+// meaning a neighbour in the queue is the album's previous or next track.
+func playingAlbum(items PlayerQueue, current int) bool {
+	song := items[current]
+	if song.AlbumId == "" {
+		return false
+	}
+	if current > 0 {
+		prev := items[current-1]
+		if prev.AlbumId == song.AlbumId && prev.TrackNumber+1 == song.TrackNumber {
+			return true
+		}
+	}
+	if current+1 < len(items) {
+		next := items[current+1]
+		if next.AlbumId == song.AlbumId && song.TrackNumber+1 == next.TrackNumber {
+			return true
+		}
+	}
+	return false
+}
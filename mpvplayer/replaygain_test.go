@@ -0,0 +1,60 @@
+package mpvplayer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplayGain(t *testing.T) {
+	gain := ReplayGain{TrackGain: db(-6), AlbumGain: db(-8), TrackPeak: 0.5, AlbumPeak: 0.9}
+	album := PlayerQueue{
+		{Id: "1", AlbumId: "a", TrackNumber: 1, ReplayGain: gain},
+		{Id: "2", AlbumId: "a", TrackNumber: 2, ReplayGain: gain},
+		{Id: "3", AlbumId: "b", TrackNumber: 7, ReplayGain: gain},
+	}
+
+	testCases := []struct {
+		name     string
+		mode     ReplayGainMode
+		current  int
+		expected float64
+	}{
+		{"off", ReplayGainOff, 0, 0},
+		{"track", ReplayGainTrack, 0, -6},
+		{"album", ReplayGainAlbum, 2, -8},
+		{"auto in album order", ReplayGainAuto, 1, -8},
+		{"auto single song", ReplayGainAuto, 2, -6},
+		{"past the end", ReplayGainTrack, 3, 0},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.InDelta(t, tc.expected, replayGain(album, tc.current, tc.mode), 0.01)
+		})
+	}
+
+	// positive gains are limited by the peak, 0.5 is about -6 dB
+	loud := PlayerQueue{{ReplayGain: ReplayGain{TrackGain: db(10), TrackPeak: 0.5}}}
+	assert.InDelta(t, 6.02, replayGain(loud, 0, ReplayGainTrack), 0.01)
+
+	// falls back to album gain, then the fallback gain
+	onlyAlbum := PlayerQueue{{ReplayGain: ReplayGain{AlbumGain: db(-3)}}}
+	assert.InDelta(t, -3, replayGain(onlyAlbum, 0, ReplayGainTrack), 0.01)
+	unknown := PlayerQueue{{ReplayGain: ReplayGain{FallbackGain: -2}}}
+	assert.InDelta(t, -2, replayGain(unknown, 0, ReplayGainAuto), 0.01)
+
+	// a known 0 dB track gain is used instead of the album gain
+	zero := PlayerQueue{{ReplayGain: ReplayGain{TrackGain: db(0), AlbumGain: db(-3), FallbackGain: -2}}}
+	assert.InDelta(t, 0, replayGain(zero, 0, ReplayGainTrack), 0.01)
+
+	// the base gain is added to the chosen gain
+	base := PlayerQueue{{ReplayGain: ReplayGain{TrackGain: db(-6), BaseGain: 2}}}
+	assert.InDelta(t, -4, replayGain(base, 0, ReplayGainTrack), 0.01)
+
+	assert.Equal(t, ReplayGainOff, ParseReplayGainMode("bogus"))
+	assert.Equal(t, ReplayGainAuto, ParseReplayGainMode("auto"))
+}
+
+func db(gain float64) *float64 {
+	return &gain
+}
@@ -0,0 +1,27 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package mpvplayer
+
+const (
+	// positions before this many seconds aren't resumed from, mpv also
+	// reports 0 when a file is loaded before it seeks to a saved position
+	ResumeMinPosition = 10
+	// songs and episodes this many seconds from their end count as finished
+	// and start over
+	ResumeFinishedMargin = 30
+)
+
+// ResumeFrom tells whether playback stopped position seconds into an item
+// lasting duration seconds should resume there, or whether the item is
+// finished. Both are false for positions too early to remember. A duration
+// of 0 is unknown.
+func ResumeFrom(position, duration int64) (resume, finished bool) {
+	if position < ResumeMinPosition {
+		return false, false
+	}
+	if duration > 0 && position >= duration-ResumeFinishedMargin {
+		return false, true
+	}
+	return true, false
+}
@@ -0,0 +1,92 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package mpvplayer
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// SavedState is the local player state persisted across restarts.
+type SavedState struct {
+	Queue PlayerQueue `json:"queue"`
+	// index of the current song in Queue
+	Current int `json:"current"`
+	// position in the current song in seconds
+	Position int64 `json:"position"`
+	// 0 if no volume was reported by mpv before saving
+	Volume int64      `json:"volume,omitempty"`
+	Repeat RepeatMode `json:"repeat"`
+	// where podcast episodes resume, see Player.EpisodePosition
+	EpisodePositions map[string]int64 `json:"episodePositions,omitempty"`
+}
+
+// LoadState reads a state file written by SaveState.
+func LoadState(path string) (state SavedState, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(data, &state)
+	return
+}
+
+// SaveState writes state to path, creating the directory if needed. Stream
+// URIs carry credentials, so they are not written and must be rebuilt after
+// loading. Those of live streams are kept, they don't point to the server.
+func SaveState(path string, state SavedState) error {
+	queue := make(PlayerQueue, len(state.Queue))
+	for i, item := range state.Queue {
+		if !item.Live {
+			item.Uri = ""
+		}
+		queue[i] = item
+	}
+	state.Queue = queue
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	// write to a temporary file first so a crash can't leave a truncated state
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// GetState returns the current queue, position, volume, repeat mode and
+// episode positions.
+func (p *Player) GetState() SavedState {
+	queue, current := p.queue.Snapshot()
+	return SavedState{
+		Queue:            queue,
+		Current:          current,
+		Position:         int64(p.GetTimePos()),
+		Volume:           p.State.Volume,
+		Repeat:           p.GetRepeatMode(),
+		EpisodePositions: p.EpisodePositions(),
+	}
+}
+
+// RestoreState replaces the queue, volume, repeat mode and episode positions
+// with state and loads the current song at the saved position. If paused is
+// set, playback waits for the user.
+func (p *Player) RestoreState(state SavedState, paused bool) error {
+	// without a saved volume mpv's default is kept instead of starting muted
+	if state.Volume > 0 {
+		if err := p.SetVolume(int(state.Volume)); err != nil {
+			p.logger.Error("RestoreState: SetVolume", err)
+		}
+	}
+	p.SetRepeatMode(state.Repeat)
+	p.SetEpisodePositions(state.EpisodePositions)
+	return p.LoadQueue(state.Queue, state.Current, state.Position, paused)
+}
@@ -0,0 +1,65 @@
+package mpvplayer
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStateRoundtrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stmps", "state.json")
+	state := SavedState{
+		Queue: PlayerQueue{
+			{Id: "1", Uri: "https://example.com/rest/stream?id=1&p=secret", Title: "one", Duration: 180},
+			{Id: "2", Uri: "https://example.com/rest/stream?id=2&p=secret", Title: "two"},
+			{Id: "ra-1", Uri: "https://radio.example.com/live", Title: "radio", Live: true},
+		},
+		Current:          0,
+		Position:         42,
+		Volume:           65,
+		EpisodePositions: map[string]int64{"st-1": 1234},
+	}
+
+	require.NoError(t, SaveState(path, state))
+	assert.Equal(t, "https://example.com/rest/stream?id=1&p=secret", state.Queue[0].Uri, "caller's queue must not be modified")
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, fs.FileMode(0o600), info.Mode().Perm())
+
+	loaded, err := LoadState(path)
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), loaded.Position)
+	assert.Equal(t, int64(65), loaded.Volume)
+	assert.Equal(t, map[string]int64{"st-1": 1234}, loaded.EpisodePositions)
+	require.Len(t, loaded.Queue, 3)
+	assert.Equal(t, "one", loaded.Queue[0].Title)
+	assert.Equal(t, 180, loaded.Queue[0].Duration)
+	for _, item := range loaded.Queue[:2] {
+		assert.Empty(t, item.Uri)
+	}
+	assert.True(t, loaded.Queue[2].Live)
+	assert.Equal(t, "https://radio.example.com/live", loaded.Queue[2].Uri)
+}
+
+func TestLoadMissingState(t *testing.T) {
+	_, err := LoadState(filepath.Join(t.TempDir(), "missing.json"))
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestStateWithoutVolume(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	require.NoError(t, SaveState(path, SavedState{Position: 42}))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), `"volume"`)
+
+	loaded, err := LoadState(path)
+	require.NoError(t, err)
+	assert.Zero(t, loaded.Volume)
+}
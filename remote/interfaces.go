@@ -3,6 +3,15 @@
 
 package remote
 
+// LoopStatus is the MPRIS loop status.
+type LoopStatus string
+
+const (
+	LoopNone     LoopStatus = "None"
+	LoopTrack    LoopStatus = "Track"
+	LoopPlaylist LoopStatus = "Playlist"
+)
+
 type ControlledPlayer interface {
 	// Returns true if a seek is currently in progress.
 	IsSeeking() (bool, error)
@@ -33,6 +42,9 @@ type ControlledPlayer interface {
 	PreviousTrack() error
 
 	SetVolume(percentValue int) error
+
+	GetLoopStatus() LoopStatus
+	SetLoopStatus(status LoopStatus) error
 }
 
 type TrackInterface interface {
@@ -18,6 +18,7 @@ type MprisPlayer struct {
 	player ControlledPlayer
 	logger utils.Logger
 
+	props    *prop.Properties
 	metadata map[string]interface{}
 }
 
@@ -50,10 +51,11 @@ func RegisterMprisPlayer(player ControlledPlayer, logger_ utils.Logger) (mpp *Mp
 		"CanPause":       {Value: true, Writable: false, Emit: prop.EmitFalse, Callback: nil},
 		"CanPlay":        {Value: true, Writable: false, Emit: prop.EmitFalse, Callback: nil},
 		"CanSeek":        {Value: false, Writable: false, Emit: prop.EmitFalse, Callback: nil},
-		"CanGoPrevious":  {Value: false, Writable: false, Emit: prop.EmitFalse, Callback: nil},
+		"CanGoPrevious":  {Value: true, Writable: false, Emit: prop.EmitFalse, Callback: nil},
 		"Metadata":       {Value: mpp.metadata, Writable: false, Emit: prop.EmitTrue, Callback: nil},
 		"Volume":         {Value: float64(0.0), Writable: true, Emit: prop.EmitTrue, Callback: mpp.volumeChange},
 		"PlaybackStatus": {Value: "", Writable: false, Emit: prop.EmitFalse, Callback: nil},
+		"LoopStatus":     {Value: string(player.GetLoopStatus()), Writable: true, Emit: prop.EmitTrue, Callback: mpp.loopStatusChange},
 	}
 
 	mediaPlayer := map[string]*prop.Prop{
@@ -78,6 +80,7 @@ func RegisterMprisPlayer(player ControlledPlayer, logger_ utils.Logger) (mpp *Mp
 		logger_.Error("prop.Export error", err)
 		return
 	}
+	mpp.props = props
 
 	n := &introspect.Node{
 		Name: "/org/mpris/MediaPlayer2",
@@ -90,6 +93,9 @@ func RegisterMprisPlayer(player ControlledPlayer, logger_ utils.Logger) (mpp *Mp
 					{
 						Name: "Next",
 					},
+					{
+						Name: "Previous",
+					},
 					{
 						Name: "Pause",
 					},
@@ -221,7 +227,10 @@ func (m *MprisPlayer) PlayPause() *dbus.Error {
 }
 
 func (m *MprisPlayer) Previous() *dbus.Error {
-	// TODO not implemented
+	if err := m.player.PreviousTrack(); err != nil {
+		m.logger.Error("mpp Previous", err)
+		return dbus.MakeFailedError(err)
+	}
 	return nil
 }
 
@@ -249,6 +258,21 @@ func (m *MprisPlayer) volumeChange(c *prop.Change) *dbus.Error {
 	return nil
 }
 
+func (m *MprisPlayer) loopStatusChange(c *prop.Change) *dbus.Error {
+	status := LoopStatus(c.Value.(string))
+	if err := m.player.SetLoopStatus(status); err != nil {
+		m.logger.Error("loopStatusChange", err)
+		return dbus.MakeFailedError(err)
+	}
+	m.logger.Info("mpris: set loop status %s", status)
+	return nil
+}
+
+// OnLoopStatusChange method to be called by eventLoop
+func (m *MprisPlayer) OnLoopStatusChange(status LoopStatus) {
+	m.props.SetMust("org.mpris.MediaPlayer2.Player", "LoopStatus", string(status))
+}
+
 // OnSongChange method to be called by eventLoop
 func (m *MprisPlayer) OnSongChange(currentSong TrackInterface) {
 	m.metadata["mpris:trackid"] = "/org/mpris/MediaPlayer2/track/" + currentSong.GetId()
@@ -260,10 +284,33 @@ func (m *MprisPlayer) OnSongChange(currentSong TrackInterface) {
 	m.metadata["xesam:genre"] = []string{}                                  // List of genres, empty
 	m.metadata["xesam:title"] = currentSong.GetTitle()                      // Track title
 	m.metadata["xesam:trackNumber"] = currentSong.GetTrackNumber()          // Track number
+	if currentSong.GetDuration() <= 0 {
+		// live streams, the length must be left out if it's unknown
+		delete(m.metadata, "mpris:length")
+	}
 
 	// m.logger.Printf("mpris: Updated metadata: %+v", m.metadata)
 
-	// Emit the PropertiesChanged signal to notify clients about the metadata change
+	m.emitMetadata()
+}
+
+// OnStreamTitleChange method to be called by eventLoop when a live stream
+// sends a new title. The station's name becomes the album, like other
+// players do.
+func (m *MprisPlayer) OnStreamTitleChange(station, title string) {
+	if title == "" {
+		title = station
+	}
+	m.metadata["xesam:title"] = title
+	m.metadata["xesam:album"] = station
+	m.metadata["xesam:artist"] = []string{}
+
+	m.emitMetadata()
+}
+
+// emitMetadata notifies clients about the metadata change with the
+// PropertiesChanged signal
+func (m *MprisPlayer) emitMetadata() {
 	err := m.dbus.Emit("/org/mpris/MediaPlayer2", "org.freedesktop.DBus.Properties.PropertiesChanged",
 		"org.mpris.MediaPlayer2.Player", map[string]interface{}{
 			"Metadata": m.metadata,
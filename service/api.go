@@ -5,39 +5,93 @@ package service
 
 import (
 	"encoding/json"
-	"image"
+	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/spezifisch/stmps/utils"
 )
 
 type SubsonicConnection struct {
-	conf *utils.Config
+	conf      *utils.Config
+	client    *http.Client
+	coverArts *coverArtCache
+	library   *libraryCache
+	offline   *offlineCache
+
+	mu           sync.Mutex
+	capabilities Capabilities
+	// transcoding of stream URLs, see SetStreamProfile
+	streamProfile utils.StreamProfile
 }
 
-var (
-	directoryCache map[string]SubsonicResponse = make(map[string]SubsonicResponse)
-	coverArts      map[string]image.Image      = make(map[string]image.Image)
-	token          string                      = ""
-)
+// coverArtMemoryEntries is how many decoded cover arts are kept in memory
+const coverArtMemoryEntries = 100
+
+var token string = ""
 
+// InitConnection creates a connection to the configured server. The library
+// cache saved by an earlier connection is loaded, so browsing works without
+// waiting for the server.
 func InitConnection(conf utils.ConfigProvider) *SubsonicConnection {
-	return &SubsonicConnection{
-		conf: conf.Conf(),
+	c := conf.Conf()
+	connection := &SubsonicConnection{
+		conf:   c,
+		client: &http.Client{Timeout: c.RequestTimeout},
+		coverArts: newCoverArtCache(coverArtMemoryEntries,
+			c.CoverArtCacheDir, c.CoverArtCacheSize),
+		library: newLibraryCache(c.LibraryCacheFile,
+			libraryServer(c.Host, c.Username), c.LibraryCacheTTL),
+		offline: newOfflineCache(c.OfflineDir, c.OfflineSize,
+			libraryServer(c.Host, c.Username)),
+	}
+	if err := connection.library.load(); err != nil {
+		conf.Log().Warn("Ignoring the library cache: %v", err)
+	}
+	if err := connection.offline.load(); err != nil {
+		conf.Log().Warn("Ignoring the offline cache: %v", err)
+	}
+
+	connection.streamProfile = utils.OriginalStreamProfile
+	for _, profile := range c.StreamProfiles {
+		if profile.Name == c.StreamProfile {
+			connection.streamProfile = profile
+		}
+	}
+	if connection.streamProfile.Name != c.StreamProfile && c.StreamProfile != "" {
+		conf.Log().Warn("Unknown stream profile %q, streaming the original files", c.StreamProfile)
 	}
+	return connection
+}
+
+// SetHTTPClient replaces the client requests are made with, e.g. to use a
+// custom transport.
+func (s *SubsonicConnection) SetHTTPClient(client *http.Client) {
+	s.client = client
 }
 
 func (s *SubsonicConnection) Conf() *utils.Config {
 	return s.conf
 }
 
+// ClearCache marks the cached library as outdated, everything is fetched
+// again when requested. Outdated entries are only used while the server
+// can't be reached.
 func (s *SubsonicConnection) ClearCache() {
-	directoryCache = make(map[string]SubsonicResponse)
+	s.library.expire(anyKey)
 }
 
+// RemoveCacheEntry marks the cached artist, album or directory with ID key as
+// outdated.
 func (s *SubsonicConnection) RemoveCacheEntry(key string) {
-	delete(directoryCache, key)
+	s.library.expire(idKey(key))
+}
+
+// SaveCache writes the library cache to disk, so the next start doesn't have
+// to wait for the server.
+func (s *SubsonicConnection) SaveCache() error {
+	return s.library.save()
 }
 
 type Ider interface {
@@ -95,7 +149,7 @@ type ScanStatus struct {
 
 type PlayQueue struct {
 	Current  string           `json:"current"`
-	Position int              `json:"position"`
+	Position int              `json:"position"` // milliseconds
 	Entries  SubsonicEntities `json:"entry"`
 }
 
@@ -128,6 +182,8 @@ type Album struct {
 	Year          int              `json:"year"`
 	Song          SubsonicEntities `json:"song"`
 	CoverArt      string           `json:"coverArt"`
+	// 1-5 stars, 0 if unrated
+	UserRating int `json:"userRating"`
 }
 
 func (s Album) ID() string {
@@ -138,6 +194,17 @@ type Genre struct {
 	Name string `json:"name"`
 }
 
+// SubsonicGenres is the response of getGenres
+type SubsonicGenres struct {
+	Genres []SubsonicGenre `json:"genre"`
+}
+
+type SubsonicGenre struct {
+	Name       string `json:"value"`
+	SongCount  int    `json:"songCount"`
+	AlbumCount int    `json:"albumCount"`
+}
+
 type SubsonicEntity struct {
 	Id          string   `json:"id"`
 	IsDirectory bool     `json:"isDir"`
@@ -151,6 +218,24 @@ type SubsonicEntity struct {
 	DiscNumber  int      `json:"discNumber"`
 	Path        string   `json:"path"`
 	CoverArtId  string   `json:"coverArt"`
+	AlbumId     string   `json:"albumId"`
+	// 1-5 stars, 0 if unrated
+	UserRating int `json:"userRating"`
+
+	// OpenSubsonic
+	ReplayGain ReplayGain `json:"replayGain"`
+}
+
+// ReplayGain values in dB, peaks are linear. The gains are nil if the server
+// doesn't know them, 0 dB is a valid gain.
+// https://opensubsonic.netlify.app/docs/responses/replaygain/
+type ReplayGain struct {
+	TrackGain    *float64 `json:"trackGain"`
+	AlbumGain    *float64 `json:"albumGain"`
+	TrackPeak    float64  `json:"trackPeak"`
+	AlbumPeak    float64  `json:"albumPeak"`
+	BaseGain     float64  `json:"baseGain"`
+	FallbackGain float64  `json:"fallbackGain"`
 }
 
 func (s SubsonicEntity) ID() string {
@@ -210,6 +295,17 @@ func (s SubsonicEntities) Less(i, j int) bool {
 	return s[i].Title < s[j].Title
 }
 
+// AlbumList is the response of getAlbumList2
+type AlbumList struct {
+	Album []Album `json:"album"`
+}
+
+type SubsonicIndexes struct {
+	LastModified    int64           `json:"lastModified"`
+	IgnoredArticles string          `json:"ignoredArticles"`
+	Index           []SubsonicIndex `json:"index"`
+}
+
 type SubsonicIndex struct {
 	Name    string           `json:"name"`
 	Artists []SubsonicArtist `json:"artist"`
@@ -227,13 +323,20 @@ type SubsonicPlaylist struct {
 }
 
 type SubsonicResponse struct {
-	Status        string            `json:"status"`
-	Version       string            `json:"version"`
-	Indexes       []SubsonicIndex   `json:"indexes"`
+	Status  string `json:"status"`
+	Version string `json:"version"`
+	// OpenSubsonic
+	Type                   string                  `json:"type"`
+	ServerVersion          string                  `json:"serverVersion"`
+	OpenSubsonic           bool                    `json:"openSubsonic"`
+	OpenSubsonicExtensions []OpenSubsonicExtension `json:"openSubsonicExtensions"`
+
+	Indexes       SubsonicIndexes   `json:"indexes"`
 	Directory     SubsonicDirectory `json:"directory"`
 	RandomSongs   SubsonicSongs     `json:"randomSongs"`
 	SimilarSongs  SubsonicSongs     `json:"similarSongs"`
 	Starred       SubsonicResults   `json:"starred"`
+	Starred2      SubsonicResults   `json:"starred2"`
 	Playlists     SubsonicPlaylists `json:"playlists"`
 	Playlist      SubsonicPlaylist  `json:"playlist"`
 	Error         SubsonicError     `json:"error"`
@@ -242,6 +345,16 @@ type SubsonicResponse struct {
 	SearchResults SubsonicResults   `json:"searchResult3"`
 	ScanStatus    ScanStatus        `json:"scanStatus"`
 	PlayQueue     PlayQueue         `json:"playQueue"`
+	Lyrics        Lyrics            `json:"lyrics"`
+	LyricsList    LyricsList        `json:"lyricsList"`
+	AlbumList     AlbumList         `json:"albumList2"`
+	Genres        SubsonicGenres    `json:"genres"`
+	SongsByGenre  SubsonicSongs     `json:"songsByGenre"`
+
+	InternetRadioStations InternetRadioStations `json:"internetRadioStations"`
+	Podcasts              Podcasts              `json:"podcasts"`
+	NewestPodcasts        NewestPodcasts        `json:"newestPodcasts"`
+	Bookmarks             Bookmarks             `json:"bookmarks"`
 }
 
 type responseWrapper struct {
@@ -1,10 +1,18 @@
 package service
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/spezifisch/stmps/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestGetResponse(t *testing.T) {
@@ -27,14 +35,14 @@ func TestGetResponse(t *testing.T) {
 			serverStatus: http.StatusBadRequest,
 			serverBody:   `{"Response": {"Success": false}}`,
 			expectError:  true,
-			caller:       "TestCaller",
+			caller:       "func1", // getResponse names its caller, here the t.Run closure
 		},
 		{
 			name:         "Invalid JSON Response",
 			serverStatus: http.StatusOK,
 			serverBody:   `{"Response": {"Success": `,
 			expectError:  true,
-			caller:       "TestCaller",
+			caller:       "func1", // getResponse names its caller, here the t.Run closure
 		},
 		{
 			name:         "Empty Caller",
@@ -57,10 +65,10 @@ func TestGetResponse(t *testing.T) {
 			defer server.Close()
 
 			// Create an instance of SubsonicConnection
-			connection := &SubsonicConnection{}
+			connection := &SubsonicConnection{conf: &utils.Config{}, client: http.DefaultClient}
 
 			// Call the function
-			response, err := connection.getResponse(server.URL)
+			response, err := connection.getResponse(context.Background(), server.URL)
 
 			// Validate the results
 			if tc.expectError {
@@ -85,3 +93,99 @@ func TestGetResponse(t *testing.T) {
 func containsCallerInError(err error, caller string) bool {
 	return err != nil && (caller == "" || strings.Contains(err.Error(), "["+caller+"]"))
 }
+
+func TestGetResponseRetries(t *testing.T) {
+	defer func(delay time.Duration) { retryDelay = delay }(retryDelay)
+	retryDelay = time.Millisecond
+
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/flaky":
+			// fails twice, then works
+			if requests.Add(1) <= 2 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			_, _ = w.Write([]byte(`{"subsonic-response": {"status": "ok"}}`))
+		case "/failed":
+			requests.Add(1)
+			_, _ = w.Write([]byte(`{"subsonic-response": {"status": "failed", "error": {"code": 70, "message": "not found"}}}`))
+		}
+	}))
+	defer server.Close()
+
+	connection := &SubsonicConnection{conf: &utils.Config{RequestRetries: 2}, client: http.DefaultClient}
+	ctx := context.Background()
+
+	response, err := connection.getResponse(ctx, server.URL+"/flaky")
+	require.NoError(t, err)
+	assert.Equal(t, "ok", response.Status)
+	assert.Equal(t, int32(3), requests.Load())
+
+	// requests that change something aren't repeated
+	requests.Store(0)
+	_, err = connection.getResponseOnce(ctx, server.URL+"/flaky")
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), requests.Load())
+
+	// the server answered, repeating won't help
+	requests.Store(0)
+	_, err = connection.getResponse(ctx, server.URL+"/failed")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.Equal(t, int32(1), requests.Load())
+
+	// out of retries
+	requests.Store(-10)
+	_, err = connection.getResponse(ctx, server.URL+"/flaky")
+	assert.ErrorContains(t, err, "unexpected status code: 503")
+	assert.Equal(t, int32(-7), requests.Load())
+}
+
+func TestGetResponseCanceled(t *testing.T) {
+	unblock := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-unblock:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(unblock)
+
+	connection := &SubsonicConnection{conf: &utils.Config{RequestRetries: 2}, client: http.DefaultClient}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := connection.getResponse(ctx, server.URL)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 5*time.Second)
+
+	// client timeouts are retried
+	connection.SetHTTPClient(&http.Client{Timeout: 20 * time.Millisecond})
+	connection.conf.RequestRetries = 1
+	_, err = connection.getResponse(context.Background(), server.URL)
+	assert.ErrorContains(t, err, "Client.Timeout")
+}
+
+type failingTransport struct {
+	requests atomic.Int32
+}
+
+func (f *failingTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	f.requests.Add(1)
+	return nil, errors.New("connection refused")
+}
+
+func TestDetectCapabilitiesUnreachable(t *testing.T) {
+	transport := &failingTransport{}
+	connection := &SubsonicConnection{
+		conf:   &utils.Config{Host: "http://unreachable.invalid"},
+		client: &http.Client{Transport: transport},
+	}
+
+	_, err := connection.DetectCapabilities(context.Background())
+	assert.ErrorContains(t, err, "connection refused")
+	assert.Equal(t, int32(1), transport.requests.Load(), "no ping after a network error")
+}
@@ -0,0 +1,51 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package service
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+)
+
+// Bookmarks is the response of getBookmarks
+// https://www.subsonic.org/pages/api.jsp#getBookmarks
+type Bookmarks struct {
+	Bookmarks []Bookmark `json:"bookmark"`
+}
+
+type Bookmark struct {
+	// milliseconds
+	Position int64          `json:"position"`
+	Comment  string         `json:"comment"`
+	Created  string         `json:"created"`
+	Changed  string         `json:"changed"`
+	Entry    SubsonicEntity `json:"entry"`
+}
+
+// GetBookmarks returns the user's bookmarks with their songs.
+func (c *SubsonicConnection) GetBookmarks(ctx context.Context) (*SubsonicResponse, error) {
+	url := c.buildUrl("/rest/getBookmarks", nil)
+	return c.getResponse(ctx, url)
+}
+
+// CreateBookmark bookmarks the song with ID id at position milliseconds,
+// replacing its previous bookmark. The comment is optional.
+func (c *SubsonicConnection) CreateBookmark(ctx context.Context, id string, position int64, comment string) error {
+	params := url.Values{"id": []string{id}, "position": []string{strconv.FormatInt(position, 10)}}
+	if comment != "" {
+		params.Set("comment", comment)
+	}
+	url := c.buildUrl("/rest/createBookmark", params)
+	_, err := c.getResponseOnce(ctx, url)
+	return err
+}
+
+// DeleteBookmark removes the bookmark of the song with ID id.
+func (c *SubsonicConnection) DeleteBookmark(ctx context.Context, id string) error {
+	params := url.Values{"id": []string{id}}
+	url := c.buildUrl("/rest/deleteBookmark", params)
+	_, err := c.getResponseOnce(ctx, url)
+	return err
+}
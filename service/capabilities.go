@@ -0,0 +1,111 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package service
+
+import (
+	"context"
+	"slices"
+)
+
+// OpenSubsonic extensions optional features depend on
+// https://opensubsonic.netlify.app/docs/extensions/
+const (
+	// credentials are sent as apiKey instead of user name and password
+	ExtensionAPIKeyAuth = "apiKeyAuthentication"
+	// parameters can be sent as form POST body, so they don't end up in logs
+	ExtensionFormPost = "formPost"
+	// getLyricsBySongId with synced lyrics
+	ExtensionSongLyrics = "songLyrics"
+	// transcoded streams can start at an offset, for seeking
+	ExtensionTranscodeOffset = "transcodeOffset"
+)
+
+// Capabilities describes the server and what it supports.
+type Capabilities struct {
+	// e.g. "navidrome" and its version, only sent by OpenSubsonic servers
+	ServerType    string
+	ServerVersion string
+	// Subsonic API version
+	APIVersion   string
+	OpenSubsonic bool
+	// supported extensions and their versions
+	Extensions map[string][]int
+}
+
+// OpenSubsonicExtension is an entry of getOpenSubsonicExtensions.
+type OpenSubsonicExtension struct {
+	Name     string `json:"name"`
+	Versions []int  `json:"versions"`
+}
+
+// Supports tells whether the server supports the OpenSubsonic extension
+// name in any version.
+func (c Capabilities) Supports(name string) bool {
+	return len(c.Extensions[name]) > 0
+}
+
+// SupportsVersion tells whether the server supports version of the
+// OpenSubsonic extension name.
+func (c Capabilities) SupportsVersion(name string, version int) bool {
+	return slices.Contains(c.Extensions[name], version)
+}
+
+// DetectCapabilities finds out what the server supports and checks the
+// credentials. Optional features are only used once the server reported
+// them, so it should be called before other requests.
+func (c *SubsonicConnection) DetectCapabilities(ctx context.Context) (Capabilities, error) {
+	var capabilities Capabilities
+
+	// the endpoint works without credentials, they may depend on it. Plain
+	// Subsonic servers don't know it.
+	url := c.buildUrl("/rest/getOpenSubsonicExtensions", nil)
+	resp, err := c.getResponse(ctx, url)
+	if err == nil && resp.OpenSubsonic {
+		capabilities.OpenSubsonic = true
+		capabilities.Extensions = map[string][]int{}
+		for _, extension := range resp.OpenSubsonicExtensions {
+			capabilities.Extensions[extension.Name] = extension.Versions
+		}
+		c.setCapabilities(capabilities)
+	} else if ctx.Err() != nil || isNetworkError(err) {
+		// the server is unreachable, pinging it would only wait longer
+		return capabilities, err
+	}
+
+	resp, err = c.GetServerInfo(ctx)
+	if err != nil {
+		return capabilities, err
+	}
+	capabilities.ServerType = resp.Type
+	capabilities.ServerVersion = resp.ServerVersion
+	capabilities.APIVersion = resp.Version
+	capabilities.OpenSubsonic = capabilities.OpenSubsonic || resp.OpenSubsonic
+	c.setCapabilities(capabilities)
+	return capabilities, nil
+}
+
+// Capabilities returns what DetectCapabilities found out, nothing is
+// supported before it was called.
+func (c *SubsonicConnection) Capabilities() Capabilities {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.capabilities
+}
+
+func (c *SubsonicConnection) setCapabilities(capabilities Capabilities) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.capabilities = capabilities
+}
+
+// UsesAPIKey tells whether requests are authenticated with the configured
+// API key instead of user name and password. Without a password it's used
+// even if the server wasn't asked for its extensions yet.
+func (c *SubsonicConnection) UsesAPIKey() bool {
+	conf := c.Conf()
+	if conf.APIKey == "" {
+		return false
+	}
+	return conf.Password == "" || c.Capabilities().Supports(ExtensionAPIKeyAuth)
+}
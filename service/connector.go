@@ -1,3 +1,97 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
 package service
 
-type Connector interface{}
+import (
+	"context"
+	"image"
+
+	"github.com/spezifisch/stmps/utils"
+)
+
+// Connector is the set of server operations the UI depends on. It is
+// implemented by SubsonicConnection; fakes, caching decorators and alternate
+// backends can be plugged in by implementing it as well.
+//
+// Requests are canceled when their ctx is done.
+type Connector interface {
+	Conf() *utils.Config
+
+	// server
+	GetServerInfo(ctx context.Context) (*SubsonicResponse, error)
+	DetectCapabilities(ctx context.Context) (Capabilities, error)
+	Capabilities() Capabilities
+	UsesAPIKey() bool
+	StartScan(ctx context.Context) error
+
+	// library browsing
+	GetIndexes(ctx context.Context) (*SubsonicResponse, error)
+	RevalidateIndexes(ctx context.Context) (resp *SubsonicResponse, changed bool, err error)
+	GetArtist(ctx context.Context, id string) (*SubsonicResponse, error)
+	GetAlbum(ctx context.Context, id string) (*SubsonicResponse, error)
+	GetMusicDirectory(ctx context.Context, id string) (*SubsonicResponse, error)
+	GetCoverArt(ctx context.Context, id string, size int) (image.Image, error)
+	GetAlbumList(ctx context.Context, query AlbumListQuery) (*SubsonicResponse, error)
+	GetGenres(ctx context.Context) (*SubsonicResponse, error)
+	GetSongsByGenre(ctx context.Context, genre string, count, offset int) (*SubsonicResponse, error)
+	GetRandomSongs(ctx context.Context, id string, randomType string) (*SubsonicResponse, error)
+	Search(ctx context.Context, searchTerm string, artistOffset, albumOffset, songOffset int) (*SubsonicResponse, error)
+	GetLyrics(ctx context.Context, id, artist, title string) (*StructuredLyrics, error)
+	ClearCache()
+	RemoveCacheEntry(key string)
+	SaveCache() error
+
+	// playlists
+	GetPlaylists(ctx context.Context) (*SubsonicResponse, error)
+	GetPlaylist(ctx context.Context, id string) (*SubsonicResponse, error)
+	CreatePlaylist(ctx context.Context, id, name string, songIds []string) (*SubsonicResponse, error)
+	DeletePlaylist(ctx context.Context, id string) error
+	AddSongToPlaylist(ctx context.Context, playlistId string, songId string) error
+	RemoveSongFromPlaylist(ctx context.Context, playlistId string, songIndex int) error
+
+	// annotation
+	GetStarred(ctx context.Context) (*SubsonicResponse, error)
+	GetStarred2(ctx context.Context) (*SubsonicResponse, error)
+	ToggleStar(ctx context.Context, kind, id string, starredItems map[string]struct{}) (*SubsonicResponse, error)
+	SetRating(ctx context.Context, id string, rating int) error
+	ScrobbleSubmission(ctx context.Context, id string, isSubmission bool) (*SubsonicResponse, error)
+
+	// internet radio
+	GetInternetRadioStations(ctx context.Context) (*SubsonicResponse, error)
+	CreateInternetRadioStation(ctx context.Context, name, streamUrl, homePageUrl string) error
+	UpdateInternetRadioStation(ctx context.Context, id, name, streamUrl, homePageUrl string) error
+	DeleteInternetRadioStation(ctx context.Context, id string) error
+
+	// podcasts
+	GetPodcasts(ctx context.Context, id string, includeEpisodes bool) (*SubsonicResponse, error)
+	GetNewestPodcasts(ctx context.Context, count int) (*SubsonicResponse, error)
+	RefreshPodcasts(ctx context.Context) error
+	CreatePodcastChannel(ctx context.Context, feedUrl string) error
+	DeletePodcastChannel(ctx context.Context, id string) error
+	DownloadPodcastEpisode(ctx context.Context, id string) error
+	DeletePodcastEpisode(ctx context.Context, id string) error
+
+	// bookmarks
+	GetBookmarks(ctx context.Context) (*SubsonicResponse, error)
+	CreateBookmark(ctx context.Context, id string, position int64, comment string) error
+	DeleteBookmark(ctx context.Context, id string) error
+
+	// offline cache
+	OfflineMarks() []OfflineMark
+	IsMarkedOffline(kind, id string) bool
+	IsOffline(id string) bool
+	MarkOffline(ctx context.Context, kind, id, name string) error
+	UnmarkOffline(kind, id string) error
+	SyncOffline(ctx context.Context, progress func(done, total int)) error
+
+	// playback
+	GetPlayUrl(entity *SubsonicEntity) string
+	GetPlayUrlAt(entity *SubsonicEntity, position int64) string
+	StreamProfile() utils.StreamProfile
+	SetStreamProfile(profile utils.StreamProfile)
+	SavePlayQueue(ctx context.Context, queueIds []string, current string, position int) error
+	LoadPlayQueue(ctx context.Context) (*SubsonicResponse, error)
+}
+
+var _ Connector = (*SubsonicConnection)(nil)
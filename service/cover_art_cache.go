@@ -0,0 +1,217 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package service
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// coverArtCache keeps the most recently used cover arts decoded in memory and
+// the downloaded files on disk, so they survive restarts.
+type coverArtCache struct {
+	mu sync.Mutex
+
+	// in memory LRU, front is the most recently used
+	maxEntries int
+	entries    map[string]*list.Element
+	order      *list.List
+
+	// disk cache, disabled if dir is empty
+	dir          string
+	maxDiskBytes int64
+}
+
+type coverArtEntry struct {
+	key string
+	// nil for cover arts the server couldn't deliver
+	art image.Image
+}
+
+// coverArtFileExt marks complete files, temporary ones don't have it
+const coverArtFileExt = ".art"
+
+func newCoverArtCache(maxEntries int, dir string, maxDiskBytes int64) *coverArtCache {
+	return &coverArtCache{
+		maxEntries:   max(maxEntries, 1),
+		entries:      map[string]*list.Element{},
+		order:        list.New(),
+		dir:          dir,
+		maxDiskBytes: maxDiskBytes,
+	}
+}
+
+func coverArtKey(id string, size int) string {
+	return fmt.Sprintf("%s@%d", id, size)
+}
+
+// get returns the cover art from memory or disk. ok is false if it has to be
+// fetched from the server.
+func (c *coverArtCache) get(id string, size int) (art image.Image, ok bool) {
+	key := coverArtKey(id, size)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		c.order.MoveToFront(element)
+		return element.Value.(*coverArtEntry).art, true
+	}
+
+	data, err := c.readFile(key)
+	if err != nil {
+		return nil, false
+	}
+	art, _, err = image.Decode(bytes.NewReader(data))
+	if err != nil {
+		// broken file, fetch it again
+		_ = os.Remove(c.path(key))
+		return nil, false
+	}
+	c.remember(key, art)
+	return art, true
+}
+
+// put caches a fetched cover art, data is what the server sent. Cover arts
+// that couldn't be fetched are only remembered in memory with art and data
+// nil.
+func (c *coverArtCache) put(id string, size int, art image.Image, data []byte) error {
+	key := coverArtKey(id, size)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.remember(key, art)
+	if art == nil || c.dir == "" {
+		return nil
+	}
+	if err := c.writeFile(key, data); err != nil {
+		return err
+	}
+	return c.evictFiles()
+}
+
+func (c *coverArtCache) remember(key string, art image.Image) {
+	if element, ok := c.entries[key]; ok {
+		element.Value.(*coverArtEntry).art = art
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&coverArtEntry{key, art})
+	for c.order.Len() > c.maxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*coverArtEntry).key)
+	}
+}
+
+// clear forgets the cover arts in memory, the files stay.
+func (c *coverArtCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = map[string]*list.Element{}
+	c.order.Init()
+}
+
+// path returns the file for key, IDs are hashed as they can contain anything.
+func (c *coverArtCache) path(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(hash[:])+coverArtFileExt)
+}
+
+func (c *coverArtCache) readFile(key string) ([]byte, error) {
+	if c.dir == "" {
+		return nil, fs.ErrNotExist
+	}
+	path := c.path(key)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	// the modification time orders the files for eviction
+	now := time.Now()
+	_ = os.Chtimes(path, now, now)
+	return data, nil
+}
+
+func (c *coverArtCache) writeFile(key string, data []byte) error {
+	if err := os.MkdirAll(c.dir, 0o700); err != nil {
+		return err
+	}
+
+	// write to a temporary file first, so there are no partial files
+	tmp, err := os.CreateTemp(c.dir, "tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), c.path(key))
+}
+
+// evictFiles deletes the least recently used files until they fit into
+// maxDiskBytes.
+func (c *coverArtCache) evictFiles() error {
+	dirEntries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return err
+	}
+
+	type file struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+	var files []file
+	var total int64
+	for _, entry := range dirEntries {
+		if !strings.HasSuffix(entry.Name(), coverArtFileExt) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			// removed in the meantime
+			continue
+		}
+		files = append(files, file{filepath.Join(c.dir, entry.Name()), info.Size(), info.ModTime()})
+		total += info.Size()
+	}
+
+	slices.SortFunc(files, func(a, b file) int {
+		return a.modTime.Compare(b.modTime)
+	})
+	var errs []error
+	for _, f := range files {
+		if total <= c.maxDiskBytes {
+			break
+		}
+		if err := os.Remove(f.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			errs = append(errs, err)
+			continue
+		}
+		total -= f.size
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,97 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package service
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testCoverArt(t *testing.T, width int) (image.Image, []byte) {
+	art := image.NewGray(image.Rect(0, 0, width, 1))
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, art))
+	return art, buf.Bytes()
+}
+
+func cachedFiles(t *testing.T, dir string) []string {
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	var names []string
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), coverArtFileExt) {
+			names = append(names, entry.Name())
+		}
+	}
+	return names
+}
+
+func TestCoverArtCacheMemoryLRU(t *testing.T) {
+	cache := newCoverArtCache(2, "", 0)
+	art, _ := testCoverArt(t, 1)
+
+	require.NoError(t, cache.put("a", 0, art, nil))
+	require.NoError(t, cache.put("b", 0, art, nil))
+	// a is used more recently than b now
+	_, ok := cache.get("a", 0)
+	assert.True(t, ok)
+
+	require.NoError(t, cache.put("c", 0, art, nil))
+	_, ok = cache.get("b", 0)
+	assert.False(t, ok, "least recently used is evicted")
+	_, ok = cache.get("a", 0)
+	assert.True(t, ok)
+	_, ok = cache.get("a", 100)
+	assert.False(t, ok, "sizes are cached separately")
+
+	// failures are remembered as nil
+	require.NoError(t, cache.put("missing", 0, nil, nil))
+	missing, ok := cache.get("missing", 0)
+	assert.True(t, ok)
+	assert.Nil(t, missing)
+}
+
+func TestCoverArtCacheDisk(t *testing.T) {
+	dir := t.TempDir()
+	art, data := testCoverArt(t, 10)
+	maxBytes := int64(len(data)*2 + len(data)/2)
+
+	cache := newCoverArtCache(10, dir, maxBytes)
+	require.NoError(t, cache.put("a", 0, art, data))
+	require.NoError(t, cache.put("b", 0, art, data))
+	assert.Len(t, cachedFiles(t, dir), 2)
+
+	// survives restarts
+	cache = newCoverArtCache(10, dir, maxBytes)
+	loaded, ok := cache.get("a", 0)
+	require.True(t, ok)
+	assert.Equal(t, art.Bounds(), loaded.Bounds())
+
+	// make b the oldest file, reading a touched it already
+	old := time.Now().Add(-time.Hour)
+	require.NoError(t, os.Chtimes(cache.path(coverArtKey("b", 0)), old, old))
+
+	// the third file doesn't fit
+	require.NoError(t, cache.put("c", 0, art, data))
+	assert.Len(t, cachedFiles(t, dir), 2)
+	_, err := os.Stat(cache.path(coverArtKey("b", 0)))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	// broken files are dropped
+	path := cache.path(coverArtKey("a", 0))
+	require.NoError(t, os.WriteFile(path, []byte("garbage"), 0o600))
+	cache.clear()
+	_, ok = cache.get("a", 0)
+	assert.False(t, ok)
+	_, err = os.Stat(path)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
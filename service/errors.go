@@ -0,0 +1,84 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net"
+)
+
+// Subsonic API error codes
+// https://www.subsonic.org/pages/api.jsp#error
+const (
+	ErrorCodeGeneric               = 0
+	ErrorCodeMissingParameter      = 10
+	ErrorCodeClientTooOld          = 20
+	ErrorCodeServerTooOld          = 30
+	ErrorCodeWrongCredentials      = 40
+	ErrorCodeTokenAuthNotSupported = 41
+	// OpenSubsonic
+	ErrorCodeAuthNotSupported = 42
+	ErrorCodeConflictingAuth  = 43
+	ErrorCodeInvalidAPIKey    = 44
+	ErrorCodeNotAuthorized    = 50
+	ErrorCodeTrialExpired     = 60
+	ErrorCodeNotFound         = 70
+)
+
+// APIError codes can be checked with errors.Is against these.
+var (
+	ErrAuthFailed    = errors.New("authentication failed")
+	ErrNotAuthorized = errors.New("not authorized")
+	ErrNotFound      = errors.New("not found")
+	ErrClientTooOld  = errors.New("client too old")
+)
+
+// APIError is a "failed" response from the server.
+type APIError struct {
+	// name of the connector method that made the request
+	Caller  string
+	Code    int
+	Message string
+}
+
+func newAPIError(caller string, subsonicError SubsonicError) *APIError {
+	return &APIError{
+		Caller:  caller,
+		Code:    subsonicError.Code,
+		Message: subsonicError.Message,
+	}
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("[%s] subsonic error %d: %s", e.Caller, e.Code, e.Message)
+}
+
+// Is matches the sentinel errors for the standard error codes.
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrAuthFailed:
+		// token auth isn't supported for LDAP users, plaintext auth is needed
+		switch e.Code {
+		case ErrorCodeWrongCredentials, ErrorCodeTokenAuthNotSupported,
+			ErrorCodeAuthNotSupported, ErrorCodeInvalidAPIKey:
+			return true
+		}
+		return false
+	case ErrNotAuthorized:
+		return e.Code == ErrorCodeNotAuthorized
+	case ErrNotFound:
+		return e.Code == ErrorCodeNotFound
+	case ErrClientTooOld:
+		return e.Code == ErrorCodeClientTooOld
+	}
+	return false
+}
+
+// isNetworkError tells whether err means the server couldn't be reached or
+// didn't answer in time.
+func isNetworkError(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
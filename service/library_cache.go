@@ -0,0 +1,208 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// libraryCacheVersion is bumped when the file format changes, older files
+// are ignored
+const libraryCacheVersion = 1
+
+// cache keys
+const (
+	libraryKeyIndexes   = "indexes"
+	libraryKeyArtist    = "artist/"
+	libraryKeyAlbum     = "album/"
+	libraryKeyDirectory = "directory/"
+)
+
+// libraryCache keeps the responses of the library browsing requests with the
+// time they were fetched. It is saved to a file, so the library can be
+// browsed right after starting, and is revalidated from there.
+type libraryCache struct {
+	mu sync.Mutex
+
+	// no persistence if path is empty
+	path string
+	// host and user the entries belong to
+	server string
+	// entries older than ttl are refetched, 0 keeps them forever
+	ttl time.Duration
+
+	entries map[string]*libraryEntry
+	// changed since loading or saving
+	dirty bool
+}
+
+type libraryEntry struct {
+	Response SubsonicResponse `json:"response"`
+	Fetched  time.Time        `json:"fetched"`
+}
+
+type libraryCacheFile struct {
+	Version int                      `json:"version"`
+	Server  string                   `json:"server"`
+	Entries map[string]*libraryEntry `json:"entries"`
+}
+
+func newLibraryCache(path, server string, ttl time.Duration) *libraryCache {
+	return &libraryCache{
+		path:    path,
+		server:  server,
+		ttl:     ttl,
+		entries: map[string]*libraryEntry{},
+	}
+}
+
+// load reads the file saved before, a missing file is no error.
+func (c *libraryCache) load() error {
+	if c.path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(c.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var file libraryCacheFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return err
+	}
+	if file.Version != libraryCacheVersion || file.Server != c.server {
+		// will be overwritten when saving
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, entry := range file.Entries {
+		if entry != nil {
+			c.entries[key] = entry
+		}
+	}
+	return nil
+}
+
+// save writes the entries to the file if they changed.
+func (c *libraryCache) save() error {
+	if c.path == "" {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.dirty {
+		return nil
+	}
+	data, err := json.Marshal(libraryCacheFile{
+		Version: libraryCacheVersion,
+		Server:  c.server,
+		Entries: c.entries,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o700); err != nil {
+		return err
+	}
+	// write to a temporary file first, so a crash doesn't leave a broken cache
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		return err
+	}
+	c.dirty = false
+	return nil
+}
+
+// get returns the cached response for key. fresh is false if it is older
+// than the TTL or expired and should be refetched.
+func (c *libraryCache) get(key string) (response SubsonicResponse, fresh, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return SubsonicResponse{}, false, false
+	}
+	// expired entries have no time
+	fresh = !entry.Fetched.IsZero() && (c.ttl <= 0 || time.Since(entry.Fetched) < c.ttl)
+	return entry.Response, fresh, true
+}
+
+func (c *libraryCache) put(key string, response SubsonicResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[key] = &libraryEntry{Response: response, Fetched: time.Now()}
+	c.dirty = true
+}
+
+// touch marks the entry of key as fetched now, after the server confirmed
+// it's still up to date.
+func (c *libraryCache) touch(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if entry, ok := c.entries[key]; ok {
+		entry.Fetched = time.Now()
+		c.dirty = true
+	}
+}
+
+// expire marks the entries matching key as outdated, they are refetched
+// when they're requested the next time. Until then they are kept in case
+// the server can't be reached.
+func (c *libraryCache) expire(match func(key string) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, entry := range c.entries {
+		if match(key) {
+			entry.Fetched = time.Time{}
+			c.dirty = true
+		}
+	}
+}
+
+func notIndexesKey(key string) bool {
+	return key != libraryKeyIndexes
+}
+
+func anyKey(string) bool {
+	return true
+}
+
+// idKey returns a matcher for the entries of id, whatever it was requested
+// as.
+func idKey(id string) func(key string) bool {
+	return func(key string) bool {
+		for _, prefix := range []string{libraryKeyArtist, libraryKeyAlbum, libraryKeyDirectory} {
+			if key == prefix+id {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// libraryServer identifies whose library is cached, libraries of different
+// servers or users aren't mixed up.
+func libraryServer(host, username string) string {
+	return username + "@" + strings.TrimSuffix(host, "/")
+}
@@ -0,0 +1,64 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package service
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLibraryCacheFreshness(t *testing.T) {
+	cache := newLibraryCache("", "", time.Hour)
+	cache.put(libraryKeyIndexes, SubsonicResponse{Status: "ok"})
+	cache.put(libraryKeyArtist+"ar-1", SubsonicResponse{Status: "ok"})
+
+	_, fresh, ok := cache.get(libraryKeyArtist + "ar-1")
+	assert.True(t, ok)
+	assert.True(t, fresh)
+	_, _, ok = cache.get(libraryKeyAlbum + "ar-1")
+	assert.False(t, ok)
+
+	cache.entries[libraryKeyArtist+"ar-1"].Fetched = time.Now().Add(-2 * time.Hour)
+	_, fresh, ok = cache.get(libraryKeyArtist + "ar-1")
+	assert.True(t, ok)
+	assert.False(t, fresh, "older than the TTL")
+
+	cache.touch(libraryKeyArtist + "ar-1")
+	_, fresh, _ = cache.get(libraryKeyArtist + "ar-1")
+	assert.True(t, fresh)
+
+	// expired entries are outdated even without TTL
+	cache.ttl = 0
+	cache.expire(notIndexesKey)
+	_, fresh, _ = cache.get(libraryKeyArtist + "ar-1")
+	assert.False(t, fresh)
+	_, fresh, _ = cache.get(libraryKeyIndexes)
+	assert.True(t, fresh)
+}
+
+func TestLibraryCacheFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stmps", "library.json")
+	cache := newLibraryCache(path, libraryServer("http://localhost/", "me"), time.Hour)
+	require.NoError(t, cache.load(), "missing files are no error")
+
+	cache.put(libraryKeyAlbum+"al-1", SubsonicResponse{Album: Album{Id: "al-1", Name: "Amber"}})
+	require.NoError(t, cache.save())
+
+	loaded := newLibraryCache(path, libraryServer("http://localhost", "me"), time.Hour)
+	require.NoError(t, loaded.load())
+	response, fresh, ok := loaded.get(libraryKeyAlbum + "al-1")
+	require.True(t, ok)
+	assert.True(t, fresh)
+	assert.Equal(t, "Amber", response.Album.Name)
+
+	// libraries of other users are ignored
+	other := newLibraryCache(path, libraryServer("http://localhost", "you"), time.Hour)
+	require.NoError(t, other.load())
+	_, _, ok = other.get(libraryKeyAlbum + "al-1")
+	assert.False(t, ok)
+}
@@ -0,0 +1,107 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package service
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// LyricsList is the response of OpenSubsonic's getLyricsBySongId, one entry
+// per language or version
+// https://opensubsonic.netlify.app/docs/responses/lyricslist/
+type LyricsList struct {
+	StructuredLyrics []StructuredLyrics `json:"structuredLyrics"`
+}
+
+type StructuredLyrics struct {
+	DisplayArtist string `json:"displayArtist"`
+	DisplayTitle  string `json:"displayTitle"`
+	Lang          string `json:"lang"`
+	// milliseconds, positive values show the lines earlier
+	Offset int         `json:"offset"`
+	Synced bool        `json:"synced"`
+	Lines  []LyricLine `json:"line"`
+}
+
+type LyricLine struct {
+	// milliseconds from the start of the song, only set for synced lyrics
+	Start int    `json:"start"`
+	Value string `json:"value"`
+}
+
+// Lyrics is the response of the classic getLyrics, unsynced text
+type Lyrics struct {
+	Artist string `json:"artist"`
+	Title  string `json:"title"`
+	Value  string `json:"value"`
+}
+
+// LineAt returns the index of the line sung at position, -1 before the first
+// line or if the lyrics aren't synced.
+func (l *StructuredLyrics) LineAt(position time.Duration) int {
+	if !l.Synced {
+		return -1
+	}
+	ms := int(position.Milliseconds()) + l.Offset
+	// lines are sorted by start time
+	return sort.Search(len(l.Lines), func(i int) bool {
+		return l.Lines[i].Start > ms
+	}) - 1
+}
+
+// GetLyrics returns the lyrics of a song, nil if the server has none. Synced
+// lyrics are preferred if the server supports OpenSubsonic's songLyrics,
+// otherwise they are looked up by artist and title.
+func (c *SubsonicConnection) GetLyrics(ctx context.Context, id, artist, title string) (*StructuredLyrics, error) {
+	if c.Capabilities().Supports(ExtensionSongLyrics) {
+		params := url.Values{"id": []string{id}}
+		url := c.buildUrl("/rest/getLyricsBySongId", params)
+		resp, err := c.getResponse(ctx, url)
+		if err != nil {
+			return nil, err
+		}
+		if lyrics := pickLyrics(resp.LyricsList.StructuredLyrics); lyrics != nil {
+			return lyrics, nil
+		}
+	}
+
+	params := url.Values{"artist": []string{artist}, "title": []string{title}}
+	url := c.buildUrl("/rest/getLyrics", params)
+	resp, err := c.getResponse(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	text := strings.TrimSpace(strings.ReplaceAll(resp.Lyrics.Value, "\r\n", "\n"))
+	if text == "" {
+		return nil, nil
+	}
+	lyrics := &StructuredLyrics{
+		DisplayArtist: resp.Lyrics.Artist,
+		DisplayTitle:  resp.Lyrics.Title,
+	}
+	for _, line := range strings.Split(text, "\n") {
+		lyrics.Lines = append(lyrics.Lines, LyricLine{Value: line})
+	}
+	return lyrics, nil
+}
+
+// pickLyrics returns the first synced lyrics, or the first ones if none are
+// synced.
+func pickLyrics(list []StructuredLyrics) *StructuredLyrics {
+	for i := range list {
+		if list[i].Synced && len(list[i].Lines) > 0 {
+			return &list[i]
+		}
+	}
+	for i := range list {
+		if len(list[i].Lines) > 0 {
+			return &list[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLyricsLineAt(t *testing.T) {
+	lyrics := StructuredLyrics{
+		Synced: true,
+		Lines: []LyricLine{
+			{Start: 1000, Value: "first"},
+			{Start: 5000, Value: "second"},
+			{Start: 9000, Value: "third"},
+		},
+	}
+
+	assert.Equal(t, -1, lyrics.LineAt(0))
+	assert.Equal(t, 0, lyrics.LineAt(time.Second))
+	assert.Equal(t, 0, lyrics.LineAt(4999*time.Millisecond))
+	assert.Equal(t, 1, lyrics.LineAt(5*time.Second))
+	assert.Equal(t, 2, lyrics.LineAt(time.Minute))
+
+	// positive offsets show lines earlier
+	lyrics.Offset = 500
+	assert.Equal(t, 1, lyrics.LineAt(4500*time.Millisecond))
+
+	lyrics.Synced = false
+	assert.Equal(t, -1, lyrics.LineAt(time.Minute))
+}
+
+func TestPickLyrics(t *testing.T) {
+	unsynced := StructuredLyrics{Lang: "en", Lines: []LyricLine{{Value: "a"}}}
+	synced := StructuredLyrics{Lang: "en", Synced: true, Lines: []LyricLine{{Start: 0, Value: "a"}}}
+	empty := StructuredLyrics{Synced: true}
+
+	assert.Nil(t, pickLyrics(nil))
+	assert.Nil(t, pickLyrics([]StructuredLyrics{empty}))
+	assert.Equal(t, &unsynced, pickLyrics([]StructuredLyrics{empty, unsynced}))
+	assert.True(t, pickLyrics([]StructuredLyrics{unsynced, synced}).Synced)
+}
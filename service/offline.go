@@ -0,0 +1,199 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// ErrOfflineDisabled is returned when marking something available offline
+// while the offline cache has no directory or size.
+var ErrOfflineDisabled = errors.New("offline cache is disabled")
+
+// OfflineMarks returns everything marked available offline.
+func (c *SubsonicConnection) OfflineMarks() []OfflineMark {
+	return c.offline.getMarks()
+}
+
+// IsMarkedOffline reports whether the directory, playlist or song with ID id
+// is marked available offline.
+func (c *SubsonicConnection) IsMarkedOffline(kind, id string) bool {
+	return c.offline.isMarked(kind, id)
+}
+
+// IsOffline reports whether the song with ID id is downloaded, it's played
+// from the local file then.
+func (c *SubsonicConnection) IsOffline(id string) bool {
+	_, ok := c.offline.file(id)
+	return ok
+}
+
+// MarkOffline marks the directory, playlist or song with ID id available
+// offline, name is shown for it. Its songs are downloaded by SyncOffline.
+func (c *SubsonicConnection) MarkOffline(ctx context.Context, kind, id, name string) error {
+	if !c.offline.enabled() {
+		return ErrOfflineDisabled
+	}
+	songIds, err := c.offlineSongIds(ctx, kind, id)
+	if err != nil {
+		return err
+	}
+	return c.offline.setMark(OfflineMark{Kind: kind, Id: id, Name: name, SongIds: songIds})
+}
+
+// UnmarkOffline removes the mark of the directory, playlist or song with ID
+// id. Its songs are deleted unless another mark needs them.
+func (c *SubsonicConnection) UnmarkOffline(kind, id string) error {
+	return c.offline.removeMark(kind, id)
+}
+
+// SyncOffline updates the songs of the marked directories and playlists,
+// downloads the missing ones and deletes those that aren't marked anymore.
+// Directories and playlists deleted on the server are unmarked.
+// progress is called after each download with the number of songs done and
+// the total. Songs that fail are skipped and their errors returned, syncing
+// stops when the cache is full.
+func (c *SubsonicConnection) SyncOffline(ctx context.Context, progress func(done, total int)) error {
+	if !c.offline.enabled() {
+		return nil
+	}
+
+	var errs []error
+	for _, mark := range c.offline.getMarks() {
+		if mark.Kind == OfflineSong {
+			continue
+		}
+		songIds, err := c.offlineSongIds(ctx, mark.Kind, mark.Id)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		} else if errors.Is(err, ErrNotFound) {
+			// deleted on the server
+			if err := c.offline.removeMark(mark.Kind, mark.Id); err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		} else if err != nil {
+			// the songs synced last are kept
+			errs = append(errs, err)
+			continue
+		}
+		if !slices.Equal(songIds, mark.SongIds) && c.offline.isMarked(mark.Kind, mark.Id) {
+			mark.SongIds = songIds
+			if err := c.offline.setMark(mark); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	if err := c.offline.prune(); err != nil {
+		errs = append(errs, err)
+	}
+
+	missing := c.offline.missing()
+	for i, id := range missing {
+		err := c.downloadSong(ctx, id)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		} else if errors.Is(err, ErrOfflineCacheFull) {
+			errs = append(errs, err)
+			break
+		} else if err != nil {
+			errs = append(errs, err)
+		}
+		if progress != nil {
+			progress(i+1, len(missing))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// offlineSongIds returns the songs of the directory, including those in its
+// subdirectories, playlist or song with ID id.
+func (c *SubsonicConnection) offlineSongIds(ctx context.Context, kind, id string) ([]string, error) {
+	switch kind {
+	case OfflineSong:
+		return []string{id}, nil
+
+	case OfflineAlbum:
+		response, err := c.GetAlbum(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		var songIds []string
+		for _, entity := range response.Album.Song {
+			songIds = append(songIds, entity.Id)
+		}
+		return songIds, nil
+
+	case OfflinePlaylist:
+		response, err := c.GetPlaylist(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		var songIds []string
+		for _, entity := range response.Playlist.Entries {
+			songIds = append(songIds, entity.Id)
+		}
+		return songIds, nil
+
+	case OfflineDirectory:
+		response, err := c.GetMusicDirectory(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		var songIds []string
+		for _, entity := range response.Directory.Entities {
+			if !entity.IsDirectory {
+				songIds = append(songIds, entity.Id)
+				continue
+			}
+			subdirectory, err := c.offlineSongIds(ctx, OfflineDirectory, entity.Id)
+			if err != nil {
+				return nil, err
+			}
+			songIds = append(songIds, subdirectory...)
+		}
+		return songIds, nil
+	}
+	return nil, fmt.Errorf("unknown offline mark kind %q", kind)
+}
+
+// downloadSong saves the original file of the song with ID id to the offline
+// cache.
+func (c *SubsonicConnection) downloadSong(ctx context.Context, id string) error {
+	caller := "downloadSong"
+	params := url.Values{"id": []string{id}}
+	req, err := c.baseRequest(ctx, caller, http.MethodGet, c.buildUrl("/rest/download", params), nil)
+	if err != nil {
+		return err
+	}
+
+	// songs take longer than the request timeout, ctx still cancels them
+	client := *c.client
+	client.Timeout = 0
+	res, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("[%s] failed to make GET request: %w", caller, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("[%s] unexpected status code: %d, status: %s", caller, res.StatusCode, res.Status)
+	}
+	if strings.HasPrefix(res.Header.Get("Content-Type"), "application/json") {
+		// the server sends a Subsonic error instead of the song
+		var decodedBody responseWrapper
+		if err := json.NewDecoder(res.Body).Decode(&decodedBody); err != nil {
+			return fmt.Errorf("[%s] failed to unmarshal response body: %v", caller, err)
+		}
+		return newAPIError(caller, decodedBody.Response.Error)
+	}
+	return c.offline.store(id, res.Body)
+}
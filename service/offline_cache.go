@@ -0,0 +1,364 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// kinds of offline marks
+const (
+	OfflineDirectory = "directory"
+	// ID3 albums, e.g. of the album lists
+	OfflineAlbum    = "album"
+	OfflinePlaylist = "playlist"
+	OfflineSong     = "song"
+)
+
+// OfflineMark is a directory, album, playlist or song marked available
+// offline.
+type OfflineMark struct {
+	Kind string `json:"kind"`
+	Id   string `json:"id"`
+	Name string `json:"name"`
+	// the songs it consisted of when it was synced last
+	SongIds []string `json:"songIds"`
+}
+
+// ErrOfflineCacheFull is returned for songs that don't fit into the offline
+// cache's size limit.
+var ErrOfflineCacheFull = errors.New("offline cache is full")
+
+// offlineCacheVersion is bumped when the index format changes, older indexes
+// are ignored
+const offlineCacheVersion = 1
+
+const (
+	// offlineFileExt marks complete files, temporary ones don't have it
+	offlineFileExt   = ".song"
+	offlineIndexName = "offline.json"
+)
+
+// offlineCache keeps the songs of everything marked available offline on
+// disk. Songs are only downloaded while they fit into maxBytes, nothing is
+// evicted to make room.
+type offlineCache struct {
+	mu sync.Mutex
+
+	// disabled if dir is empty
+	dir      string
+	maxBytes int64
+	// host and user the songs belong to
+	server string
+
+	marks []OfflineMark
+	// sizes of the downloaded songs by their ID
+	files map[string]int64
+}
+
+type offlineIndexFile struct {
+	Version int           `json:"version"`
+	Server  string        `json:"server"`
+	Marks   []OfflineMark `json:"marks"`
+}
+
+func newOfflineCache(dir string, maxBytes int64, server string) *offlineCache {
+	return &offlineCache{
+		dir:      dir,
+		maxBytes: maxBytes,
+		server:   server,
+		files:    map[string]int64{},
+	}
+}
+
+func (o *offlineCache) enabled() bool {
+	return o.dir != "" && o.maxBytes > 0
+}
+
+// load reads the marks saved before and finds their downloaded songs, a
+// missing index is no error.
+func (o *offlineCache) load() error {
+	if o.dir == "" {
+		return nil
+	}
+	// left by downloads that were interrupted
+	if tmpFiles, err := filepath.Glob(filepath.Join(o.dir, "tmp-*")); err == nil {
+		for _, path := range tmpFiles {
+			_ = os.Remove(path)
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(o.dir, offlineIndexName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var index offlineIndexFile
+	if err := json.Unmarshal(data, &index); err != nil {
+		return err
+	}
+	if index.Version != offlineCacheVersion || index.Server != o.server {
+		// the songs are deleted with the next sync
+		return nil
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.marks = index.Marks
+	for _, id := range o.songIds() {
+		if info, err := os.Stat(o.path(id)); err == nil {
+			o.files[id] = info.Size()
+		}
+	}
+	return nil
+}
+
+// save writes the marks, it's called with mu held.
+func (o *offlineCache) save() error {
+	data, err := json.Marshal(offlineIndexFile{
+		Version: offlineCacheVersion,
+		Server:  o.server,
+		Marks:   o.marks,
+	})
+	if err != nil {
+		return err
+	}
+	return o.writeFile(filepath.Join(o.dir, offlineIndexName), data)
+}
+
+// path returns the file of the song with ID id, IDs are hashed as they can
+// contain anything.
+func (o *offlineCache) path(id string) string {
+	hash := sha256.Sum256([]byte(id))
+	return filepath.Join(o.dir, hex.EncodeToString(hash[:])+offlineFileExt)
+}
+
+// file returns the downloaded file of the song with ID id.
+func (o *offlineCache) file(id string) (path string, ok bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if _, ok := o.files[id]; !ok {
+		return "", false
+	}
+	return o.path(id), true
+}
+
+// getMarks returns a copy of the marks.
+func (o *offlineCache) getMarks() []OfflineMark {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return slices.Clone(o.marks)
+}
+
+func (o *offlineCache) findMark(kind, id string) int {
+	return slices.IndexFunc(o.marks, func(mark OfflineMark) bool {
+		return mark.Kind == kind && mark.Id == id
+	})
+}
+
+func (o *offlineCache) isMarked(kind, id string) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.findMark(kind, id) >= 0
+}
+
+// setMark adds mark or replaces the one of the same directory, playlist or
+// song, e.g. when the songs of a playlist changed.
+func (o *offlineCache) setMark(mark OfflineMark) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if i := o.findMark(mark.Kind, mark.Id); i >= 0 {
+		o.marks[i] = mark
+	} else {
+		o.marks = append(o.marks, mark)
+	}
+	return o.save()
+}
+
+// removeMark unmarks the directory, playlist or song and deletes the songs
+// no other mark needs.
+func (o *offlineCache) removeMark(kind, id string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	i := o.findMark(kind, id)
+	if i < 0 {
+		return nil
+	}
+	o.marks = slices.Delete(o.marks, i, i+1)
+	if err := o.save(); err != nil {
+		return err
+	}
+	return o.removeUnmarked()
+}
+
+// songIds returns the songs of all marks without duplicates, it's called
+// with mu held.
+func (o *offlineCache) songIds() []string {
+	seen := map[string]struct{}{}
+	var ids []string
+	for _, mark := range o.marks {
+		for _, id := range mark.SongIds {
+			if _, ok := seen[id]; !ok {
+				seen[id] = struct{}{}
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
+
+// missing returns the marked songs that aren't downloaded yet.
+func (o *offlineCache) missing() []string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var ids []string
+	for _, id := range o.songIds() {
+		if _, ok := o.files[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// used returns how many bytes the downloaded songs take.
+func (o *offlineCache) used() int64 {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.size()
+}
+
+// size sums up the downloaded songs, it's called with mu held.
+func (o *offlineCache) size() int64 {
+	var total int64
+	for _, size := range o.files {
+		total += size
+	}
+	return total
+}
+
+// store saves the song with ID id read from r. Reading more than what's left
+// of maxBytes fails with ErrOfflineCacheFull.
+func (o *offlineCache) store(id string, r io.Reader) error {
+	free := o.maxBytes - o.used()
+	if free <= 0 {
+		return ErrOfflineCacheFull
+	}
+	if err := os.MkdirAll(o.dir, 0o700); err != nil {
+		return err
+	}
+
+	// songs are large, they aren't kept in memory like cover arts
+	tmp, err := os.CreateTemp(o.dir, "tmp-")
+	if err != nil {
+		return err
+	}
+	size, err := io.Copy(tmp, io.LimitReader(r, free+1))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && size > free {
+		err = ErrOfflineCacheFull
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.size()+size > o.maxBytes {
+		// another song was stored meanwhile
+		os.Remove(tmp.Name())
+		return ErrOfflineCacheFull
+	}
+	if !slices.Contains(o.songIds(), id) {
+		// unmarked during the download
+		os.Remove(tmp.Name())
+		return nil
+	}
+	if err := os.Rename(tmp.Name(), o.path(id)); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	o.files[id] = size
+	return nil
+}
+
+// prune deletes the songs no mark needs, including those of another server.
+func (o *offlineCache) prune() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.removeUnmarked()
+}
+
+// removeUnmarked is prune with mu held.
+func (o *offlineCache) removeUnmarked() error {
+	if o.dir == "" {
+		return nil
+	}
+	dirEntries, err := os.ReadDir(o.dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	wanted := map[string]string{}
+	for _, id := range o.songIds() {
+		wanted[filepath.Base(o.path(id))] = id
+	}
+	var errs []error
+	for _, entry := range dirEntries {
+		name := entry.Name()
+		if _, ok := wanted[name]; ok {
+			continue
+		}
+		if !strings.HasSuffix(name, offlineFileExt) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(o.dir, name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			errs = append(errs, err)
+		}
+	}
+	for id := range o.files {
+		if _, ok := wanted[filepath.Base(o.path(id))]; !ok {
+			delete(o.files, id)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (o *offlineCache) writeFile(path string, data []byte) error {
+	if err := os.MkdirAll(o.dir, 0o700); err != nil {
+		return err
+	}
+
+	// write to a temporary file first, so there are no partial files
+	tmp, err := os.CreateTemp(o.dir, "tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,56 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOfflineCacheServer(t *testing.T) {
+	dir := t.TempDir()
+	cache := newOfflineCache(dir, 1024, "a")
+	require.NoError(t, cache.setMark(OfflineMark{Kind: OfflineSong, Id: "1", SongIds: []string{"1"}}))
+	require.NoError(t, cache.store("1", strings.NewReader("song")))
+	// left by an interrupted download
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "tmp-1"), nil, 0o600))
+
+	cache = newOfflineCache(dir, 1024, "a")
+	require.NoError(t, cache.load())
+	path, ok := cache.file("1")
+	require.True(t, ok)
+	assert.FileExists(t, path)
+	assert.NoFileExists(t, filepath.Join(dir, "tmp-1"))
+
+	// the songs of another server are deleted
+	cache = newOfflineCache(dir, 1024, "b")
+	require.NoError(t, cache.load())
+	assert.Empty(t, cache.getMarks())
+	_, ok = cache.file("1")
+	assert.False(t, ok)
+	require.NoError(t, cache.prune())
+	assert.NoFileExists(t, path)
+}
+
+func TestOfflineCacheStore(t *testing.T) {
+	cache := newOfflineCache(t.TempDir(), 10, "a")
+	require.NoError(t, cache.setMark(OfflineMark{Kind: OfflinePlaylist, Id: "p", SongIds: []string{"1", "2", "1"}}))
+	assert.Equal(t, []string{"1", "2"}, cache.missing())
+
+	require.NoError(t, cache.store("1", strings.NewReader("123456")))
+	err := cache.store("2", strings.NewReader("123456"))
+	assert.ErrorIs(t, err, ErrOfflineCacheFull)
+	assert.Equal(t, []string{"2"}, cache.missing())
+	assert.Equal(t, int64(6), cache.used())
+
+	// songs unmarked during their download aren't kept
+	require.NoError(t, cache.store("3", strings.NewReader("1")))
+	_, ok := cache.file("3")
+	assert.False(t, ok)
+}
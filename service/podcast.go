@@ -0,0 +1,120 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package service
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+)
+
+// status of podcast channels and episodes, only completed episodes can be
+// streamed
+const (
+	PodcastStatusNew         = "new"
+	PodcastStatusDownloading = "downloading"
+	PodcastStatusCompleted   = "completed"
+	PodcastStatusError       = "error"
+	PodcastStatusDeleted     = "deleted"
+	PodcastStatusSkipped     = "skipped"
+)
+
+// Podcasts is the response of getPodcasts
+// https://www.subsonic.org/pages/api.jsp#getPodcasts
+type Podcasts struct {
+	Channels []PodcastChannel `json:"channel"`
+}
+
+type PodcastChannel struct {
+	Id           string           `json:"id"`
+	Url          string           `json:"url"`
+	Title        string           `json:"title"`
+	Description  string           `json:"description"`
+	CoverArt     string           `json:"coverArt"`
+	Status       string           `json:"status"`
+	ErrorMessage string           `json:"errorMessage"`
+	Episodes     []PodcastEpisode `json:"episode"`
+}
+
+type PodcastEpisode struct {
+	Id string `json:"id"`
+	// ID of the downloaded file, only set once the episode is completed
+	StreamId    string `json:"streamId"`
+	ChannelId   string `json:"channelId"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	PublishDate string `json:"publishDate"`
+	Status      string `json:"status"`
+	Artist      string `json:"artist"`
+	Album       string `json:"album"`
+	Duration    int    `json:"duration"`
+	CoverArt    string `json:"coverArt"`
+}
+
+// NewestPodcasts is the response of getNewestPodcasts
+type NewestPodcasts struct {
+	Episodes []PodcastEpisode `json:"episode"`
+}
+
+// GetPodcasts returns the subscribed channels, only the one with ID id if
+// it isn't empty. The episodes are left out unless includeEpisodes is set.
+func (c *SubsonicConnection) GetPodcasts(ctx context.Context, id string, includeEpisodes bool) (*SubsonicResponse, error) {
+	params := url.Values{"includeEpisodes": []string{strconv.FormatBool(includeEpisodes)}}
+	if id != "" {
+		params.Set("id", id)
+	}
+	url := c.buildUrl("/rest/getPodcasts", params)
+	return c.getResponse(ctx, url)
+}
+
+// GetNewestPodcasts returns the count most recently published episodes of
+// all channels.
+func (c *SubsonicConnection) GetNewestPodcasts(ctx context.Context, count int) (*SubsonicResponse, error) {
+	params := url.Values{"count": []string{strconv.Itoa(count)}}
+	url := c.buildUrl("/rest/getNewestPodcasts", params)
+	return c.getResponse(ctx, url)
+}
+
+// RefreshPodcasts tells the server to check the channels for new episodes.
+// It returns before the server is done.
+func (c *SubsonicConnection) RefreshPodcasts(ctx context.Context) error {
+	url := c.buildUrl("/rest/refreshPodcasts", nil)
+	_, err := c.getResponseOnce(ctx, url)
+	return err
+}
+
+// CreatePodcastChannel subscribes to the podcast feed at feedUrl.
+func (c *SubsonicConnection) CreatePodcastChannel(ctx context.Context, feedUrl string) error {
+	params := url.Values{"url": []string{feedUrl}}
+	url := c.buildUrl("/rest/createPodcastChannel", params)
+	_, err := c.getResponseOnce(ctx, url)
+	return err
+}
+
+// DeletePodcastChannel unsubscribes from the channel with ID id, its
+// downloaded episodes are deleted as well.
+func (c *SubsonicConnection) DeletePodcastChannel(ctx context.Context, id string) error {
+	params := url.Values{"id": []string{id}}
+	url := c.buildUrl("/rest/deletePodcastChannel", params)
+	_, err := c.getResponseOnce(ctx, url)
+	return err
+}
+
+// DownloadPodcastEpisode tells the server to download the episode with ID
+// id. It returns before the download is done.
+func (c *SubsonicConnection) DownloadPodcastEpisode(ctx context.Context, id string) error {
+	params := url.Values{"id": []string{id}}
+	url := c.buildUrl("/rest/downloadPodcastEpisode", params)
+	_, err := c.getResponseOnce(ctx, url)
+	return err
+}
+
+// DeletePodcastEpisode deletes the downloaded file of the episode with ID id
+// on the server.
+func (c *SubsonicConnection) DeletePodcastEpisode(ctx context.Context, id string) error {
+	params := url.Values{"id": []string{id}}
+	url := c.buildUrl("/rest/deletePodcastEpisode", params)
+	_, err := c.getResponseOnce(ctx, url)
+	return err
+}
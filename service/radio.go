@@ -0,0 +1,66 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package service
+
+import (
+	"context"
+	"net/url"
+)
+
+// InternetRadioStations is the response of getInternetRadioStations
+// https://www.subsonic.org/pages/api.jsp#getInternetRadioStations
+type InternetRadioStations struct {
+	Stations []InternetRadioStation `json:"internetRadioStation"`
+}
+
+type InternetRadioStation struct {
+	Id          string `json:"id"`
+	Name        string `json:"name"`
+	StreamUrl   string `json:"streamUrl"`
+	HomePageUrl string `json:"homePageUrl"`
+}
+
+// GetInternetRadioStations returns the radio stations configured on the
+// server.
+func (c *SubsonicConnection) GetInternetRadioStations(ctx context.Context) (*SubsonicResponse, error) {
+	url := c.buildUrl("/rest/getInternetRadioStations", nil)
+	return c.getResponse(ctx, url)
+}
+
+// CreateInternetRadioStation adds a station, homePageUrl is optional. Most
+// servers only allow admins to change the stations, others get
+// ErrNotAuthorized.
+func (c *SubsonicConnection) CreateInternetRadioStation(ctx context.Context, name, streamUrl, homePageUrl string) error {
+	params := radioStationParams(name, streamUrl, homePageUrl)
+	url := c.buildUrl("/rest/createInternetRadioStation", params)
+	_, err := c.getResponseOnce(ctx, url)
+	return err
+}
+
+// UpdateInternetRadioStation replaces name and URLs of the station with ID
+// id, see CreateInternetRadioStation.
+func (c *SubsonicConnection) UpdateInternetRadioStation(ctx context.Context, id, name, streamUrl, homePageUrl string) error {
+	params := radioStationParams(name, streamUrl, homePageUrl)
+	params.Set("id", id)
+	url := c.buildUrl("/rest/updateInternetRadioStation", params)
+	_, err := c.getResponseOnce(ctx, url)
+	return err
+}
+
+// DeleteInternetRadioStation removes the station with ID id, see
+// CreateInternetRadioStation.
+func (c *SubsonicConnection) DeleteInternetRadioStation(ctx context.Context, id string) error {
+	params := url.Values{"id": []string{id}}
+	url := c.buildUrl("/rest/deleteInternetRadioStation", params)
+	_, err := c.getResponseOnce(ctx, url)
+	return err
+}
+
+func radioStationParams(name, streamUrl, homePageUrl string) url.Values {
+	params := url.Values{"name": []string{name}, "streamUrl": []string{streamUrl}}
+	if homePageUrl != "" {
+		params.Set("homepageUrl", homePageUrl)
+	}
+	return params
+}
@@ -2,6 +2,7 @@ package service
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -15,6 +16,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/spezifisch/stmps/utils"
 	webp "golang.org/x/image/webp"
@@ -26,14 +28,19 @@ var state struct {
 
 func (c *SubsonicConnection) buildUrl(path string, params url.Values) string {
 	query := url.Values{}
-	if c.Conf().PlaintextAuth {
-		query.Set("p", c.Conf().Password)
+	if c.UsesAPIKey() {
+		// the user is part of the key, servers reject both
+		query.Set("apiKey", c.Conf().APIKey)
 	} else {
-		token, salt := authToken(c.Conf().Password)
-		query.Set("t", token)
-		query.Set("s", salt)
+		if c.Conf().PlaintextAuth {
+			query.Set("p", c.Conf().Password)
+		} else {
+			token, salt := authToken(c.Conf().Password)
+			query.Set("t", token)
+			query.Set("s", salt)
+		}
+		query.Set("u", c.Conf().Username)
 	}
-	query.Set("u", c.Conf().Username)
 	query.Set("v", c.Conf().ClientVersion)
 	query.Set("c", c.Conf().ClientName)
 	query.Set("f", "json")
@@ -46,132 +53,133 @@ func (c *SubsonicConnection) buildUrl(path string, params url.Values) string {
 }
 
 // requests
-func (c *SubsonicConnection) GetServerInfo() (*SubsonicResponse, error) {
+func (c *SubsonicConnection) GetServerInfo(ctx context.Context) (*SubsonicResponse, error) {
 	url := c.buildUrl("/rest/ping", nil)
-	return c.getResponse(url)
+	return c.getResponse(ctx, url)
 }
 
-func (c *SubsonicConnection) GetIndexes() (*SubsonicResponse, error) {
-	url := c.buildUrl("/rest/getIndexes", nil)
-	return c.getResponse(url)
+// GetIndexes returns the artists, from the library cache if they were fetched
+// before. RevalidateIndexes updates them.
+func (c *SubsonicConnection) GetIndexes(ctx context.Context) (*SubsonicResponse, error) {
+	if cached, _, ok := c.library.get(libraryKeyIndexes); ok {
+		return &cached, nil
+	}
+	resp, _, err := c.RevalidateIndexes(ctx)
+	return resp, err
 }
 
-func (c *SubsonicConnection) GetArtist(id string) (*SubsonicResponse, error) {
-	if cachedResponse, present := directoryCache[id]; present {
-		return &cachedResponse, nil
+// RevalidateIndexes asks the server whether the artists changed since the
+// cached indexes were fetched. If they did, changed is true and the cached
+// artists, albums and directories are fetched again when they're requested
+// the next time.
+func (c *SubsonicConnection) RevalidateIndexes(ctx context.Context) (resp *SubsonicResponse, changed bool, err error) {
+	cached, _, ok := c.library.get(libraryKeyIndexes)
+	params := url.Values{}
+	if ok && cached.Indexes.LastModified > 0 {
+		params.Set("ifModifiedSince", strconv.FormatInt(cached.Indexes.LastModified, 10))
 	}
-
-	params := url.Values{"id": []string{id}}
-	url := c.buildUrl("/rest/getArtist", params)
-
-	resp, err := c.getResponse(url)
+	url := c.buildUrl("/rest/getIndexes", params)
+	resp, err = c.getResponse(ctx, url)
 	if err != nil {
-		return resp, err
+		return resp, false, err
 	}
 
-	// on a sucessful request, cache the response
-	if resp.Status == "ok" {
-		directoryCache[id] = *resp
+	// unmodified indexes keep their timestamp, whether the server leaves out
+	// the artists or ignores ifModifiedSince. An empty library is a change.
+	if params.Has("ifModifiedSince") && resp.Indexes.LastModified == cached.Indexes.LastModified {
+		c.library.touch(libraryKeyIndexes)
+		return &cached, false, nil
 	}
 
-	sort.Sort(resp.Directory.Entities)
-
-	return resp, nil
+	c.library.put(libraryKeyIndexes, *resp)
+	c.library.expire(notIndexesKey)
+	return resp, true, nil
 }
 
-func (c *SubsonicConnection) GetAlbum(id string) (*SubsonicResponse, error) {
-	if cachedResponse, present := directoryCache[id]; present {
-		// This is because Albums that were fetched as Directories aren't populated correctly
-		if cachedResponse.Album.Name != "" {
-			return &cachedResponse, nil
-		}
-	}
+func (c *SubsonicConnection) GetArtist(ctx context.Context, id string) (*SubsonicResponse, error) {
+	params := url.Values{"id": []string{id}}
+	url := c.buildUrl("/rest/getArtist", params)
+	return c.cachedResponse(ctx, libraryKeyArtist+id, url)
+}
 
+func (c *SubsonicConnection) GetAlbum(ctx context.Context, id string) (*SubsonicResponse, error) {
 	params := url.Values{"id": []string{id}}
 	url := c.buildUrl("/rest/getAlbum", params)
-	resp, err := c.getResponse(url)
-	if err != nil {
-		return resp, err
-	}
-
-	// on a sucessful request, cache the response
-	// TODO: this is crap, if we cache at this level it's means the rest of the app is eagerly fetching data from the service, it shouldn't as it has the most context to ask for fresh data. only pricy calls should be optimized here
-	if resp.Status == "ok" {
-		directoryCache[id] = *resp
-	}
-
-	sort.Sort(resp.Directory.Entities)
+	return c.cachedResponse(ctx, libraryKeyAlbum+id, url)
+}
 
-	return resp, nil
+func (c *SubsonicConnection) GetMusicDirectory(ctx context.Context, id string) (*SubsonicResponse, error) {
+	params := url.Values{"id": []string{id}}
+	url := c.buildUrl("/rest/getMusicDirectory", params)
+	return c.cachedResponse(ctx, libraryKeyDirectory+id, url)
 }
 
-func (c *SubsonicConnection) GetMusicDirectory(id string) (*SubsonicResponse, error) {
-	if cachedResponse, present := directoryCache[id]; present {
-		return &cachedResponse, nil
+// cachedResponse returns the response for key from the library cache, or
+// fetches it from requestUrl if it isn't cached or outdated. Outdated
+// responses are still returned if the server can't be reached.
+func (c *SubsonicConnection) cachedResponse(ctx context.Context, key, requestUrl string) (*SubsonicResponse, error) {
+	cached, fresh, ok := c.library.get(key)
+	if ok && fresh {
+		return &cached, nil
 	}
 
-	params := url.Values{"id": []string{id}}
-	url := c.buildUrl("/rest/getMusicDirectory", params)
-	resp, err := c.getResponse(url)
+	resp, err := c.getResponse(ctx, requestUrl)
 	if err != nil {
+		var apiErr *APIError
+		if ok && ctx.Err() == nil && !errors.As(err, &apiErr) {
+			return &cached, nil
+		}
 		return resp, err
 	}
 
-	// on a sucessful request, cache the response
-	if resp.Status == "ok" {
-		directoryCache[id] = *resp
-	}
-
+	// sorted before caching, cached responses are shared
 	sort.Sort(resp.Directory.Entities)
-
+	c.library.put(key, *resp)
 	return resp, nil
 }
 
-// GetCoverArt fetches album art from the server, by ID. The results are cached,
-// so it is safe to call this function repeatedly. If id is empty, an error
-// is returned. If, for some reason, the server response can't be parsed into
-// an image, an error is returned. This function can parse GIF, JPEG, and PNG
-// images.
-func (c *SubsonicConnection) GetCoverArt(id string) (image.Image, error) {
+// GetCoverArt fetches album art from the server, by ID, scaled to size pixels
+// or in original size if size is 0. The results are cached in memory and on
+// disk, so it is safe to call this function repeatedly. If id is empty, an
+// error is returned. If, for some reason, the server response can't be parsed
+// into an image, an error is returned. This function can parse GIF, JPEG, PNG
+// and WebP images.
+func (c *SubsonicConnection) GetCoverArt(ctx context.Context, id string, size int) (image.Image, error) {
 	if id == "" {
 		return nil, fmt.Errorf("GetCoverArt: no ID provided")
 	}
-	if rv, ok := coverArts[id]; ok {
-		return rv, nil
+	if art, ok := c.coverArts.get(id, size); ok {
+		return art, nil
 	}
 	params := url.Values{"id": []string{id}, "f": []string{"image/png"}}
+	if size > 0 {
+		params.Set("size", strconv.Itoa(size))
+	}
 	url := c.buildUrl("/rest/getCoverArt", params)
 	caller := "GetCoverArt"
-	req, err := c.baseRequest("GetCoverArt", http.MethodGet, url, nil)
-	res, err := http.DefaultClient.Do(req)
+	responseBody, contentType, err := c.fetch(ctx, caller, url, true)
 	if err != nil {
-		coverArts[id] = nil
-		return nil, fmt.Errorf("[%s] failed to make GET request: %v", caller, err)
-	}
-
-	if res.Body != nil {
-		defer res.Body.Close()
-	} else {
-		coverArts[id] = nil
-		return nil, fmt.Errorf("[%s] response body is nil", caller)
-	}
-
-	if res.StatusCode != http.StatusOK {
-		coverArts[id] = nil
-		return nil, fmt.Errorf("[%s] unexpected status code: %d, status: %s", caller, res.StatusCode, res.Status)
+		if ctx.Err() == nil {
+			_ = c.coverArts.put(id, size, nil, nil)
+		}
+		return nil, err
 	}
 
-	if len(res.Header["Content-Type"]) == 0 {
-		coverArts[id] = nil
+	if contentType == "" {
+		_ = c.coverArts.put(id, size, nil, nil)
 		return nil, fmt.Errorf("[%s] unknown image type (no content-type from server)", caller)
 	}
-	responseBody, err := io.ReadAll(res.Body)
-	if err != nil {
-		coverArts[id] = nil
-		return nil, fmt.Errorf("[%s] failed to read response body: %v", caller, err)
+	if strings.HasPrefix(contentType, "application/json") {
+		// the server sends a Subsonic error instead of the image
+		_ = c.coverArts.put(id, size, nil, nil)
+		var decodedBody responseWrapper
+		if err := json.Unmarshal(responseBody, &decodedBody); err != nil {
+			return nil, fmt.Errorf("[%s] failed to unmarshal response body: %v", caller, err)
+		}
+		return nil, newAPIError(caller, decodedBody.Response.Error)
 	}
 	var art image.Image
-	switch res.Header["Content-Type"][0] {
+	switch contentType {
 	case "image/png":
 		art, err = png.Decode(bytes.NewReader(responseBody))
 	case "image/jpeg":
@@ -181,17 +189,80 @@ func (c *SubsonicConnection) GetCoverArt(id string) (image.Image, error) {
 	case "image/webp":
 		art, err = webp.Decode(bytes.NewReader(responseBody))
 	default:
-		coverArts[id] = nil
-		return nil, fmt.Errorf("[%s] unhandled image type %s: %v", caller, res.Header["Content-Type"][0], err)
+		_ = c.coverArts.put(id, size, nil, nil)
+		return nil, fmt.Errorf("[%s] unhandled image type %s: %v", caller, contentType, err)
 	}
 	if art != nil {
-		// FIXME coverArts shouldn't grow indefinitely. Add some LRU cleanup after loading a few hundred cover arts.
-		coverArts[id] = art
+		// failing to write the disk cache only costs fetching it again
+		_ = c.coverArts.put(id, size, art, responseBody)
 	}
 	return art, err
 }
 
-func (c *SubsonicConnection) GetRandomSongs(Id string, randomType string) (*SubsonicResponse, error) {
+// getAlbumList2 list types
+const (
+	AlbumListRandom               = "random"
+	AlbumListNewest               = "newest"
+	AlbumListHighest              = "highest"
+	AlbumListFrequent             = "frequent"
+	AlbumListRecent               = "recent"
+	AlbumListAlphabeticalByName   = "alphabeticalByName"
+	AlbumListAlphabeticalByArtist = "alphabeticalByArtist"
+	AlbumListStarred              = "starred"
+	AlbumListByYear               = "byYear"
+	AlbumListByGenre              = "byGenre"
+)
+
+// AlbumListQuery selects a page of albums from getAlbumList2.
+type AlbumListQuery struct {
+	// one of the AlbumList* types
+	Type string
+	// at most 500
+	Size   int
+	Offset int
+
+	// byYear, descending if FromYear is after ToYear
+	FromYear, ToYear int
+	// byGenre
+	Genre string
+}
+
+// GetAlbumList returns a page of the albums sorted and filtered as query
+// says.
+func (c *SubsonicConnection) GetAlbumList(ctx context.Context, query AlbumListQuery) (*SubsonicResponse, error) {
+	params := url.Values{
+		"type":   []string{query.Type},
+		"size":   []string{strconv.Itoa(query.Size)},
+		"offset": []string{strconv.Itoa(query.Offset)},
+	}
+	switch query.Type {
+	case AlbumListByYear:
+		params.Set("fromYear", strconv.Itoa(query.FromYear))
+		params.Set("toYear", strconv.Itoa(query.ToYear))
+	case AlbumListByGenre:
+		params.Set("genre", query.Genre)
+	}
+	url := c.buildUrl("/rest/getAlbumList2", params)
+	return c.getResponse(ctx, url)
+}
+
+func (c *SubsonicConnection) GetGenres(ctx context.Context) (*SubsonicResponse, error) {
+	url := c.buildUrl("/rest/getGenres", nil)
+	return c.getResponse(ctx, url)
+}
+
+// GetSongsByGenre returns a page of at most count (up to 500) songs of genre.
+func (c *SubsonicConnection) GetSongsByGenre(ctx context.Context, genre string, count, offset int) (*SubsonicResponse, error) {
+	params := url.Values{
+		"genre":  []string{genre},
+		"count":  []string{strconv.Itoa(count)},
+		"offset": []string{strconv.Itoa(offset)},
+	}
+	url := c.buildUrl("/rest/getSongsByGenre", params)
+	return c.getResponse(ctx, url)
+}
+
+func (c *SubsonicConnection) GetRandomSongs(ctx context.Context, Id string, randomType string) (*SubsonicResponse, error) {
 	// TODO: move to the config validation, no need to check it over and over again
 
 	// Set the default size for random/similar songs, clamped to 500
@@ -203,28 +274,53 @@ func (c *SubsonicConnection) GetRandomSongs(Id string, randomType string) (*Subs
 	switch randomType {
 	case "similar":
 		params := url.Values{"id": []string{Id}, "count": []string{size}}
-		url := c.buildUrl("/rest/getSimilarSongs?", params)
-		return c.getResponse(url)
+		url := c.buildUrl("/rest/getSimilarSongs", params)
+		return c.getResponse(ctx, url)
 	default: // "random" and everything else
 		params := url.Values{"size": []string{size}}
 		url := c.buildUrl("/rest/getRandomSongs", params)
-		return c.getResponse(url)
+		return c.getResponse(ctx, url)
 	}
 }
 
-func (c *SubsonicConnection) ScrobbleSubmission(id string, isSubmission bool) (resp *SubsonicResponse, err error) {
+func (c *SubsonicConnection) ScrobbleSubmission(ctx context.Context, id string, isSubmission bool) (resp *SubsonicResponse, err error) {
 	params := url.Values{"id": []string{id}, "submission": []string{strconv.FormatBool(isSubmission)}}
 	url := c.buildUrl("/rest/scrobble", params)
-	return c.getResponse(url)
+	return c.getResponseOnce(ctx, url)
 }
 
-func (c *SubsonicConnection) GetStarred() (*SubsonicResponse, error) {
+func (c *SubsonicConnection) GetStarred(ctx context.Context) (*SubsonicResponse, error) {
 	url := c.buildUrl("/rest/getStarred", nil)
-	return c.getResponse(url)
+	return c.getResponse(ctx, url)
 }
 
-func (c *SubsonicConnection) ToggleStar(id string, starredItems map[string]struct{}) (*SubsonicResponse, error) {
-	params := url.Values{"id": []string{id}}
+// SetRating rates the song, album or artist with 1 to 5 stars, 0 removes the
+// rating.
+func (c *SubsonicConnection) SetRating(ctx context.Context, id string, rating int) error {
+	params := url.Values{"id": []string{id}, "rating": []string{strconv.Itoa(rating)}}
+	url := c.buildUrl("/rest/setRating", params)
+	_, err := c.getResponseOnce(ctx, url)
+	return err
+}
+
+// GetStarred2 returns the starred artists, albums and songs organized by ID3
+// tags, like the album lists.
+func (c *SubsonicConnection) GetStarred2(ctx context.Context) (*SubsonicResponse, error) {
+	url := c.buildUrl("/rest/getStarred2", nil)
+	return c.getResponse(ctx, url)
+}
+
+// Kinds of items ToggleStar stars. Songs and the artists and albums of the
+// folder view are starred by id, the ID3 ones of e.g. getStarred2 and
+// getAlbumList2 by their own parameters.
+const (
+	StarItem   = "id"
+	StarArtist = "artistId"
+	StarAlbum  = "albumId"
+)
+
+func (c *SubsonicConnection) ToggleStar(ctx context.Context, kind, id string, starredItems map[string]struct{}) (*SubsonicResponse, error) {
+	params := url.Values{kind: []string{id}}
 	var url string
 	_, ok := starredItems[id]
 	if ok {
@@ -233,12 +329,12 @@ func (c *SubsonicConnection) ToggleStar(id string, starredItems map[string]struc
 		url = c.buildUrl("/rest/star", params)
 	}
 
-	return c.getResponse(url)
+	return c.getResponse(ctx, url)
 }
 
-func (c *SubsonicConnection) GetPlaylists() (*SubsonicResponse, error) {
+func (c *SubsonicConnection) GetPlaylists(ctx context.Context) (*SubsonicResponse, error) {
 	url := c.buildUrl("/rest/getPlaylists", nil)
-	resp, err := c.getResponse(url)
+	resp, err := c.getResponse(ctx, url)
 	if err != nil {
 		return resp, err
 	}
@@ -250,7 +346,7 @@ func (c *SubsonicConnection) GetPlaylists() (*SubsonicResponse, error) {
 			continue
 		}
 
-		response, err := c.GetPlaylist(string(playlist.Id))
+		response, err := c.GetPlaylist(ctx, string(playlist.Id))
 		if err != nil {
 			return nil, err
 		}
@@ -261,10 +357,10 @@ func (c *SubsonicConnection) GetPlaylists() (*SubsonicResponse, error) {
 	return resp, nil
 }
 
-func (c *SubsonicConnection) GetPlaylist(id string) (*SubsonicResponse, error) {
+func (c *SubsonicConnection) GetPlaylist(ctx context.Context, id string) (*SubsonicResponse, error) {
 	params := url.Values{"id": []string{id}}
 	url := c.buildUrl("/rest/getPlaylist", params)
-	return c.getResponse(url)
+	return c.getResponse(ctx, url)
 }
 
 // CreatePlaylist creates or updates a playlist on the server.
@@ -274,13 +370,13 @@ func (c *SubsonicConnection) GetPlaylist(id string) (*SubsonicResponse, error) {
 // If _both_ id and name are poplated, the function returns an error.
 // songIds may be nil, in which case the new playlist is created empty, or all
 // songs are removed from the existing playlist.
-func (c *SubsonicConnection) CreatePlaylist(id, name string, songIds []string) (*SubsonicResponse, error) {
+func (c *SubsonicConnection) CreatePlaylist(ctx context.Context, id, name string, songIds []string) (*SubsonicResponse, error) {
 	if (id == "" && name == "") || (id != "" && name != "") {
 		return nil, errors.New("CreatePlaylist: exactly one of id or name must be provided")
 	}
 	params := url.Values{}
 	if id != "" {
-		params.Set("id", id)
+		params.Set("playlistId", id)
 	} else {
 		params.Set("name", name)
 	}
@@ -288,19 +384,19 @@ func (c *SubsonicConnection) CreatePlaylist(id, name string, songIds []string) (
 		params.Add("songId", sid)
 	}
 	url := c.buildUrl("/rest/createPlaylist", params)
-	return c.getResponse(url)
+	return c.getResponseOnce(ctx, url)
 }
 
-func (c *SubsonicConnection) GetAuthToken(caller string) (string, string, error) {
+func (c *SubsonicConnection) GetAuthToken(ctx context.Context, caller string) (string, string, error) {
 	if c.Conf().Authentik && len(c.Conf().ClientId) > 0 {
 		if len(token) == 0 {
 			payload := fmt.Sprintf("grant_type=client_credentials&client_id=%s&username=%s&password=%s&scope=profile", c.Conf().ClientId, c.Conf().Username, c.Conf().Password)
-			auth, err := http.NewRequest(http.MethodPost, c.Conf().AuthURL, strings.NewReader(payload))
+			auth, err := http.NewRequestWithContext(ctx, http.MethodPost, c.Conf().AuthURL, strings.NewReader(payload))
 			if err != nil {
 				return "", "", fmt.Errorf("[%s] Could not create SSO auth request: %v", caller, err)
 			}
 			auth.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-			authRes, err := http.DefaultClient.Do(auth)
+			authRes, err := c.client.Do(auth)
 			if err != nil {
 				return "", "", fmt.Errorf("[%s] Failed when generating SSO auth token: %v", caller, err)
 			}
@@ -325,81 +421,148 @@ func (c *SubsonicConnection) GetAuthToken(caller string) (string, string, error)
 	return "", "", nil
 }
 
-func (c *SubsonicConnection) baseRequest(caller, method, requestUrl string, body io.Reader) (*http.Request, error) {
-	req, err := http.NewRequest(method, requestUrl, body)
+func (c *SubsonicConnection) baseRequest(ctx context.Context, caller, method, requestUrl string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, requestUrl, body)
 	if err != nil {
 		return nil, fmt.Errorf("[%s] Could not create request: %v", caller, err)
 	}
-	header, value, err := c.GetAuthToken(caller)
+	header, value, err := c.GetAuthToken(ctx, caller)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set(header, value)
+	if header != "" {
+		req.Header.Set(header, value)
+	}
 	return req, nil
 }
 
-func (c *SubsonicConnection) getResponseBodyless(requestUrl string) error {
-	caller := utils.FuncnameOnly(2)
-	req, err := c.baseRequest(caller, http.MethodGet, requestUrl, nil)
+// getResponseBodyless makes a request whose response only tells whether it
+// succeeded. It isn't retried.
+func (c *SubsonicConnection) getResponseBodyless(ctx context.Context, requestUrl string) error {
+	_, err := c.doRequest(ctx, utils.FuncnameOnly(2), requestUrl, false)
+	return err
+}
+
+// getResponse makes an idempotent request and decodes the response. A
+// "failed" response is returned as *APIError.
+func (c *SubsonicConnection) getResponse(ctx context.Context, requestUrl string) (*SubsonicResponse, error) {
+	return c.doRequest(ctx, utils.FuncnameOnly(2), requestUrl, true)
+}
+
+// getResponseOnce is getResponse for requests that change something on the
+// server in a way that mustn't be repeated, like scrobbling.
+func (c *SubsonicConnection) getResponseOnce(ctx context.Context, requestUrl string) (*SubsonicResponse, error) {
+	return c.doRequest(ctx, utils.FuncnameOnly(2), requestUrl, false)
+}
+
+func (c *SubsonicConnection) doRequest(ctx context.Context, caller, requestUrl string, idempotent bool) (*SubsonicResponse, error) {
+	responseBody, _, err := c.fetch(ctx, caller, requestUrl, idempotent)
 	if err != nil {
-		return fmt.Errorf("[%s] Could not create request: %v", caller, err)
+		return nil, err
+	}
+
+	var decodedBody responseWrapper
+	err = json.Unmarshal(responseBody, &decodedBody)
+	if err != nil {
+		return nil, fmt.Errorf("[%s] failed to unmarshal response body: %v", caller, err)
+	}
+	if decodedBody.Response.Status == "failed" {
+		return nil, newAPIError(caller, decodedBody.Response.Error)
+	}
+
+	return &decodedBody.Response, nil
+}
+
+// retryDelay is the wait before the first retry, it doubles with every retry
+var retryDelay = 500 * time.Millisecond
+
+// fetch makes a request and returns the body and content type of the
+// response. Idempotent requests are retried with backoff on connection errors
+// and server side failures, up to the configured number of retries.
+func (c *SubsonicConnection) fetch(ctx context.Context, caller, requestUrl string, idempotent bool) ([]byte, string, error) {
+	retries := 0
+	if idempotent {
+		retries = max(c.Conf().RequestRetries, 0)
+	}
+
+	delay := retryDelay
+	for attempt := 0; ; attempt++ {
+		body, contentType, retry, err := c.fetchOnce(ctx, caller, requestUrl)
+		if err == nil || !retry || attempt == retries {
+			return body, contentType, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, "", fmt.Errorf("[%s] %w", caller, ctx.Err())
+		case <-time.After(delay):
+		}
+		delay *= 2
 	}
-	_, err = http.DefaultClient.Do(req)
-	return err
 }
 
-func (c *SubsonicConnection) getResponse(requestUrl string) (*SubsonicResponse, error) {
-	caller := utils.FuncnameOnly(2)
-	req, err := c.baseRequest(caller, http.MethodGet, requestUrl, nil)
+// fetchOnce makes a GET request, or a POST request with the parameters in
+// the body if the server supports it. retry tells whether a failed request is
+// worth repeating.
+func (c *SubsonicConnection) fetchOnce(ctx context.Context, caller, requestUrl string) (body []byte, contentType string, retry bool, err error) {
+	method := http.MethodGet
+	var form io.Reader
+	if c.Capabilities().Supports(ExtensionFormPost) {
+		// keeps credentials out of server logs and long parameter lists out of
+		// URL length limits
+		if base, query, ok := strings.Cut(requestUrl, "?"); ok {
+			method, requestUrl, form = http.MethodPost, base, strings.NewReader(query)
+		}
+	}
+
+	req, err := c.baseRequest(ctx, caller, method, requestUrl, form)
 	if err != nil {
-		return nil, fmt.Errorf("[%s] Could not create request: %v", caller, err)
+		return nil, "", false, err
+	}
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	}
 
-	res, err := http.DefaultClient.Do(req)
+	res, err := c.client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("[%s] failed to make GET request: %v", caller, err)
+		// canceled requests aren't retried, timeouts and network errors are
+		return nil, "", ctx.Err() == nil, fmt.Errorf("[%s] failed to make %s request: %w", caller, method, err)
 	}
 
 	if res.Body != nil {
 		defer res.Body.Close()
 	} else {
-		return nil, fmt.Errorf("[%s] response body is nil", caller)
+		return nil, "", false, fmt.Errorf("[%s] response body is nil", caller)
 	}
 
 	if res.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("[%s] unexpected status code: %d, status: %s", caller, res.StatusCode, res.Status)
-	}
-
-	responseBody, readErr := io.ReadAll(res.Body)
-	if readErr != nil {
-		return nil, fmt.Errorf("[%s] failed to read response body: %v", caller, readErr)
+		retry := res.StatusCode >= http.StatusInternalServerError || res.StatusCode == http.StatusTooManyRequests
+		return nil, "", retry, fmt.Errorf("[%s] unexpected status code: %d, status: %s", caller, res.StatusCode, res.Status)
 	}
 
-	var decodedBody responseWrapper
-	err = json.Unmarshal(responseBody, &decodedBody)
+	body, err = io.ReadAll(res.Body)
 	if err != nil {
-		return nil, fmt.Errorf("[%s] failed to unmarshal response body: %v", caller, err)
+		return nil, "", ctx.Err() == nil, fmt.Errorf("[%s] failed to read response body: %w", caller, err)
 	}
-
-	return &decodedBody.Response, nil
+	return body, res.Header.Get("Content-Type"), false, nil
 }
 
-func (c *SubsonicConnection) DeletePlaylist(id string) error {
+func (c *SubsonicConnection) DeletePlaylist(ctx context.Context, id string) error {
 	params := url.Values{"id": []string{id}}
 	url := c.buildUrl("/rest/deletePlaylist", params)
-	return c.getResponseBodyless(url)
+	return c.getResponseBodyless(ctx, url)
 }
 
-func (c *SubsonicConnection) AddSongToPlaylist(playlistId string, songId string) error {
+func (c *SubsonicConnection) AddSongToPlaylist(ctx context.Context, playlistId string, songId string) error {
 	params := url.Values{"playlistId": []string{playlistId}, "songIdToAdd": []string{songId}}
 	url := c.buildUrl("/rest/updatePlaylist", params)
-	return c.getResponseBodyless(url)
+	return c.getResponseBodyless(ctx, url)
 }
 
-func (c *SubsonicConnection) RemoveSongFromPlaylist(playlistId string, songIndex int) error {
+func (c *SubsonicConnection) RemoveSongFromPlaylist(ctx context.Context, playlistId string, songIndex int) error {
 	params := url.Values{"playlistId": []string{playlistId}, "songIndexToRemove": []string{strconv.Itoa(songIndex)}}
 	url := c.buildUrl("/rest/updatePlaylist", params)
-	return c.getResponseBodyless(url)
+	return c.getResponseBodyless(ctx, url)
 }
 
 // note that this function does not make a request, it just formats the play url
@@ -411,16 +574,69 @@ func (c *SubsonicConnection) GetPlayUrl(entity *SubsonicEntity) string {
 	if entity.IsDirectory {
 		return ""
 	}
+	// downloaded songs are played without the server
+	if path, ok := c.offline.file(entity.Id); ok {
+		return path
+	}
+
+	return c.buildUrl("/rest/stream", c.streamParams(entity.Id))
+}
 
-	params := url.Values{"id": []string{entity.Id}}
+// GetPlayUrlAt returns the stream URL of entity starting position seconds
+// into the song, for transcoded streams mpv can't seek in. It's "" if the
+// song isn't transcoded or the server can't start at an offset, mpv seeks
+// then.
+func (c *SubsonicConnection) GetPlayUrlAt(entity *SubsonicEntity, position int64) string {
+	profile := c.StreamProfile()
+	transcoded := (profile.Format != "" && profile.Format != "raw") || profile.MaxBitRate > 0
+	if !transcoded || !c.Capabilities().Supports(ExtensionTranscodeOffset) {
+		return ""
+	}
+	if _, ok := c.offline.file(entity.Id); ok || entity.IsDirectory {
+		return ""
+	}
+
+	params := c.streamParams(entity.Id)
+	if position > 0 {
+		params.Set("timeOffset", strconv.FormatInt(position, 10))
+	}
 	return c.buildUrl("/rest/stream", params)
 }
 
+// streamParams are the stream parameters of the song id with the current
+// stream profile
+func (c *SubsonicConnection) streamParams(id string) url.Values {
+	params := url.Values{"id": []string{id}}
+	profile := c.StreamProfile()
+	if profile.Format != "" {
+		params.Set("format", profile.Format)
+	}
+	if profile.MaxBitRate > 0 {
+		params.Set("maxBitRate", strconv.Itoa(profile.MaxBitRate))
+	}
+	return params
+}
+
+// StreamProfile returns the transcoding settings stream URLs are built with.
+func (c *SubsonicConnection) StreamProfile() utils.StreamProfile {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.streamProfile
+}
+
+// SetStreamProfile changes the transcoding settings of the stream URLs built
+// from now on.
+func (c *SubsonicConnection) SetStreamProfile(profile utils.StreamProfile) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.streamProfile = profile
+}
+
 // Search uses the Subsonic search3 API to query a server for all songs that have
 // ID3 tags that match the query. The query is global, in that it matches in any
 // ID3 field.
 // https://www.subsonic.org/pages/api.jsp#search3
-func (c *SubsonicConnection) Search(searchTerm string, artistOffset, albumOffset, songOffset int) (*SubsonicResponse, error) {
+func (c *SubsonicConnection) Search(ctx context.Context, searchTerm string, artistOffset, albumOffset, songOffset int) (*SubsonicResponse, error) {
 	params := url.Values{
 		"query":        []string{searchTerm},
 		"artistOffset": []string{strconv.Itoa(artistOffset)},
@@ -428,15 +644,15 @@ func (c *SubsonicConnection) Search(searchTerm string, artistOffset, albumOffset
 		"songOffset":   []string{strconv.Itoa(songOffset)},
 	}
 	url := c.buildUrl("/rest/search3", params)
-	return c.getResponse(url)
+	return c.getResponse(ctx, url)
 }
 
 // StartScan tells the Subsonic server to initiate a media library scan. Whether
 // this is a deep or surface scan is dependent on the server implementation.
 // https://subsonic.org/pages/api.jsp#startScan
-func (c *SubsonicConnection) StartScan() error {
+func (c *SubsonicConnection) StartScan(ctx context.Context) error {
 	url := c.buildUrl("/rest/startScan", nil)
-	res, err := c.getResponse(url)
+	res, err := c.getResponseOnce(ctx, url)
 	if err != nil {
 		return err
 	} else if !res.ScanStatus.Scanning {
@@ -445,17 +661,19 @@ func (c *SubsonicConnection) StartScan() error {
 	return nil
 }
 
-func (c *SubsonicConnection) SavePlayQueue(queueIds []string, current string, position int) error {
+// SavePlayQueue stores the queue on the server, position is in milliseconds.
+// https://www.subsonic.org/pages/api.jsp#savePlayQueue
+func (c *SubsonicConnection) SavePlayQueue(ctx context.Context, queueIds []string, current string, position int) error {
 	params := url.Values{"current": []string{current}, "position": []string{fmt.Sprintf("%d", position)}}
 	for _, songId := range queueIds {
 		params.Add("id", songId)
 	}
 	url := c.buildUrl("/rest/savePlayQueue", params)
-	_, err := c.getResponse(url)
+	_, err := c.getResponse(ctx, url)
 	return err
 }
 
-func (c *SubsonicConnection) LoadPlayQueue() (*SubsonicResponse, error) {
+func (c *SubsonicConnection) LoadPlayQueue(ctx context.Context) (*SubsonicResponse, error) {
 	url := c.buildUrl("/rest/getPlayQueue", nil)
-	return c.getResponse(url)
+	return c.getResponse(ctx, url)
 }
@@ -0,0 +1,150 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package subsonictest
+
+import "github.com/spezifisch/stmps/service"
+
+// Library is the content served by a Server. IDs must be unique across
+// artists, albums, songs and playlists.
+type Library struct {
+	Artists       []Artist
+	Playlists     []Playlist
+	RadioStations []RadioStation
+	Podcasts      []PodcastChannel
+	Bookmarks     []Bookmark
+
+	// Starred holds the IDs of starred artists, albums and songs. Artists and
+	// albums are starred as folders and ID3 items.
+	Starred []string
+	// Ratings maps IDs of rated artists, albums and songs to their rating.
+	Ratings map[string]int
+}
+
+type Artist struct {
+	Id     string
+	Name   string
+	Albums []Album
+}
+
+type Album struct {
+	Id       string
+	Name     string
+	Year     int
+	Genre    string
+	CoverArt string
+	Songs    []Song
+}
+
+type Song struct {
+	Id         string
+	Title      string
+	Duration   int
+	Track      int
+	DiscNumber int
+	Genre      string
+
+	// unsynced text served by getLyrics and getLyricsBySongId
+	Lyrics string
+	// only served by getLyricsBySongId
+	SyncedLyrics []service.LyricLine
+}
+
+type Playlist struct {
+	Id      string
+	Name    string
+	SongIds []string
+}
+
+type RadioStation struct {
+	Id          string
+	Name        string
+	StreamUrl   string
+	HomePageUrl string
+}
+
+type PodcastChannel struct {
+	Id       string
+	Url      string
+	Title    string
+	Episodes []PodcastEpisode
+}
+
+// PodcastEpisode is streamed with the ID "st-<Id>" once its Status is
+// completed.
+type PodcastEpisode struct {
+	Id          string
+	Title       string
+	PublishDate string
+	Duration    int
+	Status      string
+}
+
+type Bookmark struct {
+	SongId   string
+	Position int64 // milliseconds
+	Comment  string
+}
+
+// Scrobble records a single scrobble request received by the server.
+type Scrobble struct {
+	Id         string
+	Submission bool
+}
+
+// PlayQueue is the queue stored by savePlayQueue.
+type PlayQueue struct {
+	SongIds  []string
+	Current  string
+	Position int64 // milliseconds
+}
+
+// artist, album and song lookups, built once when the server is created
+type index struct {
+	artists map[string]*Artist
+	albums  map[string]*Album
+	songs   map[string]*Song
+
+	albumArtist map[string]*Artist
+	songAlbum   map[string]*Album
+}
+
+func newIndex(library *Library) *index {
+	idx := &index{
+		artists:     map[string]*Artist{},
+		albums:      map[string]*Album{},
+		songs:       map[string]*Song{},
+		albumArtist: map[string]*Artist{},
+		songAlbum:   map[string]*Album{},
+	}
+
+	for i := range library.Artists {
+		artist := &library.Artists[i]
+		idx.artists[artist.Id] = artist
+		for j := range artist.Albums {
+			album := &artist.Albums[j]
+			idx.albums[album.Id] = album
+			idx.albumArtist[album.Id] = artist
+			for k := range album.Songs {
+				song := &album.Songs[k]
+				idx.songs[song.Id] = song
+				idx.songAlbum[song.Id] = album
+			}
+		}
+	}
+
+	return idx
+}
+
+// allSongs returns every song in library order
+func (l *Library) allSongs() []*Song {
+	songs := []*Song{}
+	for i := range l.Artists {
+		for j := range l.Artists[i].Albums {
+			for k := range l.Artists[i].Albums[j].Songs {
+				songs = append(songs, &l.Artists[i].Albums[j].Songs[k])
+			}
+		}
+	}
+	return songs
+}
@@ -0,0 +1,1513 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+// Package subsonictest provides an in-memory Subsonic server for tests. It
+// serves a configurable Library over the regular /rest/* endpoints, checks
+// token/salt and plaintext authentication and keeps playlists, stars,
+// scrobbles and the play queue in memory, so SubsonicConnection can be
+// exercised end-to-end without a live server.
+package subsonictest
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/spezifisch/stmps/consts"
+	"github.com/spezifisch/stmps/service"
+	"github.com/spezifisch/stmps/utils"
+)
+
+const (
+	apiVersion = "1.16.1"
+	// reported to OpenSubsonic clients
+	serverVersion = "1.0.0"
+)
+
+// Subsonic API error codes
+const (
+	ErrorGeneric          = 0
+	ErrorMissingParameter = 10
+	ErrorWrongCredentials = 40
+	ErrorNotAuthorized    = 50
+	ErrorNotFound         = 70
+	// OpenSubsonic
+	ErrorAuthNotSupported = 42
+	ErrorConflictingAuth  = 43
+	ErrorInvalidAPIKey    = 44
+)
+
+type Server struct {
+	*httptest.Server
+
+	Username string
+	Password string
+	// accepted if Extensions has apiKeyAuthentication
+	APIKey string
+	// OpenSubsonic extensions and their versions, a plain Subsonic server if
+	// nil. Set them before making requests.
+	Extensions map[string][]int
+	// the user may not change the internet radio stations, like a user
+	// without admin role
+	RadioReadOnly bool
+	// feed URLs createPodcastChannel fails for, like unreachable feeds
+	BrokenFeeds []string
+
+	mu      sync.Mutex
+	library Library
+	index   *index
+	// changes with the artists, milliseconds like getIndexes' lastModified
+	lastModified int64
+	starred      map[string]struct{}
+	starredID3   map[string]struct{} // see starIds
+	ratings      map[string]int
+	playlists    []Playlist
+	radio        []RadioStation
+	podcasts     []PodcastChannel
+	bookmarks    []Bookmark
+	playQueue    PlayQueue
+	scrobbles    []Scrobble
+	requests     map[string]int
+	formPosts    int
+	nextId       int
+}
+
+type apiError struct {
+	code    int
+	message string
+}
+
+type handler func(s *Server, params url.Values) (map[string]any, *apiError)
+
+var handlers = map[string]handler{
+	"ping":              handlePing,
+	"getIndexes":        handleGetIndexes,
+	"getArtist":         handleGetArtist,
+	"getAlbum":          handleGetAlbum,
+	"getMusicDirectory": handleGetMusicDirectory,
+	"getRandomSongs":    handleGetRandomSongs,
+	"getAlbumList2":     handleGetAlbumList2,
+	"getGenres":         handleGetGenres,
+	"getSongsByGenre":   handleGetSongsByGenre,
+	"getSimilarSongs":   handleGetSimilarSongs,
+	"search3":           handleSearch3,
+	"getPlaylists":      handleGetPlaylists,
+	"getPlaylist":       handleGetPlaylist,
+	"createPlaylist":    handleCreatePlaylist,
+	"updatePlaylist":    handleUpdatePlaylist,
+	"deletePlaylist":    handleDeletePlaylist,
+	"getStarred":        handleGetStarred,
+	"getStarred2":       handleGetStarred2,
+	"star":              handleStar,
+	"unstar":            handleUnstar,
+	"setRating":         handleSetRating,
+	"scrobble":          handleScrobble,
+	"savePlayQueue":     handleSavePlayQueue,
+	"getPlayQueue":      handleGetPlayQueue,
+	"startScan":         handleStartScan,
+	"getLyrics":         handleGetLyrics,
+	"getLyricsBySongId": handleGetLyricsBySongId,
+	"getBookmarks":      handleGetBookmarks,
+	"createBookmark":    handleCreateBookmark,
+	"deleteBookmark":    handleDeleteBookmark,
+
+	"getInternetRadioStations":   handleGetInternetRadioStations,
+	"createInternetRadioStation": handleCreateInternetRadioStation,
+	"updateInternetRadioStation": handleUpdateInternetRadioStation,
+	"deleteInternetRadioStation": handleDeleteInternetRadioStation,
+
+	"getPodcasts":            handleGetPodcasts,
+	"getNewestPodcasts":      handleGetNewestPodcasts,
+	"refreshPodcasts":        handleRefreshPodcasts,
+	"createPodcastChannel":   handleCreatePodcastChannel,
+	"deletePodcastChannel":   handleDeletePodcastChannel,
+	"downloadPodcastEpisode": handleDownloadPodcastEpisode,
+	"deletePodcastEpisode":   handleDeletePodcastEpisode,
+}
+
+// NewServer starts a server serving library to the given user. The caller
+// must call Close when done.
+func NewServer(username, password string, library Library) *Server {
+	s := &Server{
+		Username:  username,
+		Password:  password,
+		library:   library,
+		starred:   map[string]struct{}{},
+		ratings:   maps.Clone(library.Ratings),
+		playlists: slices.Clone(library.Playlists),
+		radio:     slices.Clone(library.RadioStations),
+		podcasts:  clonePodcasts(library.Podcasts),
+		bookmarks: slices.Clone(library.Bookmarks),
+		requests:  map[string]int{},
+		// any fixed time, it only has to increase with changes
+		lastModified: 1700000000000,
+		starredID3:   map[string]struct{}{},
+	}
+	s.index = newIndex(&s.library)
+	if s.ratings == nil {
+		s.ratings = map[string]int{}
+	}
+	for _, id := range library.Starred {
+		s.starred[id] = struct{}{}
+		if _, isSong := s.index.songs[id]; !isSong {
+			s.starredID3[id] = struct{}{}
+		}
+	}
+
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Config returns a client configuration pointing at this server.
+func (s *Server) Config() *utils.Config {
+	return &utils.Config{
+		Username:      s.Username,
+		Password:      s.Password,
+		Host:          s.URL,
+		ClientName:    consts.ClientName,
+		ClientVersion: consts.ClientVersion,
+	}
+}
+
+// Connect returns a SubsonicConnection using Config.
+func (s *Server) Connect() *service.SubsonicConnection {
+	return s.ConnectWith(s.Config())
+}
+
+// ConnectWith returns a SubsonicConnection using conf, which is usually a
+// modified Config.
+func (s *Server) ConnectWith(conf *utils.Config) *service.SubsonicConnection {
+	logger := utils.InitLogger(utils.Warn)
+	go func() {
+		// nobody reads the log in tests
+		for range logger.Output {
+		}
+	}()
+	return service.InitConnection(&configProvider{conf: conf, logger: &logger})
+}
+
+// Requests returns how often endpoint (e.g. "getAlbum") has been called.
+func (s *Server) Requests(endpoint string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[endpoint]
+}
+
+// AddArtist adds artist to the library, like a library scan finding new
+// files.
+func (s *Server) AddArtist(artist Artist) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.library.Artists = append(s.library.Artists, artist)
+	s.index = newIndex(&s.library)
+	s.lastModified++
+}
+
+// RemoveArtist removes the artist with id and its albums from the library.
+func (s *Server) RemoveArtist(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.library.Artists = slices.DeleteFunc(s.library.Artists, func(artist Artist) bool {
+		return artist.Id == id
+	})
+	s.index = newIndex(&s.library)
+	s.lastModified++
+}
+
+// FormPosts returns how many requests sent their parameters as form POST
+// body.
+func (s *Server) FormPosts() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.formPosts
+}
+
+func (s *Server) Scrobbles() []Scrobble {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.scrobbles)
+}
+
+func (s *Server) PlayQueue() PlayQueue {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	queue := s.playQueue
+	queue.SongIds = slices.Clone(queue.SongIds)
+	return queue
+}
+
+func (s *Server) Playlists() []Playlist {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	playlists := make([]Playlist, len(s.playlists))
+	for i, p := range s.playlists {
+		playlists[i] = p
+		playlists[i].SongIds = slices.Clone(p.SongIds)
+	}
+	return playlists
+}
+
+func (s *Server) RadioStations() []RadioStation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.radio)
+}
+
+func (s *Server) Bookmarks() []Bookmark {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.bookmarks)
+}
+
+func (s *Server) Podcasts() []PodcastChannel {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return clonePodcasts(s.podcasts)
+}
+
+func (s *Server) IsStarred(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.starred[id]
+	_, okID3 := s.starredID3[id]
+	return ok || okID3
+}
+
+// Rating returns the rating set for id, 0 if it's unrated.
+func (s *Server) Rating(id string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ratings[id]
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	endpoint, ok := strings.CutPrefix(r.URL.Path, "/rest/")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	endpoint = strings.TrimSuffix(endpoint, ".view")
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	params := r.Form
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests[endpoint]++
+	if r.Method == http.MethodPost && len(r.PostForm) > 0 {
+		s.formPosts++
+	}
+
+	if endpoint == "getOpenSubsonicExtensions" {
+		// public, clients need it to decide how to authenticate
+		s.serveExtensions(w, r)
+		return
+	}
+	if err := s.authenticate(params); err != nil {
+		writeResponse(w, s.failedResponse(err))
+		return
+	}
+
+	if endpoint == "getCoverArt" {
+		// binary response
+		s.serveCoverArt(w, params)
+		return
+	}
+	if endpoint == "download" {
+		s.serveDownload(w, params)
+		return
+	}
+	h, ok := handlers[endpoint]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	payload, err := h(s, params)
+	if err != nil {
+		writeResponse(w, s.failedResponse(err))
+		return
+	}
+	if payload == nil {
+		payload = map[string]any{}
+	}
+	payload["status"] = "ok"
+	writeResponse(w, s.envelope(payload))
+}
+
+func (s *Server) authenticate(params url.Values) *apiError {
+	if apiKey := params.Get("apiKey"); apiKey != "" {
+		if len(s.Extensions["apiKeyAuthentication"]) == 0 {
+			return &apiError{ErrorAuthNotSupported, "Provided authentication mechanism not supported"}
+		}
+		if params.Has("u") {
+			return &apiError{ErrorConflictingAuth, "Multiple conflicting authentication mechanisms provided"}
+		}
+		if apiKey != s.APIKey {
+			return &apiError{ErrorInvalidAPIKey, "Invalid API key"}
+		}
+		return nil
+	}
+
+	username := params.Get("u")
+	if username == "" {
+		return &apiError{ErrorMissingParameter, "Required parameter is missing: u"}
+	}
+
+	var valid bool
+	if password := params.Get("p"); password != "" {
+		if encoded, ok := strings.CutPrefix(password, "enc:"); ok {
+			decoded, err := hex.DecodeString(encoded)
+			if err != nil {
+				return &apiError{ErrorWrongCredentials, "Wrong username or password"}
+			}
+			password = string(decoded)
+		}
+		valid = password == s.Password
+	} else {
+		token, salt := params.Get("t"), params.Get("s")
+		if token == "" || salt == "" {
+			return &apiError{ErrorMissingParameter, "Required parameter is missing: t/s"}
+		}
+		valid = token == fmt.Sprintf("%x", md5.Sum([]byte(s.Password+salt)))
+	}
+
+	if !valid || username != s.Username {
+		return &apiError{ErrorWrongCredentials, "Wrong username or password"}
+	}
+	return nil
+}
+
+func (s *Server) failedResponse(err *apiError) map[string]any {
+	return s.envelope(map[string]any{
+		"status": "failed",
+		"error": service.SubsonicError{
+			Code:    err.code,
+			Message: err.message,
+		},
+	})
+}
+
+// envelope adds the fields every response has
+func (s *Server) envelope(payload map[string]any) map[string]any {
+	payload["version"] = apiVersion
+	if s.Extensions != nil {
+		payload["type"] = "subsonictest"
+		payload["serverVersion"] = serverVersion
+		payload["openSubsonic"] = true
+	}
+	return payload
+}
+
+func (s *Server) serveExtensions(w http.ResponseWriter, r *http.Request) {
+	if s.Extensions == nil {
+		http.NotFound(w, r)
+		return
+	}
+	extensions := []service.OpenSubsonicExtension{}
+	for name, versions := range s.Extensions {
+		extensions = append(extensions, service.OpenSubsonicExtension{Name: name, Versions: versions})
+	}
+	sort.Slice(extensions, func(i, j int) bool { return extensions[i].Name < extensions[j].Name })
+	writeResponse(w, s.envelope(map[string]any{
+		"status":                 "ok",
+		"openSubsonicExtensions": extensions,
+	}))
+}
+
+func writeResponse(w http.ResponseWriter, payload map[string]any) {
+	w.Header().Set("Content-Type", "application/json")
+	// errors can only come from a broken connection, nothing to report to
+	_ = json.NewEncoder(w).Encode(map[string]any{"subsonic-response": payload})
+}
+
+// coverArtPNG is served for every known cover art ID
+var coverArtPNG = func() []byte {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 1, 1))); err != nil {
+		panic(err)
+	}
+	return buf.Bytes()
+}()
+
+func (s *Server) serveCoverArt(w http.ResponseWriter, params url.Values) {
+	id := params.Get("id")
+	for _, album := range s.index.albums {
+		if album.CoverArt != "" && album.CoverArt == id {
+			w.Header().Set("Content-Type", "image/png")
+			_, _ = w.Write(coverArtPNG)
+			return
+		}
+	}
+	writeResponse(w, s.failedResponse(&apiError{ErrorNotFound, "Cover art not found"}))
+}
+
+// songFile is served as the original file of the song with ID id
+func songFile(id string) []byte {
+	return []byte("original file of " + id)
+}
+
+func (s *Server) serveDownload(w http.ResponseWriter, params url.Values) {
+	id := params.Get("id")
+	if _, ok := s.index.songs[id]; !ok {
+		writeResponse(w, s.failedResponse(notFound("Song", id)))
+		return
+	}
+	w.Header().Set("Content-Type", "audio/mpeg")
+	_, _ = w.Write(songFile(id))
+}
+
+// parameter helpers
+
+func requireParam(params url.Values, name string) (string, *apiError) {
+	value := params.Get(name)
+	if value == "" {
+		return "", &apiError{ErrorMissingParameter, "Required parameter is missing: " + name}
+	}
+	return value, nil
+}
+
+func intParam(params url.Values, name string, fallback int) int {
+	if value, err := strconv.Atoi(params.Get(name)); err == nil {
+		return value
+	}
+	return fallback
+}
+
+func notFound(what, id string) *apiError {
+	return &apiError{ErrorNotFound, fmt.Sprintf("%s not found: %s", what, id)}
+}
+
+// conversion to wire types
+
+func (s *Server) songEntity(song *Song) service.SubsonicEntity {
+	album := s.index.songAlbum[song.Id]
+	artist := s.index.albumArtist[album.Id]
+	return service.SubsonicEntity{
+		Id:         song.Id,
+		Parent:     album.Id,
+		Title:      song.Title,
+		ArtistId:   artist.Id,
+		Artist:     artist.Name,
+		Duration:   song.Duration,
+		Track:      song.Track,
+		DiscNumber: song.DiscNumber,
+		Path:       artist.Name + "/" + album.Name + "/" + song.Title + ".mp3",
+		CoverArtId: album.CoverArt,
+		UserRating: s.ratings[song.Id],
+	}
+}
+
+func (s *Server) songGenre(song *Song) string {
+	if song.Genre != "" {
+		return song.Genre
+	}
+	return s.index.songAlbum[song.Id].Genre
+}
+
+func (s *Server) albumEntity(album *Album) service.SubsonicEntity {
+	artist := s.index.albumArtist[album.Id]
+	return service.SubsonicEntity{
+		Id:          album.Id,
+		IsDirectory: true,
+		Parent:      artist.Id,
+		Title:       album.Name,
+		ArtistId:    artist.Id,
+		Artist:      artist.Name,
+		CoverArtId:  album.CoverArt,
+		UserRating:  s.ratings[album.Id],
+	}
+}
+
+func (s *Server) albumInfo(album *Album, withSongs bool) service.Album {
+	artist := s.index.albumArtist[album.Id]
+	result := service.Album{
+		Id:         album.Id,
+		ArtistId:   artist.Id,
+		Artist:     artist.Name,
+		Name:       album.Name,
+		SongCount:  len(album.Songs),
+		Year:       album.Year,
+		Genre:      album.Genre,
+		CoverArt:   album.CoverArt,
+		UserRating: s.ratings[album.Id],
+	}
+	for i := range album.Songs {
+		result.Duration += album.Songs[i].Duration
+		if withSongs {
+			result.Song = append(result.Song, s.songEntity(&album.Songs[i]))
+		}
+	}
+	return result
+}
+
+func (s *Server) artistInfo(artist *Artist) service.Artist {
+	result := service.Artist{
+		Id:         artist.Id,
+		Name:       artist.Name,
+		AlbumCount: len(artist.Albums),
+		Album:      []service.Album{},
+	}
+	for i := range artist.Albums {
+		result.Album = append(result.Album, s.albumInfo(&artist.Albums[i], false))
+	}
+	return result
+}
+
+func (s *Server) playlistInfo(playlist *Playlist) service.SubsonicPlaylist {
+	result := service.SubsonicPlaylist{
+		Id:        service.SubsonicId(playlist.Id),
+		Name:      playlist.Name,
+		SongCount: len(playlist.SongIds),
+		Entries:   service.SubsonicEntities{},
+	}
+	for _, id := range playlist.SongIds {
+		if song, ok := s.index.songs[id]; ok {
+			result.Entries = append(result.Entries, s.songEntity(song))
+		}
+	}
+	return result
+}
+
+func (s *Server) findPlaylist(id string) int {
+	return slices.IndexFunc(s.playlists, func(p Playlist) bool {
+		return p.Id == id
+	})
+}
+
+// endpoint handlers, called with s.mu held
+
+func handlePing(s *Server, params url.Values) (map[string]any, *apiError) {
+	return nil, nil
+}
+
+func handleGetIndexes(s *Server, params url.Values) (map[string]any, *apiError) {
+	indexes := service.SubsonicIndexes{LastModified: s.lastModified, Index: []service.SubsonicIndex{}}
+	if since, err := strconv.ParseInt(params.Get("ifModifiedSince"), 10, 64); err == nil && since >= s.lastModified {
+		// unchanged
+		return map[string]any{"indexes": indexes}, nil
+	}
+
+	byLetter := map[string][]service.SubsonicArtist{}
+	for _, artist := range s.library.Artists {
+		letter := "#"
+		if artist.Name != "" {
+			letter = strings.ToUpper(artist.Name[:1])
+		}
+		byLetter[letter] = append(byLetter[letter], service.SubsonicArtist{
+			Id:         artist.Id,
+			Name:       artist.Name,
+			AlbumCount: len(artist.Albums),
+		})
+	}
+
+	for letter, artists := range byLetter {
+		sort.Slice(artists, func(i, j int) bool { return artists[i].Name < artists[j].Name })
+		indexes.Index = append(indexes.Index, service.SubsonicIndex{Name: letter, Artists: artists})
+	}
+	sort.Slice(indexes.Index, func(i, j int) bool { return indexes.Index[i].Name < indexes.Index[j].Name })
+
+	return map[string]any{"indexes": indexes}, nil
+}
+
+func handleGetArtist(s *Server, params url.Values) (map[string]any, *apiError) {
+	id, err := requireParam(params, "id")
+	if err != nil {
+		return nil, err
+	}
+	artist, ok := s.index.artists[id]
+	if !ok {
+		return nil, notFound("Artist", id)
+	}
+	return map[string]any{"artist": s.artistInfo(artist)}, nil
+}
+
+func handleGetAlbum(s *Server, params url.Values) (map[string]any, *apiError) {
+	id, err := requireParam(params, "id")
+	if err != nil {
+		return nil, err
+	}
+	album, ok := s.index.albums[id]
+	if !ok {
+		return nil, notFound("Album", id)
+	}
+	return map[string]any{"album": s.albumInfo(album, true)}, nil
+}
+
+func handleGetMusicDirectory(s *Server, params url.Values) (map[string]any, *apiError) {
+	id, err := requireParam(params, "id")
+	if err != nil {
+		return nil, err
+	}
+
+	directory := service.SubsonicDirectory{Id: id, Entities: service.SubsonicEntities{}}
+	if artist, ok := s.index.artists[id]; ok {
+		directory.Name = artist.Name
+		for i := range artist.Albums {
+			directory.Entities = append(directory.Entities, s.albumEntity(&artist.Albums[i]))
+		}
+	} else if album, ok := s.index.albums[id]; ok {
+		directory.Name = album.Name
+		directory.Parent = s.index.albumArtist[id].Id
+		for i := range album.Songs {
+			directory.Entities = append(directory.Entities, s.songEntity(&album.Songs[i]))
+		}
+	} else {
+		return nil, notFound("Directory", id)
+	}
+
+	return map[string]any{"directory": directory}, nil
+}
+
+// handleGetRandomSongs isn't random: it returns the first songs of the
+// library so tests are deterministic
+func handleGetRandomSongs(s *Server, params url.Values) (map[string]any, *apiError) {
+	size := intParam(params, "size", 10)
+	songs := service.SubsonicSongs{Song: service.SubsonicEntities{}}
+	for _, song := range s.library.allSongs() {
+		if len(songs.Song) >= size {
+			break
+		}
+		songs.Song = append(songs.Song, s.songEntity(song))
+	}
+	return map[string]any{"randomSongs": songs}, nil
+}
+
+// handleGetAlbumList2 knows no play counts or dates, newest and random are
+// the library order reversed and frequent and recent the library order.
+// highest is sorted by rating.
+func handleGetAlbumList2(s *Server, params url.Values) (map[string]any, *apiError) {
+	listType, err := requireParam(params, "type")
+	if err != nil {
+		return nil, err
+	}
+
+	albums := []*Album{}
+	for i := range s.library.Artists {
+		for j := range s.library.Artists[i].Albums {
+			albums = append(albums, &s.library.Artists[i].Albums[j])
+		}
+	}
+
+	switch listType {
+	case "newest", "random":
+		slices.Reverse(albums)
+	case "frequent", "recent":
+	case "highest":
+		slices.SortStableFunc(albums, func(a, b *Album) int {
+			return s.ratings[b.Id] - s.ratings[a.Id]
+		})
+	case "alphabeticalByName":
+		slices.SortStableFunc(albums, func(a, b *Album) int {
+			return strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+		})
+	case "alphabeticalByArtist":
+		slices.SortStableFunc(albums, func(a, b *Album) int {
+			return strings.Compare(strings.ToLower(s.index.albumArtist[a.Id].Name), strings.ToLower(s.index.albumArtist[b.Id].Name))
+		})
+	case "starred":
+		albums = slices.DeleteFunc(albums, func(a *Album) bool {
+			_, ok := s.starredID3[a.Id]
+			return !ok
+		})
+	case "byYear":
+		from, to := intParam(params, "fromYear", 0), intParam(params, "toYear", 0)
+		descending := from > to
+		if descending {
+			from, to = to, from
+		}
+		albums = slices.DeleteFunc(albums, func(a *Album) bool {
+			return a.Year < from || a.Year > to
+		})
+		slices.SortStableFunc(albums, func(a, b *Album) int {
+			if descending {
+				return b.Year - a.Year
+			}
+			return a.Year - b.Year
+		})
+	case "byGenre":
+		genre, err := requireParam(params, "genre")
+		if err != nil {
+			return nil, err
+		}
+		albums = slices.DeleteFunc(albums, func(a *Album) bool {
+			return a.Genre != genre
+		})
+	default:
+		return nil, &apiError{ErrorGeneric, "Unknown list type: " + listType}
+	}
+
+	offset := min(max(intParam(params, "offset", 0), 0), len(albums))
+	end := min(offset+max(intParam(params, "size", 10), 0), len(albums))
+	list := service.AlbumList{Album: []service.Album{}}
+	for _, album := range albums[offset:end] {
+		list.Album = append(list.Album, s.albumInfo(album, false))
+	}
+	return map[string]any{"albumList2": list}, nil
+}
+
+// handleGetGenres counts the songs by their genre, or their album's genre if
+// they have none.
+func handleGetGenres(s *Server, params url.Values) (map[string]any, *apiError) {
+	counts := map[string]*service.SubsonicGenre{}
+	for _, song := range s.library.allSongs() {
+		name := s.songGenre(song)
+		if name == "" {
+			continue
+		}
+		genre, ok := counts[name]
+		if !ok {
+			genre = &service.SubsonicGenre{Name: name}
+			counts[name] = genre
+		}
+		genre.SongCount++
+	}
+	for _, album := range s.index.albums {
+		seen := map[string]bool{}
+		for i := range album.Songs {
+			name := s.songGenre(&album.Songs[i])
+			if name != "" && !seen[name] {
+				seen[name] = true
+				counts[name].AlbumCount++
+			}
+		}
+	}
+
+	genres := service.SubsonicGenres{Genres: []service.SubsonicGenre{}}
+	for _, genre := range counts {
+		genres.Genres = append(genres.Genres, *genre)
+	}
+	slices.SortFunc(genres.Genres, func(a, b service.SubsonicGenre) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return map[string]any{"genres": genres}, nil
+}
+
+func handleGetSongsByGenre(s *Server, params url.Values) (map[string]any, *apiError) {
+	genre, err := requireParam(params, "genre")
+	if err != nil {
+		return nil, err
+	}
+
+	songs := service.SubsonicEntities{}
+	for _, song := range s.library.allSongs() {
+		if s.songGenre(song) == genre {
+			songs = append(songs, s.songEntity(song))
+		}
+	}
+	offset := min(max(intParam(params, "offset", 0), 0), len(songs))
+	end := min(offset+max(intParam(params, "count", 10), 0), len(songs))
+	return map[string]any{"songsByGenre": service.SubsonicSongs{Song: songs[offset:end]}}, nil
+}
+
+// handleGetSimilarSongs returns the other songs of the same artist
+func handleGetSimilarSongs(s *Server, params url.Values) (map[string]any, *apiError) {
+	id, err := requireParam(params, "id")
+	if err != nil {
+		return nil, err
+	}
+
+	var artist *Artist
+	if a, ok := s.index.artists[id]; ok {
+		artist = a
+	} else if _, ok := s.index.albums[id]; ok {
+		artist = s.index.albumArtist[id]
+	} else if _, ok := s.index.songs[id]; ok {
+		artist = s.index.albumArtist[s.index.songAlbum[id].Id]
+	} else {
+		return nil, notFound("Item", id)
+	}
+
+	count := intParam(params, "count", 50)
+	songs := service.SubsonicSongs{Song: service.SubsonicEntities{}}
+	for i := range artist.Albums {
+		for j := range artist.Albums[i].Songs {
+			song := &artist.Albums[i].Songs[j]
+			if song.Id != id && len(songs.Song) < count {
+				songs.Song = append(songs.Song, s.songEntity(song))
+			}
+		}
+	}
+	return map[string]any{"similarSongs": songs}, nil
+}
+
+func handleSearch3(s *Server, params url.Values) (map[string]any, *apiError) {
+	query := strings.ToLower(strings.Trim(params.Get("query"), `"`))
+	matches := func(name string) bool {
+		return strings.Contains(strings.ToLower(name), query)
+	}
+	page := func(total int, prefix string) (int, int) {
+		offset := min(max(intParam(params, prefix+"Offset", 0), 0), total)
+		count := max(intParam(params, prefix+"Count", 20), 0)
+		return offset, min(offset+count, total)
+	}
+
+	artists := []service.Artist{}
+	albums := []service.Album{}
+	songs := service.SubsonicEntities{}
+	for i := range s.library.Artists {
+		artist := &s.library.Artists[i]
+		if matches(artist.Name) {
+			artists = append(artists, service.Artist{Id: artist.Id, Name: artist.Name, AlbumCount: len(artist.Albums)})
+		}
+		for j := range artist.Albums {
+			album := &artist.Albums[j]
+			if matches(album.Name) {
+				albums = append(albums, s.albumInfo(album, false))
+			}
+			for k := range album.Songs {
+				if matches(album.Songs[k].Title) {
+					songs = append(songs, s.songEntity(&album.Songs[k]))
+				}
+			}
+		}
+	}
+
+	artistFrom, artistTo := page(len(artists), "artist")
+	albumFrom, albumTo := page(len(albums), "album")
+	songFrom, songTo := page(len(songs), "song")
+	return map[string]any{"searchResult3": service.SubsonicResults{
+		Artist: artists[artistFrom:artistTo],
+		Album:  albums[albumFrom:albumTo],
+		Song:   songs[songFrom:songTo],
+	}}, nil
+}
+
+func handleGetPlaylists(s *Server, params url.Values) (map[string]any, *apiError) {
+	playlists := service.SubsonicPlaylists{Playlists: []service.SubsonicPlaylist{}}
+	for i := range s.playlists {
+		playlist := s.playlistInfo(&s.playlists[i])
+		// getPlaylists only returns a summary, entries come from getPlaylist
+		playlist.Entries = nil
+		playlists.Playlists = append(playlists.Playlists, playlist)
+	}
+	return map[string]any{"playlists": playlists}, nil
+}
+
+func handleGetPlaylist(s *Server, params url.Values) (map[string]any, *apiError) {
+	id, err := requireParam(params, "id")
+	if err != nil {
+		return nil, err
+	}
+	i := s.findPlaylist(id)
+	if i < 0 {
+		return nil, notFound("Playlist", id)
+	}
+	return map[string]any{"playlist": s.playlistInfo(&s.playlists[i])}, nil
+}
+
+func handleCreatePlaylist(s *Server, params url.Values) (map[string]any, *apiError) {
+	songIds := params["songId"]
+	for _, id := range songIds {
+		if _, ok := s.index.songs[id]; !ok {
+			return nil, notFound("Song", id)
+		}
+	}
+
+	var i int
+	if id := params.Get("playlistId"); id != "" {
+		if i = s.findPlaylist(id); i < 0 {
+			return nil, notFound("Playlist", id)
+		}
+		s.playlists[i].SongIds = slices.Clone(songIds)
+	} else {
+		name, err := requireParam(params, "name")
+		if err != nil {
+			return nil, err
+		}
+		s.nextId++
+		s.playlists = append(s.playlists, Playlist{
+			Id:      fmt.Sprintf("pl-%d", s.nextId),
+			Name:    name,
+			SongIds: slices.Clone(songIds),
+		})
+		i = len(s.playlists) - 1
+	}
+
+	return map[string]any{"playlist": s.playlistInfo(&s.playlists[i])}, nil
+}
+
+func handleUpdatePlaylist(s *Server, params url.Values) (map[string]any, *apiError) {
+	id, err := requireParam(params, "playlistId")
+	if err != nil {
+		return nil, err
+	}
+	i := s.findPlaylist(id)
+	if i < 0 {
+		return nil, notFound("Playlist", id)
+	}
+	playlist := &s.playlists[i]
+
+	if name := params.Get("name"); name != "" {
+		playlist.Name = name
+	}
+
+	// indexes refer to the playlist before any change, remove from the back
+	var remove []int
+	for _, index := range params["songIndexToRemove"] {
+		n, convErr := strconv.Atoi(index)
+		if convErr != nil || n < 0 || n >= len(playlist.SongIds) {
+			return nil, &apiError{ErrorGeneric, "Invalid song index: " + index}
+		}
+		remove = append(remove, n)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(remove)))
+	for _, n := range slices.Compact(remove) {
+		playlist.SongIds = slices.Delete(playlist.SongIds, n, n+1)
+	}
+
+	for _, songId := range params["songIdToAdd"] {
+		if _, ok := s.index.songs[songId]; !ok {
+			return nil, notFound("Song", songId)
+		}
+		playlist.SongIds = append(playlist.SongIds, songId)
+	}
+
+	return nil, nil
+}
+
+func handleDeletePlaylist(s *Server, params url.Values) (map[string]any, *apiError) {
+	id, err := requireParam(params, "id")
+	if err != nil {
+		return nil, err
+	}
+	i := s.findPlaylist(id)
+	if i < 0 {
+		return nil, notFound("Playlist", id)
+	}
+	s.playlists = slices.Delete(s.playlists, i, i+1)
+	return nil, nil
+}
+
+func handleGetStarred(s *Server, params url.Values) (map[string]any, *apiError) {
+	return map[string]any{"starred": s.starredResults(s.starred)}, nil
+}
+
+// handleGetStarred2 is getStarred with the artists and albums starred by
+// artistId and albumId. The library's folders and ID3 items share their IDs,
+// but their stars are separate like on real servers.
+func handleGetStarred2(s *Server, params url.Values) (map[string]any, *apiError) {
+	return map[string]any{"starred2": s.starredResults(s.starredID3)}, nil
+}
+
+// starredResults lists the songs starred by id and the artists and albums in
+// starredDirectories
+func (s *Server) starredResults(starredDirectories map[string]struct{}) service.SubsonicResults {
+	starred := service.SubsonicResults{
+		Artist: []service.Artist{},
+		Album:  []service.Album{},
+		Song:   service.SubsonicEntities{},
+	}
+	for i := range s.library.Artists {
+		artist := &s.library.Artists[i]
+		if _, ok := starredDirectories[artist.Id]; ok {
+			starred.Artist = append(starred.Artist, service.Artist{Id: artist.Id, Name: artist.Name, AlbumCount: len(artist.Albums)})
+		}
+		for j := range artist.Albums {
+			album := &artist.Albums[j]
+			if _, ok := starredDirectories[album.Id]; ok {
+				starred.Album = append(starred.Album, s.albumInfo(album, false))
+			}
+			for k := range album.Songs {
+				if _, ok := s.starred[album.Songs[k].Id]; ok {
+					starred.Song = append(starred.Song, s.songEntity(&album.Songs[k]))
+				}
+			}
+		}
+	}
+	return starred
+}
+
+// starIds returns the star set and the IDs the id, albumId or artistId
+// parameter of star/unstar refers to. id takes songs and folders, the others
+// only ID3 albums and artists.
+func (s *Server) starIds(params url.Values) (map[string]struct{}, []string, *apiError) {
+	kinds := []struct {
+		param   string
+		starred map[string]struct{}
+		exists  func(id string) bool
+	}{
+		{"id", s.starred, func(id string) bool {
+			_, isArtist := s.index.artists[id]
+			_, isAlbum := s.index.albums[id]
+			_, isSong := s.index.songs[id]
+			return isArtist || isAlbum || isSong
+		}},
+		{"albumId", s.starredID3, func(id string) bool {
+			_, ok := s.index.albums[id]
+			return ok
+		}},
+		{"artistId", s.starredID3, func(id string) bool {
+			_, ok := s.index.artists[id]
+			return ok
+		}},
+	}
+	for _, kind := range kinds {
+		ids := params[kind.param]
+		if len(ids) == 0 {
+			continue
+		}
+		for _, id := range ids {
+			if !kind.exists(id) {
+				return nil, nil, notFound("Item", id)
+			}
+		}
+		return kind.starred, ids, nil
+	}
+	return nil, nil, &apiError{ErrorMissingParameter, "Required parameter is missing: id"}
+}
+
+func handleStar(s *Server, params url.Values) (map[string]any, *apiError) {
+	starred, ids, err := s.starIds(params)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		starred[id] = struct{}{}
+	}
+	return nil, nil
+}
+
+func handleSetRating(s *Server, params url.Values) (map[string]any, *apiError) {
+	id, err := requireParam(params, "id")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := requireParam(params, "rating"); err != nil {
+		return nil, err
+	}
+	rating := intParam(params, "rating", -1)
+	if rating < 0 || rating > 5 {
+		return nil, &apiError{ErrorGeneric, "Invalid rating: " + params.Get("rating")}
+	}
+	_, isSong := s.index.songs[id]
+	_, isAlbum := s.index.albums[id]
+	_, isArtist := s.index.artists[id]
+	if !isSong && !isAlbum && !isArtist {
+		return nil, &apiError{ErrorNotFound, "Not found: " + id}
+	}
+
+	if rating == 0 {
+		delete(s.ratings, id)
+	} else {
+		s.ratings[id] = rating
+	}
+	return nil, nil
+}
+
+func handleUnstar(s *Server, params url.Values) (map[string]any, *apiError) {
+	starred, ids, err := s.starIds(params)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		delete(starred, id)
+	}
+	return nil, nil
+}
+
+func handleScrobble(s *Server, params url.Values) (map[string]any, *apiError) {
+	if _, err := requireParam(params, "id"); err != nil {
+		return nil, err
+	}
+	// submission defaults to true
+	submission := params.Get("submission") != "false"
+	for _, id := range params["id"] {
+		if _, ok := s.index.songs[id]; !ok {
+			return nil, notFound("Song", id)
+		}
+		s.scrobbles = append(s.scrobbles, Scrobble{Id: id, Submission: submission})
+	}
+	return nil, nil
+}
+
+func handleSavePlayQueue(s *Server, params url.Values) (map[string]any, *apiError) {
+	ids := params["id"]
+	for _, id := range ids {
+		if _, ok := s.index.songs[id]; !ok {
+			return nil, notFound("Song", id)
+		}
+	}
+	position, _ := strconv.ParseInt(params.Get("position"), 10, 64)
+	s.playQueue = PlayQueue{
+		SongIds:  slices.Clone(ids),
+		Current:  params.Get("current"),
+		Position: position,
+	}
+	return nil, nil
+}
+
+func handleGetPlayQueue(s *Server, params url.Values) (map[string]any, *apiError) {
+	if len(s.playQueue.SongIds) == 0 {
+		return nil, nil
+	}
+	queue := service.PlayQueue{
+		Current:  s.playQueue.Current,
+		Position: int(s.playQueue.Position),
+	}
+	for _, id := range s.playQueue.SongIds {
+		queue.Entries = append(queue.Entries, s.songEntity(s.index.songs[id]))
+	}
+	return map[string]any{"playQueue": queue}, nil
+}
+
+func handleGetBookmarks(s *Server, params url.Values) (map[string]any, *apiError) {
+	bookmarks := []service.Bookmark{}
+	for _, bookmark := range s.bookmarks {
+		bookmarks = append(bookmarks, service.Bookmark{
+			Position: bookmark.Position,
+			Comment:  bookmark.Comment,
+			Entry:    s.songEntity(s.index.songs[bookmark.SongId]),
+		})
+	}
+	return map[string]any{"bookmarks": map[string]any{"bookmark": bookmarks}}, nil
+}
+
+// handleCreateBookmark replaces the song's bookmark if it has one
+func handleCreateBookmark(s *Server, params url.Values) (map[string]any, *apiError) {
+	id, err := requireParam(params, "id")
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := s.index.songs[id]; !ok {
+		return nil, notFound("Song", id)
+	}
+	positionParam, err := requireParam(params, "position")
+	if err != nil {
+		return nil, err
+	}
+	position, parseErr := strconv.ParseInt(positionParam, 10, 64)
+	if parseErr != nil {
+		return nil, &apiError{ErrorGeneric, "Invalid position: " + positionParam}
+	}
+
+	bookmark := Bookmark{SongId: id, Position: position, Comment: params.Get("comment")}
+	i := slices.IndexFunc(s.bookmarks, func(b Bookmark) bool {
+		return b.SongId == id
+	})
+	if i < 0 {
+		s.bookmarks = append(s.bookmarks, bookmark)
+	} else {
+		s.bookmarks[i] = bookmark
+	}
+	return nil, nil
+}
+
+func handleDeleteBookmark(s *Server, params url.Values) (map[string]any, *apiError) {
+	id, err := requireParam(params, "id")
+	if err != nil {
+		return nil, err
+	}
+	i := slices.IndexFunc(s.bookmarks, func(b Bookmark) bool {
+		return b.SongId == id
+	})
+	if i < 0 {
+		return nil, notFound("Bookmark", id)
+	}
+	s.bookmarks = slices.Delete(s.bookmarks, i, i+1)
+	return nil, nil
+}
+
+func handleStartScan(s *Server, params url.Values) (map[string]any, *apiError) {
+	return map[string]any{"scanStatus": service.ScanStatus{
+		Scanning: true,
+		Count:    len(s.index.songs),
+	}}, nil
+}
+
+type configProvider struct {
+	conf   *utils.Config
+	logger utils.Logger
+}
+
+func (c *configProvider) Conf() *utils.Config {
+	return c.conf
+}
+
+func (c *configProvider) Log() utils.Logger {
+	return c.logger
+}
+
+func handleGetLyrics(s *Server, params url.Values) (map[string]any, *apiError) {
+	artist, title := params.Get("artist"), params.Get("title")
+	for _, song := range s.index.songs {
+		songArtist := s.index.albumArtist[s.index.songAlbum[song.Id].Id]
+		if strings.EqualFold(song.Title, title) && strings.EqualFold(songArtist.Name, artist) {
+			return map[string]any{"lyrics": service.Lyrics{
+				Artist: songArtist.Name,
+				Title:  song.Title,
+				Value:  song.Lyrics,
+			}}, nil
+		}
+	}
+	// missing lyrics aren't an error
+	return map[string]any{"lyrics": service.Lyrics{}}, nil
+}
+
+func handleGetLyricsBySongId(s *Server, params url.Values) (map[string]any, *apiError) {
+	id, err := requireParam(params, "id")
+	if err != nil {
+		return nil, err
+	}
+	song, ok := s.index.songs[id]
+	if !ok {
+		return nil, notFound("Song", id)
+	}
+
+	list := service.LyricsList{StructuredLyrics: []service.StructuredLyrics{}}
+	if song.Lyrics != "" {
+		lyrics := service.StructuredLyrics{Lang: "xxx"}
+		for _, line := range strings.Split(song.Lyrics, "\n") {
+			lyrics.Lines = append(lyrics.Lines, service.LyricLine{Value: line})
+		}
+		list.StructuredLyrics = append(list.StructuredLyrics, lyrics)
+	}
+	if len(song.SyncedLyrics) > 0 {
+		list.StructuredLyrics = append(list.StructuredLyrics, service.StructuredLyrics{
+			Lang:   "xxx",
+			Synced: true,
+			Lines:  song.SyncedLyrics,
+		})
+	}
+	return map[string]any{"lyricsList": list}, nil
+}
+
+func handleGetInternetRadioStations(s *Server, params url.Values) (map[string]any, *apiError) {
+	stations := make([]service.InternetRadioStation, len(s.radio))
+	for i, station := range s.radio {
+		stations[i] = service.InternetRadioStation{
+			Id:          station.Id,
+			Name:        station.Name,
+			StreamUrl:   station.StreamUrl,
+			HomePageUrl: station.HomePageUrl,
+		}
+	}
+	return map[string]any{"internetRadioStations": map[string]any{"internetRadioStation": stations}}, nil
+}
+
+// radioStation checks the parameters of create/updateInternetRadioStation
+func (s *Server) radioStation(params url.Values) (RadioStation, *apiError) {
+	if s.RadioReadOnly {
+		return RadioStation{}, &apiError{ErrorNotAuthorized, "User is not authorized to manage radio stations"}
+	}
+	name, err := requireParam(params, "name")
+	if err != nil {
+		return RadioStation{}, err
+	}
+	streamUrl, err := requireParam(params, "streamUrl")
+	if err != nil {
+		return RadioStation{}, err
+	}
+	return RadioStation{Name: name, StreamUrl: streamUrl, HomePageUrl: params.Get("homepageUrl")}, nil
+}
+
+func (s *Server) findRadioStation(params url.Values) (int, *apiError) {
+	id, err := requireParam(params, "id")
+	if err != nil {
+		return -1, err
+	}
+	i := slices.IndexFunc(s.radio, func(station RadioStation) bool {
+		return station.Id == id
+	})
+	if i < 0 {
+		return -1, notFound("Radio station", id)
+	}
+	return i, nil
+}
+
+func handleCreateInternetRadioStation(s *Server, params url.Values) (map[string]any, *apiError) {
+	station, err := s.radioStation(params)
+	if err != nil {
+		return nil, err
+	}
+	s.nextId++
+	station.Id = fmt.Sprintf("ra-%d", s.nextId)
+	s.radio = append(s.radio, station)
+	return nil, nil
+}
+
+func handleUpdateInternetRadioStation(s *Server, params url.Values) (map[string]any, *apiError) {
+	station, err := s.radioStation(params)
+	if err != nil {
+		return nil, err
+	}
+	i, err := s.findRadioStation(params)
+	if err != nil {
+		return nil, err
+	}
+	station.Id = s.radio[i].Id
+	s.radio[i] = station
+	return nil, nil
+}
+
+func handleDeleteInternetRadioStation(s *Server, params url.Values) (map[string]any, *apiError) {
+	if s.RadioReadOnly {
+		return nil, &apiError{ErrorNotAuthorized, "User is not authorized to manage radio stations"}
+	}
+	i, err := s.findRadioStation(params)
+	if err != nil {
+		return nil, err
+	}
+	s.radio = slices.Delete(s.radio, i, i+1)
+	return nil, nil
+}
+
+func clonePodcasts(channels []PodcastChannel) []PodcastChannel {
+	channels = slices.Clone(channels)
+	for i := range channels {
+		channels[i].Episodes = slices.Clone(channels[i].Episodes)
+	}
+	return channels
+}
+
+func podcastEpisodeResponse(channel *PodcastChannel, episode PodcastEpisode) service.PodcastEpisode {
+	response := service.PodcastEpisode{
+		Id:          episode.Id,
+		ChannelId:   channel.Id,
+		Title:       episode.Title,
+		PublishDate: episode.PublishDate,
+		Status:      episode.Status,
+		Album:       channel.Title,
+		Duration:    episode.Duration,
+	}
+	if episode.Status == service.PodcastStatusCompleted {
+		response.StreamId = "st-" + episode.Id
+	}
+	return response
+}
+
+func handleGetPodcasts(s *Server, params url.Values) (map[string]any, *apiError) {
+	id := params.Get("id")
+	includeEpisodes := params.Get("includeEpisodes") != "false"
+
+	channels := []service.PodcastChannel{}
+	for i := range s.podcasts {
+		channel := &s.podcasts[i]
+		if id != "" && channel.Id != id {
+			continue
+		}
+		response := service.PodcastChannel{
+			Id:     channel.Id,
+			Url:    channel.Url,
+			Title:  channel.Title,
+			Status: service.PodcastStatusCompleted,
+		}
+		if includeEpisodes {
+			for _, episode := range channel.Episodes {
+				response.Episodes = append(response.Episodes, podcastEpisodeResponse(channel, episode))
+			}
+		}
+		channels = append(channels, response)
+	}
+	if id != "" && len(channels) == 0 {
+		return nil, notFound("Podcast channel", id)
+	}
+	return map[string]any{"podcasts": map[string]any{"channel": channels}}, nil
+}
+
+func handleGetNewestPodcasts(s *Server, params url.Values) (map[string]any, *apiError) {
+	count := intParam(params, "count", 20)
+
+	episodes := []service.PodcastEpisode{}
+	for i := range s.podcasts {
+		for _, episode := range s.podcasts[i].Episodes {
+			episodes = append(episodes, podcastEpisodeResponse(&s.podcasts[i], episode))
+		}
+	}
+	// the dates are ISO 8601, they sort as strings
+	slices.SortStableFunc(episodes, func(a, b service.PodcastEpisode) int {
+		return strings.Compare(b.PublishDate, a.PublishDate)
+	})
+	if len(episodes) > count {
+		episodes = episodes[:count]
+	}
+	return map[string]any{"newestPodcasts": map[string]any{"episode": episodes}}, nil
+}
+
+func handleRefreshPodcasts(s *Server, params url.Values) (map[string]any, *apiError) {
+	return nil, nil
+}
+
+func handleCreatePodcastChannel(s *Server, params url.Values) (map[string]any, *apiError) {
+	feedUrl, err := requireParam(params, "url")
+	if err != nil {
+		return nil, err
+	}
+	if slices.Contains(s.BrokenFeeds, feedUrl) {
+		return nil, &apiError{ErrorGeneric, "Podcast feed could not be read"}
+	}
+
+	s.nextId++
+	s.podcasts = append(s.podcasts, PodcastChannel{
+		Id:    fmt.Sprintf("pc-%d", s.nextId),
+		Url:   feedUrl,
+		Title: feedUrl,
+	})
+	return nil, nil
+}
+
+func handleDeletePodcastChannel(s *Server, params url.Values) (map[string]any, *apiError) {
+	id, err := requireParam(params, "id")
+	if err != nil {
+		return nil, err
+	}
+	i := slices.IndexFunc(s.podcasts, func(channel PodcastChannel) bool {
+		return channel.Id == id
+	})
+	if i < 0 {
+		return nil, notFound("Podcast channel", id)
+	}
+	s.podcasts = slices.Delete(s.podcasts, i, i+1)
+	return nil, nil
+}
+
+// findPodcastEpisode returns the episode with the ID given in params
+func (s *Server) findPodcastEpisode(params url.Values) (*PodcastEpisode, *apiError) {
+	id, err := requireParam(params, "id")
+	if err != nil {
+		return nil, err
+	}
+	for i := range s.podcasts {
+		for j := range s.podcasts[i].Episodes {
+			if s.podcasts[i].Episodes[j].Id == id {
+				return &s.podcasts[i].Episodes[j], nil
+			}
+		}
+	}
+	return nil, notFound("Podcast episode", id)
+}
+
+// handleDownloadPodcastEpisode completes the download right away
+func handleDownloadPodcastEpisode(s *Server, params url.Values) (map[string]any, *apiError) {
+	episode, err := s.findPodcastEpisode(params)
+	if err != nil {
+		return nil, err
+	}
+	episode.Status = service.PodcastStatusCompleted
+	return nil, nil
+}
+
+func handleDeletePodcastEpisode(s *Server, params url.Values) (map[string]any, *apiError) {
+	episode, err := s.findPodcastEpisode(params)
+	if err != nil {
+		return nil, err
+	}
+	episode.Status = service.PodcastStatusDeleted
+	return nil, nil
+}
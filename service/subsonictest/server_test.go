@@ -0,0 +1,841 @@
+package subsonictest
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spezifisch/stmps/service"
+	"github.com/spezifisch/stmps/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testLibrary() Library {
+	return Library{
+		Artists: []Artist{
+			{Id: "ar-1", Name: "Boards of Canada", Albums: []Album{
+				{Id: "al-1", Name: "Music Has the Right to Children", Year: 1998, CoverArt: "co-1", Songs: []Song{
+					{Id: "so-1", Title: "Wildlife Analysis", Duration: 77, Track: 1, Lyrics: "first\nsecond"},
+					{Id: "so-2", Title: "An Eagle in Your Mind", Duration: 383, Track: 2, SyncedLyrics: []service.LyricLine{
+						{Start: 1000, Value: "first"},
+						{Start: 5000, Value: "second"},
+					}},
+				}},
+				{Id: "al-2", Name: "Geogaddi", Year: 2002, Genre: "IDM", Songs: []Song{
+					{Id: "so-3", Title: "Music Is Math", Duration: 321, Track: 3, Genre: "Electronic"},
+				}},
+			}},
+			{Id: "ar-2", Name: "Autechre", Albums: []Album{
+				{Id: "al-3", Name: "Amber", Year: 1994, Genre: "IDM", Songs: []Song{
+					{Id: "so-4", Title: "Foil", Duration: 402, Track: 1},
+				}},
+			}},
+		},
+		Playlists: []Playlist{
+			{Id: "pl-existing", Name: "Favourites", SongIds: []string{"so-2", "so-4"}},
+		},
+		RadioStations: []RadioStation{
+			{Id: "ra-existing", Name: "SomaFM Drone Zone", StreamUrl: "https://ice.somafm.com/dronezone", HomePageUrl: "https://somafm.com/dronezone/"},
+		},
+		Podcasts: []PodcastChannel{
+			{Id: "pc-existing", Url: "https://feeds.example.com/talk.xml", Title: "Talk", Episodes: []PodcastEpisode{
+				{Id: "pe-1", Title: "Pilot", PublishDate: "2023-01-02T10:00:00.000Z", Duration: 1800, Status: "completed"},
+				{Id: "pe-2", Title: "Second", PublishDate: "2023-01-09T10:00:00.000Z", Duration: 2400, Status: "new"},
+			}},
+		},
+		Bookmarks: []Bookmark{
+			{SongId: "so-4", Position: 90000},
+		},
+		Starred: []string{"so-3"},
+	}
+}
+
+func newTestServer(t *testing.T) (*Server, *service.SubsonicConnection) {
+	server := NewServer("admin", "secret", testLibrary())
+	t.Cleanup(server.Close)
+
+	return server, server.Connect()
+}
+
+func TestAuthentication(t *testing.T) {
+	server, connection := newTestServer(t)
+	ctx := context.Background()
+
+	response, err := connection.GetServerInfo(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "ok", response.Status)
+
+	connection.Conf().PlaintextAuth = true
+	response, err = connection.GetServerInfo(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "ok", response.Status)
+
+	connection.Conf().Password = "wrong"
+	_, err = connection.GetServerInfo(ctx)
+	assert.ErrorIs(t, err, service.ErrAuthFailed)
+	var apiErr *service.APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, ErrorWrongCredentials, apiErr.Code)
+	assert.Equal(t, "Wrong username or password", apiErr.Message)
+
+	assert.Equal(t, 3, server.Requests("ping"))
+}
+
+func TestCapabilities(t *testing.T) {
+	server, connection := newTestServer(t)
+	ctx := context.Background()
+
+	// plain Subsonic
+	capabilities, err := connection.DetectCapabilities(ctx)
+	require.NoError(t, err)
+	assert.False(t, capabilities.OpenSubsonic)
+	assert.Equal(t, "1.16.1", capabilities.APIVersion)
+	assert.False(t, capabilities.Supports(service.ExtensionFormPost))
+
+	server.Extensions = map[string][]int{
+		service.ExtensionFormPost:   {1},
+		service.ExtensionAPIKeyAuth: {1},
+	}
+	server.APIKey = "key"
+	conf := server.Config()
+	conf.APIKey = "key"
+	conf.Password = "unused"
+	connection = server.ConnectWith(conf)
+	assert.False(t, connection.UsesAPIKey(), "nothing is supported before detection")
+
+	capabilities, err = connection.DetectCapabilities(ctx)
+	require.NoError(t, err)
+	assert.True(t, capabilities.OpenSubsonic)
+	assert.Equal(t, "subsonictest", capabilities.ServerType)
+	assert.True(t, capabilities.SupportsVersion(service.ExtensionAPIKeyAuth, 1))
+	assert.False(t, capabilities.Supports(service.ExtensionSongLyrics))
+	assert.Equal(t, capabilities, connection.Capabilities())
+	assert.True(t, connection.UsesAPIKey())
+
+	formPosts := server.FormPosts()
+	response, err := connection.GetIndexes(ctx)
+	require.NoError(t, err)
+	assert.Len(t, response.Indexes.Index, 2)
+	assert.Equal(t, formPosts+1, server.FormPosts())
+
+	conf.APIKey = "wrong"
+	_, err = connection.GetServerInfo(ctx)
+	assert.ErrorIs(t, err, service.ErrAuthFailed)
+
+	// user and password are used if the server doesn't take API keys
+	server.Extensions = map[string][]int{}
+	conf = server.Config()
+	conf.APIKey = "key"
+	connection = server.ConnectWith(conf)
+	_, err = connection.DetectCapabilities(ctx)
+	require.NoError(t, err)
+	assert.False(t, connection.UsesAPIKey())
+
+	// without a password the key is used right away
+	server.Extensions = map[string][]int{service.ExtensionAPIKeyAuth: {1}}
+	conf = server.Config()
+	conf.APIKey = "key"
+	conf.Password = ""
+	connection = server.ConnectWith(conf)
+	assert.True(t, connection.UsesAPIKey())
+	_, err = connection.GetIndexes(ctx)
+	require.NoError(t, err)
+}
+
+func TestBrowsing(t *testing.T) {
+	_, connection := newTestServer(t)
+	ctx := context.Background()
+
+	response, err := connection.GetIndexes(ctx)
+	require.NoError(t, err)
+	require.Len(t, response.Indexes.Index, 2)
+	assert.Equal(t, "A", response.Indexes.Index[0].Name)
+	assert.Equal(t, "Autechre", response.Indexes.Index[0].Artists[0].Name)
+	assert.Equal(t, "B", response.Indexes.Index[1].Name)
+
+	response, err = connection.GetArtist(ctx, "ar-1")
+	require.NoError(t, err)
+	assert.Equal(t, "Boards of Canada", response.Artist.Name)
+	assert.Len(t, response.Artist.Album, 2)
+
+	response, err = connection.GetAlbum(ctx, "al-1")
+	require.NoError(t, err)
+	assert.Equal(t, "Music Has the Right to Children", response.Album.Name)
+	require.Len(t, response.Album.Song, 2)
+	assert.Equal(t, "Wildlife Analysis", response.Album.Song[0].Title)
+	assert.Equal(t, "al-1", response.Album.Song[0].Parent)
+	assert.Equal(t, 460, response.Album.Duration)
+
+	response, err = connection.GetMusicDirectory(ctx, "ar-1")
+	require.NoError(t, err)
+	require.Len(t, response.Directory.Entities, 2)
+	assert.True(t, response.Directory.Entities[0].IsDirectory)
+
+	response, err = connection.GetMusicDirectory(ctx, "al-2")
+	require.NoError(t, err)
+	assert.Equal(t, "ar-1", response.Directory.Parent)
+	assert.Equal(t, "Music Is Math", response.Directory.Entities[0].Title)
+
+	art, err := connection.GetCoverArt(ctx, "co-1", 0)
+	require.NoError(t, err)
+	assert.NotNil(t, art)
+}
+
+func TestCoverArtCache(t *testing.T) {
+	server, _ := newTestServer(t)
+	ctx := context.Background()
+
+	conf := server.Config()
+	conf.CoverArtCacheDir = t.TempDir()
+	conf.CoverArtCacheSize = 1024 * 1024
+	connection := server.ConnectWith(conf)
+
+	for i := 0; i < 2; i++ {
+		art, err := connection.GetCoverArt(ctx, "co-1", 0)
+		require.NoError(t, err)
+		assert.NotNil(t, art)
+	}
+	assert.Equal(t, 1, server.Requests("getCoverArt"))
+
+	// other sizes are separate
+	_, err := connection.GetCoverArt(ctx, "co-1", 300)
+	require.NoError(t, err)
+	assert.Equal(t, 2, server.Requests("getCoverArt"))
+
+	// a new connection finds them on disk
+	connection = server.ConnectWith(conf)
+	art, err := connection.GetCoverArt(ctx, "co-1", 300)
+	require.NoError(t, err)
+	assert.NotNil(t, art)
+	assert.Equal(t, 2, server.Requests("getCoverArt"))
+}
+
+func TestLibraryCache(t *testing.T) {
+	server, _ := newTestServer(t)
+	ctx := context.Background()
+
+	conf := server.Config()
+	conf.LibraryCacheFile = filepath.Join(t.TempDir(), "library.json")
+	conf.LibraryCacheTTL = time.Hour
+	connection := server.ConnectWith(conf)
+
+	for i := 0; i < 2; i++ {
+		_, err := connection.GetIndexes(ctx)
+		require.NoError(t, err)
+		_, err = connection.GetArtist(ctx, "ar-1")
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 1, server.Requests("getIndexes"))
+	assert.Equal(t, 1, server.Requests("getArtist"))
+
+	response, changed, err := connection.RevalidateIndexes(ctx)
+	require.NoError(t, err)
+	assert.False(t, changed)
+	assert.Len(t, response.Indexes.Index, 2)
+	assert.Equal(t, 2, server.Requests("getIndexes"))
+	require.NoError(t, connection.SaveCache())
+
+	// a new connection starts from the file
+	connection = server.ConnectWith(conf)
+	response, err = connection.GetIndexes(ctx)
+	require.NoError(t, err)
+	assert.Len(t, response.Indexes.Index, 2)
+	response, err = connection.GetArtist(ctx, "ar-1")
+	require.NoError(t, err)
+	assert.Equal(t, "Boards of Canada", response.Artist.Name)
+	assert.Equal(t, 2, server.Requests("getIndexes"))
+	assert.Equal(t, 1, server.Requests("getArtist"))
+
+	// changes on the server expire the cached artists
+	server.AddArtist(Artist{Id: "ar-3", Name: "Aphex Twin"})
+	response, changed, err = connection.RevalidateIndexes(ctx)
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Len(t, response.Indexes.Index[0].Artists, 2)
+	_, err = connection.GetArtist(ctx, "ar-1")
+	require.NoError(t, err)
+	assert.Equal(t, 2, server.Requests("getArtist"))
+
+	// an empty library is a change too
+	for _, id := range []string{"ar-1", "ar-2", "ar-3"} {
+		server.RemoveArtist(id)
+	}
+	response, changed, err = connection.RevalidateIndexes(ctx)
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Empty(t, response.Indexes.Index)
+
+	// outdated entries are used while the server is gone
+	connection.RemoveCacheEntry("ar-1")
+	server.Close()
+	response, err = connection.GetArtist(ctx, "ar-1")
+	require.NoError(t, err)
+	assert.Equal(t, "Boards of Canada", response.Artist.Name)
+	_, err = connection.GetArtist(ctx, "ar-2")
+	assert.Error(t, err)
+}
+
+func TestLyrics(t *testing.T) {
+	server, connection := newTestServer(t)
+	ctx := context.Background()
+
+	lyrics, err := connection.GetLyrics(ctx, "so-1", "boards of canada", "wildlife analysis")
+	require.NoError(t, err)
+	require.NotNil(t, lyrics)
+	assert.False(t, lyrics.Synced)
+	assert.Equal(t, "Wildlife Analysis", lyrics.DisplayTitle)
+	assert.Equal(t, []service.LyricLine{{Value: "first"}, {Value: "second"}}, lyrics.Lines)
+
+	// synced lyrics need OpenSubsonic
+	lyrics, err = connection.GetLyrics(ctx, "so-2", "Boards of Canada", "An Eagle in Your Mind")
+	require.NoError(t, err)
+	assert.Nil(t, lyrics)
+	assert.Equal(t, 0, server.Requests("getLyricsBySongId"))
+
+	server.Extensions = map[string][]int{service.ExtensionSongLyrics: {1}}
+	_, err = connection.DetectCapabilities(ctx)
+	require.NoError(t, err)
+	lyrics, err = connection.GetLyrics(ctx, "so-2", "Boards of Canada", "An Eagle in Your Mind")
+	require.NoError(t, err)
+	require.NotNil(t, lyrics)
+	assert.True(t, lyrics.Synced)
+	assert.Len(t, lyrics.Lines, 2)
+
+	// falls back to getLyrics if there are none by ID
+	lyrics, err = connection.GetLyrics(ctx, "so-3", "Boards of Canada", "Music Is Math")
+	require.NoError(t, err)
+	assert.Nil(t, lyrics)
+	assert.Equal(t, 2, server.Requests("getLyricsBySongId"))
+	assert.Equal(t, 3, server.Requests("getLyrics"))
+}
+
+func TestErrors(t *testing.T) {
+	_, connection := newTestServer(t)
+	ctx := context.Background()
+
+	_, err := connection.GetAlbum(ctx, "al-missing")
+	assert.ErrorIs(t, err, service.ErrNotFound)
+	assert.NotErrorIs(t, err, service.ErrAuthFailed)
+
+	// requests without response data
+	assert.ErrorIs(t, connection.DeletePlaylist(ctx, "pl-missing"), service.ErrNotFound)
+
+	_, err = connection.GetCoverArt(ctx, "co-missing", 0)
+	assert.ErrorIs(t, err, service.ErrNotFound)
+
+	_, err = connection.GetPlaylist(ctx, "")
+	var apiErr *service.APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, ErrorMissingParameter, apiErr.Code)
+	assert.Equal(t, "GetPlaylist", apiErr.Caller)
+}
+
+func TestSearch(t *testing.T) {
+	_, connection := newTestServer(t)
+	ctx := context.Background()
+
+	response, err := connection.Search(ctx, "music", 0, 0, 0)
+	require.NoError(t, err)
+	assert.Empty(t, response.SearchResults.Artist)
+	require.Len(t, response.SearchResults.Album, 1)
+	assert.Equal(t, "al-1", response.SearchResults.Album[0].Id)
+	require.Len(t, response.SearchResults.Song, 1)
+	assert.Equal(t, "so-3", response.SearchResults.Song[0].Id)
+
+	// paging past the results returns nothing
+	response, err = connection.Search(ctx, "music", 0, 1, 1)
+	require.NoError(t, err)
+	assert.Empty(t, response.SearchResults.Album)
+	assert.Empty(t, response.SearchResults.Song)
+}
+
+func TestAlbumList(t *testing.T) {
+	server, connection := newTestServer(t)
+	ctx := context.Background()
+	ids := func(response *service.SubsonicResponse) (ids []string) {
+		for _, album := range response.AlbumList.Album {
+			ids = append(ids, album.Id)
+		}
+		return
+	}
+
+	response, err := connection.GetAlbumList(ctx, service.AlbumListQuery{Type: service.AlbumListAlphabeticalByName, Size: 10})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"al-3", "al-2", "al-1"}, ids(response))
+	assert.Equal(t, "Autechre", response.AlbumList.Album[0].Artist)
+
+	// paging
+	response, err = connection.GetAlbumList(ctx, service.AlbumListQuery{Type: service.AlbumListAlphabeticalByName, Size: 2, Offset: 2})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"al-1"}, ids(response))
+	response, err = connection.GetAlbumList(ctx, service.AlbumListQuery{Type: service.AlbumListNewest, Size: 2, Offset: 3})
+	require.NoError(t, err)
+	assert.Empty(t, response.AlbumList.Album)
+
+	response, err = connection.GetAlbumList(ctx, service.AlbumListQuery{Type: service.AlbumListByYear, Size: 10, FromYear: 2010, ToYear: 1995})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"al-2", "al-1"}, ids(response))
+
+	_, err = connection.ToggleStar(ctx, service.StarAlbum, "al-3", map[string]struct{}{})
+	require.NoError(t, err)
+	response, err = connection.GetAlbumList(ctx, service.AlbumListQuery{Type: service.AlbumListStarred, Size: 10})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"al-3"}, ids(response))
+
+	_, err = connection.GetAlbumList(ctx, service.AlbumListQuery{Type: service.AlbumListByGenre, Size: 10})
+	assert.Error(t, err, "genre is missing")
+	assert.Equal(t, 6, server.Requests("getAlbumList2"))
+}
+
+func TestGenres(t *testing.T) {
+	_, connection := newTestServer(t)
+	ctx := context.Background()
+
+	response, err := connection.GetGenres(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []service.SubsonicGenre{
+		{Name: "Electronic", SongCount: 1, AlbumCount: 1},
+		{Name: "IDM", SongCount: 1, AlbumCount: 1},
+	}, response.Genres.Genres)
+
+	response, err = connection.GetSongsByGenre(ctx, "Electronic", 10, 0)
+	require.NoError(t, err)
+	require.Len(t, response.SongsByGenre.Song, 1)
+	assert.Equal(t, "so-3", response.SongsByGenre.Song[0].Id)
+
+	response, err = connection.GetSongsByGenre(ctx, "Electronic", 10, 1)
+	require.NoError(t, err)
+	assert.Empty(t, response.SongsByGenre.Song)
+}
+
+func TestPlaylists(t *testing.T) {
+	server, connection := newTestServer(t)
+	ctx := context.Background()
+
+	response, err := connection.CreatePlaylist(ctx, "", "New", []string{"so-1", "so-3"})
+	require.NoError(t, err)
+	assert.Equal(t, "New", response.Playlist.Name)
+	assert.Equal(t, 2, response.Playlist.SongCount)
+	newId := string(response.Playlist.Id)
+
+	response, err = connection.CreatePlaylist(ctx, "pl-existing", "", []string{"so-1"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, response.Playlist.SongCount)
+
+	require.NoError(t, connection.AddSongToPlaylist(ctx, newId, "so-4"))
+	require.NoError(t, connection.RemoveSongFromPlaylist(ctx, newId, 0))
+
+	response, err = connection.GetPlaylists(ctx)
+	require.NoError(t, err)
+	require.Len(t, response.Playlists.Playlists, 2)
+	entries := response.Playlists.Playlists[1].Entries
+	require.Len(t, entries, 2)
+	assert.Equal(t, "so-3", entries[0].Id)
+	assert.Equal(t, "so-4", entries[1].Id)
+
+	require.NoError(t, connection.DeletePlaylist(ctx, "pl-existing"))
+	playlists := server.Playlists()
+	require.Len(t, playlists, 1)
+	assert.Equal(t, newId, playlists[0].Id)
+}
+
+func TestStarsAndScrobbles(t *testing.T) {
+	server, connection := newTestServer(t)
+	ctx := context.Background()
+
+	response, err := connection.GetStarred(ctx)
+	require.NoError(t, err)
+	require.Len(t, response.Starred.Song, 1)
+	assert.Equal(t, "so-3", response.Starred.Song[0].Id)
+
+	starred := map[string]struct{}{"so-3": {}}
+	_, err = connection.ToggleStar(ctx, service.StarItem, "so-3", starred)
+	require.NoError(t, err)
+	assert.False(t, server.IsStarred("so-3"))
+	_, err = connection.ToggleStar(ctx, service.StarAlbum, "al-3", starred)
+	require.NoError(t, err)
+	_, err = connection.ToggleStar(ctx, service.StarArtist, "ar-1", starred)
+	require.NoError(t, err)
+	assert.True(t, server.IsStarred("al-3"))
+
+	response, err = connection.GetStarred2(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, response.Starred2.Song)
+	require.Len(t, response.Starred2.Album, 1)
+	assert.Equal(t, "Amber", response.Starred2.Album[0].Name)
+	require.Len(t, response.Starred2.Artist, 1)
+	assert.Equal(t, "Boards of Canada", response.Starred2.Artist[0].Name)
+
+	// the ID3 stars aren't folder stars
+	response, err = connection.GetStarred(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, response.Starred.Album)
+
+	// unstarring needs the parameter of the kind
+	starred = map[string]struct{}{"al-3": {}, "ar-1": {}}
+	_, err = connection.ToggleStar(ctx, service.StarItem, "al-3", starred)
+	require.NoError(t, err)
+	response, err = connection.GetStarred2(ctx)
+	require.NoError(t, err)
+	assert.Len(t, response.Starred2.Album, 1, "unstarring the folder leaves the album starred")
+	_, err = connection.ToggleStar(ctx, service.StarAlbum, "al-3", starred)
+	require.NoError(t, err)
+	_, err = connection.ToggleStar(ctx, service.StarArtist, "ar-1", starred)
+	require.NoError(t, err)
+	response, err = connection.GetStarred2(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, response.Starred2.Album)
+	assert.Empty(t, response.Starred2.Artist)
+
+	_, err = connection.ToggleStar(ctx, service.StarAlbum, "so-1", map[string]struct{}{})
+	assert.ErrorIs(t, err, service.ErrNotFound)
+
+	_, err = connection.ScrobbleSubmission(ctx, "so-1", false)
+	require.NoError(t, err)
+	_, err = connection.ScrobbleSubmission(ctx, "so-1", true)
+	require.NoError(t, err)
+	assert.Equal(t, []Scrobble{{"so-1", false}, {"so-1", true}}, server.Scrobbles())
+}
+
+func TestRatings(t *testing.T) {
+	server, connection := newTestServer(t)
+	ctx := context.Background()
+
+	require.NoError(t, connection.SetRating(ctx, "so-1", 4))
+	require.NoError(t, connection.SetRating(ctx, "al-3", 5))
+	assert.Equal(t, 4, server.Rating("so-1"))
+
+	response, err := connection.GetAlbum(ctx, "al-1")
+	require.NoError(t, err)
+	assert.Equal(t, 4, response.Album.Song[0].UserRating)
+	assert.Equal(t, 0, response.Album.Song[1].UserRating)
+
+	response, err = connection.GetAlbumList(ctx, service.AlbumListQuery{Type: service.AlbumListHighest, Size: 1})
+	require.NoError(t, err)
+	require.Len(t, response.AlbumList.Album, 1)
+	assert.Equal(t, "al-3", response.AlbumList.Album[0].Id)
+	assert.Equal(t, 5, response.AlbumList.Album[0].UserRating)
+
+	require.NoError(t, connection.SetRating(ctx, "so-1", 0))
+	assert.Equal(t, 0, server.Rating("so-1"))
+
+	err = connection.SetRating(ctx, "so-1", 6)
+	assert.Error(t, err)
+	err = connection.SetRating(ctx, "missing", 1)
+	assert.ErrorIs(t, err, service.ErrNotFound)
+}
+
+func TestInternetRadio(t *testing.T) {
+	server, connection := newTestServer(t)
+	ctx := context.Background()
+
+	response, err := connection.GetInternetRadioStations(ctx)
+	require.NoError(t, err)
+	require.Len(t, response.InternetRadioStations.Stations, 1)
+	station := response.InternetRadioStations.Stations[0]
+	assert.Equal(t, "SomaFM Drone Zone", station.Name)
+	assert.Equal(t, "https://ice.somafm.com/dronezone", station.StreamUrl)
+	assert.Equal(t, "https://somafm.com/dronezone/", station.HomePageUrl)
+
+	require.NoError(t, connection.CreateInternetRadioStation(ctx, "Office", "https://radio.example.com/live", ""))
+	require.NoError(t, connection.UpdateInternetRadioStation(ctx, "ra-existing", "Drone Zone", "https://ice.somafm.com/dronezone-128", "https://somafm.com/"))
+	stations := server.RadioStations()
+	require.Len(t, stations, 2)
+	assert.Equal(t, RadioStation{Id: "ra-existing", Name: "Drone Zone", StreamUrl: "https://ice.somafm.com/dronezone-128", HomePageUrl: "https://somafm.com/"}, stations[0])
+	assert.Equal(t, "Office", stations[1].Name)
+	assert.Empty(t, stations[1].HomePageUrl)
+
+	require.NoError(t, connection.DeleteInternetRadioStation(ctx, "ra-existing"))
+	response, err = connection.GetInternetRadioStations(ctx)
+	require.NoError(t, err)
+	require.Len(t, response.InternetRadioStations.Stations, 1)
+	assert.Equal(t, stations[1].Id, response.InternetRadioStations.Stations[0].Id)
+
+	err = connection.DeleteInternetRadioStation(ctx, "missing")
+	assert.ErrorIs(t, err, service.ErrNotFound)
+
+	server.RadioReadOnly = true
+	err = connection.CreateInternetRadioStation(ctx, "Denied", "https://radio.example.com/denied", "")
+	assert.ErrorIs(t, err, service.ErrNotAuthorized)
+	assert.Len(t, server.RadioStations(), 1)
+}
+
+func TestPlayQueue(t *testing.T) {
+	server, connection := newTestServer(t)
+	ctx := context.Background()
+
+	response, err := connection.LoadPlayQueue(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, response.PlayQueue.Entries)
+
+	require.NoError(t, connection.SavePlayQueue(ctx, []string{"so-2", "so-4"}, "so-2", 42))
+	assert.Equal(t, PlayQueue{SongIds: []string{"so-2", "so-4"}, Current: "so-2", Position: 42}, server.PlayQueue())
+
+	response, err = connection.LoadPlayQueue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "so-2", response.PlayQueue.Current)
+	assert.Equal(t, 42, response.PlayQueue.Position)
+	require.Len(t, response.PlayQueue.Entries, 2)
+	assert.Equal(t, "Foil", response.PlayQueue.Entries[1].Title)
+}
+
+func TestRandomSongs(t *testing.T) {
+	_, connection := newTestServer(t)
+	ctx := context.Background()
+	connection.Conf().RandomSongNumber = 3
+
+	response, err := connection.GetRandomSongs(ctx, "", "random")
+	require.NoError(t, err)
+	assert.Len(t, response.RandomSongs.Song, 3)
+
+	response, err = connection.GetRandomSongs(ctx, "so-1", "similar")
+	require.NoError(t, err)
+	require.Len(t, response.SimilarSongs.Song, 2)
+	assert.Equal(t, "so-2", response.SimilarSongs.Song[0].Id)
+}
+
+func TestPodcasts(t *testing.T) {
+	server, connection := newTestServer(t)
+	ctx := context.Background()
+
+	response, err := connection.GetPodcasts(ctx, "", true)
+	require.NoError(t, err)
+	require.Len(t, response.Podcasts.Channels, 1)
+	channel := response.Podcasts.Channels[0]
+	assert.Equal(t, "Talk", channel.Title)
+	require.Len(t, channel.Episodes, 2)
+	assert.Equal(t, "st-pe-1", channel.Episodes[0].StreamId)
+	assert.Equal(t, service.PodcastStatusNew, channel.Episodes[1].Status)
+	assert.Empty(t, channel.Episodes[1].StreamId)
+
+	response, err = connection.GetPodcasts(ctx, "pc-existing", false)
+	require.NoError(t, err)
+	require.Len(t, response.Podcasts.Channels, 1)
+	assert.Empty(t, response.Podcasts.Channels[0].Episodes)
+	_, err = connection.GetPodcasts(ctx, "missing", false)
+	assert.ErrorIs(t, err, service.ErrNotFound)
+
+	response, err = connection.GetNewestPodcasts(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, response.NewestPodcasts.Episodes, 1)
+	assert.Equal(t, "pe-2", response.NewestPodcasts.Episodes[0].Id)
+
+	require.NoError(t, connection.DownloadPodcastEpisode(ctx, "pe-2"))
+	require.NoError(t, connection.DeletePodcastEpisode(ctx, "pe-1"))
+	episodes := server.Podcasts()[0].Episodes
+	assert.Equal(t, service.PodcastStatusDeleted, episodes[0].Status)
+	assert.Equal(t, service.PodcastStatusCompleted, episodes[1].Status)
+	err = connection.DownloadPodcastEpisode(ctx, "missing")
+	assert.ErrorIs(t, err, service.ErrNotFound)
+
+	require.NoError(t, connection.RefreshPodcasts(ctx))
+	assert.Equal(t, 1, server.Requests("refreshPodcasts"))
+
+	server.BrokenFeeds = []string{"https://broken.example.com/feed"}
+	assert.Error(t, connection.CreatePodcastChannel(ctx, "https://broken.example.com/feed"))
+	require.NoError(t, connection.CreatePodcastChannel(ctx, "https://feeds.example.com/news.xml"))
+	require.NoError(t, connection.DeletePodcastChannel(ctx, "pc-existing"))
+	channels := server.Podcasts()
+	require.Len(t, channels, 1)
+	assert.Equal(t, "https://feeds.example.com/news.xml", channels[0].Url)
+}
+
+func TestBookmarks(t *testing.T) {
+	server, connection := newTestServer(t)
+	ctx := context.Background()
+
+	response, err := connection.GetBookmarks(ctx)
+	require.NoError(t, err)
+	require.Len(t, response.Bookmarks.Bookmarks, 1)
+	bookmark := response.Bookmarks.Bookmarks[0]
+	assert.Equal(t, int64(90000), bookmark.Position)
+	assert.Equal(t, "so-4", bookmark.Entry.Id)
+	assert.Equal(t, "Foil", bookmark.Entry.Title)
+
+	require.NoError(t, connection.CreateBookmark(ctx, "so-2", 120000, "halfway"))
+	require.NoError(t, connection.CreateBookmark(ctx, "so-4", 180000, ""))
+	assert.Equal(t, []Bookmark{
+		{SongId: "so-4", Position: 180000},
+		{SongId: "so-2", Position: 120000, Comment: "halfway"},
+	}, server.Bookmarks())
+
+	require.NoError(t, connection.DeleteBookmark(ctx, "so-4"))
+	response, err = connection.GetBookmarks(ctx)
+	require.NoError(t, err)
+	require.Len(t, response.Bookmarks.Bookmarks, 1)
+	assert.Equal(t, "so-2", response.Bookmarks.Bookmarks[0].Entry.Id)
+
+	err = connection.CreateBookmark(ctx, "missing", 1000, "")
+	assert.ErrorIs(t, err, service.ErrNotFound)
+	err = connection.DeleteBookmark(ctx, "so-4")
+	assert.ErrorIs(t, err, service.ErrNotFound)
+}
+
+func TestStreamProfile(t *testing.T) {
+	server := NewServer("admin", "secret", testLibrary())
+	t.Cleanup(server.Close)
+	conf := server.Config()
+	mobile := utils.StreamProfile{Name: "mobile", Format: "opus", MaxBitRate: 128}
+	conf.StreamProfiles = []utils.StreamProfile{utils.OriginalStreamProfile, mobile}
+	conf.StreamProfile = "mobile"
+	connection := server.ConnectWith(conf)
+
+	query := func() url.Values {
+		uri, err := url.Parse(connection.GetPlayUrl(&service.SubsonicEntity{Id: "so-1"}))
+		require.NoError(t, err)
+		return uri.Query()
+	}
+
+	assert.Equal(t, mobile, connection.StreamProfile())
+	assert.Equal(t, "so-1", query().Get("id"))
+	assert.Equal(t, "opus", query().Get("format"))
+	assert.Equal(t, "128", query().Get("maxBitRate"))
+
+	connection.SetStreamProfile(utils.OriginalStreamProfile)
+	assert.False(t, query().Has("format"))
+	assert.False(t, query().Has("maxBitRate"))
+}
+
+func TestStreamTimeOffset(t *testing.T) {
+	server := NewServer("admin", "secret", testLibrary())
+	t.Cleanup(server.Close)
+	conf := server.Config()
+	mobile := utils.StreamProfile{Name: "mobile", Format: "opus"}
+	conf.StreamProfiles = []utils.StreamProfile{utils.OriginalStreamProfile, mobile}
+	conf.StreamProfile = "mobile"
+	connection := server.ConnectWith(conf)
+	song := &service.SubsonicEntity{Id: "so-1"}
+
+	// mpv seeks unless the server supports offsets
+	_, err := connection.DetectCapabilities(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, connection.GetPlayUrlAt(song, 30))
+
+	server.Extensions = map[string][]int{service.ExtensionTranscodeOffset: {1}}
+	_, err = connection.DetectCapabilities(context.Background())
+	require.NoError(t, err)
+	uri, err := url.Parse(connection.GetPlayUrlAt(song, 30))
+	require.NoError(t, err)
+	assert.Equal(t, "30", uri.Query().Get("timeOffset"))
+	assert.Equal(t, "opus", uri.Query().Get("format"))
+
+	// untranscoded streams can be seeked in
+	connection.SetStreamProfile(utils.OriginalStreamProfile)
+	assert.Empty(t, connection.GetPlayUrlAt(song, 30))
+}
+
+func TestOffline(t *testing.T) {
+	server := NewServer("admin", "secret", testLibrary())
+	t.Cleanup(server.Close)
+	conf := server.Config()
+	conf.OfflineDir = t.TempDir()
+	conf.OfflineSize = 1024 * 1024
+	connection := server.ConnectWith(conf)
+	ctx := context.Background()
+
+	require.NoError(t, connection.MarkOffline(ctx, service.OfflineDirectory, "ar-1", "Boards of Canada"))
+	require.NoError(t, connection.MarkOffline(ctx, service.OfflinePlaylist, "pl-existing", "Favourites"))
+	assert.True(t, connection.IsMarkedOffline(service.OfflinePlaylist, "pl-existing"))
+	assert.False(t, connection.IsMarkedOffline(service.OfflinePlaylist, "ar-1"))
+	assert.False(t, connection.IsOffline("so-1"), "songs are downloaded by syncing")
+
+	var progress []int
+	err := connection.SyncOffline(ctx, func(done, total int) {
+		progress = append(progress, done)
+		// so-2 is in both
+		assert.Equal(t, 4, total)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2, 3, 4}, progress)
+	assert.Equal(t, 4, server.Requests("download"))
+
+	// played from the local file
+	path := connection.GetPlayUrl(&service.SubsonicEntity{Id: "so-4"})
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, songFile("so-4"), data)
+
+	// survives restarts
+	connection = server.ConnectWith(conf)
+	assert.True(t, connection.IsOffline("so-1"))
+	assert.Len(t, connection.OfflineMarks(), 2)
+
+	// songs removed from the playlist are deleted
+	require.NoError(t, connection.RemoveSongFromPlaylist(ctx, "pl-existing", 1))
+	require.NoError(t, connection.SyncOffline(ctx, nil))
+	assert.False(t, connection.IsOffline("so-4"))
+	assert.NoFileExists(t, path)
+	assert.Equal(t, 4, server.Requests("download"))
+
+	// so-2 is still needed by the playlist
+	so1 := connection.GetPlayUrl(&service.SubsonicEntity{Id: "so-1"})
+	require.NoError(t, connection.UnmarkOffline(service.OfflineDirectory, "ar-1"))
+	assert.False(t, connection.IsOffline("so-1"))
+	assert.True(t, connection.IsOffline("so-2"))
+	assert.NoFileExists(t, so1)
+	assert.Contains(t, connection.GetPlayUrl(&service.SubsonicEntity{Id: "so-1"}), "/rest/stream")
+
+	// deleted playlists are unmarked
+	require.NoError(t, connection.DeletePlaylist(ctx, "pl-existing"))
+	require.NoError(t, connection.SyncOffline(ctx, nil))
+	assert.Empty(t, connection.OfflineMarks())
+	assert.False(t, connection.IsOffline("so-2"))
+}
+
+func TestOfflineAlbum(t *testing.T) {
+	server := NewServer("admin", "secret", testLibrary())
+	t.Cleanup(server.Close)
+	conf := server.Config()
+	conf.OfflineDir = t.TempDir()
+	conf.OfflineSize = 1024 * 1024
+	connection := server.ConnectWith(conf)
+	ctx := context.Background()
+
+	// ID3 albums are resolved with getAlbum
+	require.NoError(t, connection.MarkOffline(ctx, service.OfflineAlbum, "al-1", "Music Has the Right to Children"))
+	assert.True(t, connection.IsMarkedOffline(service.OfflineAlbum, "al-1"))
+	assert.False(t, connection.IsMarkedOffline(service.OfflineDirectory, "al-1"))
+	require.NoError(t, connection.SyncOffline(ctx, nil))
+	assert.Equal(t, 1, server.Requests("getAlbum"))
+	assert.True(t, connection.IsOffline("so-1"))
+	assert.True(t, connection.IsOffline("so-2"))
+	assert.False(t, connection.IsOffline("so-4"))
+
+	require.NoError(t, connection.UnmarkOffline(service.OfflineAlbum, "al-1"))
+	assert.False(t, connection.IsOffline("so-1"))
+}
+
+func TestOfflineCacheFull(t *testing.T) {
+	server := NewServer("admin", "secret", testLibrary())
+	t.Cleanup(server.Close)
+	conf := server.Config()
+	conf.OfflineDir = t.TempDir()
+	// room for two songs
+	conf.OfflineSize = int64(len(songFile("so-1")) * 2)
+	connection := server.ConnectWith(conf)
+	ctx := context.Background()
+
+	require.NoError(t, connection.MarkOffline(ctx, service.OfflineDirectory, "al-1", "Music Has the Right to Children"))
+	require.NoError(t, connection.MarkOffline(ctx, service.OfflineSong, "so-4", "Foil"))
+	err := connection.SyncOffline(ctx, nil)
+	assert.ErrorIs(t, err, service.ErrOfflineCacheFull)
+	assert.True(t, connection.IsOffline("so-1"))
+	assert.True(t, connection.IsOffline("so-2"))
+	assert.False(t, connection.IsOffline("so-4"))
+
+	// unknown songs fail without stopping the sync
+	require.NoError(t, connection.UnmarkOffline(service.OfflineDirectory, "al-1"))
+	require.NoError(t, connection.MarkOffline(ctx, service.OfflineSong, "so-missing", "Missing"))
+	err = connection.SyncOffline(ctx, nil)
+	assert.ErrorIs(t, err, service.ErrNotFound)
+	assert.True(t, connection.IsOffline("so-4"))
+
+	conf.OfflineSize = 0
+	connection = server.ConnectWith(conf)
+	err = connection.MarkOffline(ctx, service.OfflineSong, "so-1", "Wildlife Analysis")
+	assert.ErrorIs(t, err, service.ErrOfflineDisabled)
+}
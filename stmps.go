@@ -4,6 +4,8 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
@@ -12,6 +14,7 @@ import (
 	"runtime"
 	"runtime/debug"
 	"runtime/pprof"
+	"time"
 
 	"github.com/spezifisch/stmps/gui"
 	"github.com/spezifisch/stmps/mpvplayer"
@@ -30,10 +33,13 @@ var (
 
 const DEVELOPMENT = "development"
 
+// capabilitiesTimeout limits asking the server for its features at startup
+const capabilitiesTimeout = 10 * time.Second
+
 var Version string = DEVELOPMENT
 
 func readConfig(configFile *string) error {
-	required_properties := []string{"auth.username", "auth.password", "server.host"}
+	required_properties := []string{"server.host"}
 
 	if configFile != nil && *configFile != "" {
 		viper.SetConfigFile(*configFile)
@@ -59,6 +65,9 @@ func readConfig(configFile *string) error {
 	}
 
 	// validate
+	if !viper.IsSet("auth.apikey") {
+		required_properties = append(required_properties, "auth.username", "auth.password")
+	}
 	for _, prop := range required_properties {
 		if !viper.IsSet(prop) {
 			return fmt.Errorf("Config property %s is required\n", prop)
@@ -90,29 +99,20 @@ func parseConfig() {
 	}
 }
 
-// initCommandHandler sets up tview-command as main input handler
-func initCommandHandler(logger utils.Logger) {
+// loadKeyBindings loads the user's key bindings on top of the defaults
+func loadKeyBindings(logger utils.Logger, path string) (*gui.KeyBindings, error) {
 	tviewcommand.SetLogHandler(func(msg string) {
 		logger.Info(msg)
 	})
 
-	configPath := "HACK.commands.toml"
-
-	// Load the configuration file
-	config, err := tviewcommand.LoadConfig(configPath)
-	if err != nil || config == nil {
-		logger.Error("Failed to load command-shortcut config", err)
-	}
-
-	// env := keybinding.SetupEnvironment()
-	// keybinding.RegisterCommands(env)
+	return gui.LoadKeyBindings(path)
 }
 
 // return codes:
 // 0 - OK
 // 1 - generic errors
 // 2 - main config errors
-// 2 - keybinding config errors
+// 3 - keybinding config errors
 func main() {
 	// parse flags and config
 	help := flag.Bool("help", false, "Print usage")
@@ -168,12 +168,16 @@ func main() {
 
 	conf := utils.InitConfigProvider()
 
-	initCommandHandler(conf.Log())
+	keyBindings, err := loadKeyBindings(conf.Log(), conf.Conf().KeyBindingsFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load key bindings from '%s': %v\n", conf.Conf().KeyBindingsFile, err)
+		osExit(3)
+	}
 
 	// Start with building the base connection so we can figure out if there is any auth dance requiered
 	connection := service.InitConnection(conf)
 
-	authHeader, authValue, err := connection.GetAuthToken("Main")
+	authHeader, authValue, err := connection.GetAuthToken(context.Background(), "Main")
 	if err != nil {
 		fmt.Println("Unable to get authorization token to SSO")
 		osExit(1)
@@ -189,6 +193,7 @@ func main() {
 		fmt.Println("Unable to initialize mpv. Is mpv installed?")
 		osExit(1)
 	}
+	player.SetReplayGainMode(mpvplayer.ParseReplayGainMode(conf.Conf().ReplayGain))
 
 	var mprisPlayer *remote.MprisPlayer
 	// init mpris2 player control (linux only but fails gracefully on other systems)
@@ -218,9 +223,24 @@ func main() {
 		return
 	}
 
-	indexResponse, err := connection.GetIndexes()
+	// optional features and the API key depend on the server. An unreachable
+	// server mustn't delay starting with the cached library for long.
+	detectCtx, cancelDetect := context.WithTimeout(context.Background(), capabilitiesTimeout)
+	_, err = connection.DetectCapabilities(detectCtx)
+	cancelDetect()
+	if err != nil {
+		var apiErr *service.APIError
+		if errors.As(err, &apiErr) {
+			fmt.Printf("Error connecting to the server: %s\n", err)
+			osExit(1)
+		}
+		// the library may be cached
+		conf.Log().Warn("Server unreachable, optional features are disabled: %v", err)
+	}
+
+	indexResponse, err := connection.GetIndexes(context.Background())
 	if err != nil {
-		fmt.Printf("Error fetching playlists from server: %s\n", err)
+		fmt.Printf("Error fetching indexes from server: %s\n", err)
 		osExit(1)
 	}
 
@@ -235,13 +255,13 @@ func main() {
 			fmt.Printf("    [%d] %s\n", pl.Entries.Len(), pl.Name)
 		}
 		fmt.Printf("  Indexes:\n")
-		for _, pl := range indexResponse.Indexes {
+		for _, pl := range indexResponse.Indexes.Index {
 			fmt.Printf("    %s\n", pl.Name)
 		}
 		fmt.Printf("Playlist response: (this can take a while)\n")
-		playlistResponse, err := connection.GetPlaylists()
+		playlistResponse, err := connection.GetPlaylists(context.Background())
 		if err != nil {
-			fmt.Printf("Error fetching indexes from server: %s\n", err)
+			fmt.Printf("Error fetching playlists from server: %s\n", err)
 			osExit(1)
 		}
 		fmt.Printf("  Directory: %s\n", playlistResponse.Directory.Name)
@@ -253,7 +273,7 @@ func main() {
 			fmt.Printf("    [%d] %s\n", pl.Entries.Len(), pl.Name)
 		}
 		fmt.Printf("  Indexes:\n")
-		for _, pl := range playlistResponse.Indexes {
+		for _, pl := range playlistResponse.Indexes.Index {
 			fmt.Printf("    %s\n", pl.Name)
 		}
 
@@ -266,9 +286,10 @@ func main() {
 		return
 	}
 
-	ui := gui.InitGui(&indexResponse.Indexes,
+	ui := gui.InitGui(&indexResponse.Indexes.Index,
 		connection,
 		player,
+		keyBindings,
 		conf.Log(),
 		mprisPlayer)
 
@@ -1,6 +1,11 @@
 package utils
 
 import (
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
 	"github.com/spezifisch/stmps/consts"
 	"github.com/spf13/viper"
 )
@@ -10,10 +15,25 @@ type ConfigProvider interface {
 	Conf() *Config
 }
 
+// StreamProfile sets how the server transcodes streamed songs.
+type StreamProfile struct {
+	Name string
+	// e.g. opus or mp3, "" leaves it to the server
+	Format string
+	// kbit/s, 0 for no limit
+	MaxBitRate int
+}
+
+// OriginalStreamProfile streams the songs as the server's settings say,
+// usually untranscoded.
+var OriginalStreamProfile = StreamProfile{Name: "original"}
+
 type Config struct {
 	Username      string
 	Password      string
 	PlaintextAuth bool
+	// used instead of user name and password if the server supports it
+	APIKey string
 
 	Authentik bool
 	ClientId  string
@@ -21,9 +41,50 @@ type Config struct {
 
 	Host     string
 	Scrobble bool
+	// requests taking longer are aborted, 0 waits forever
+	RequestTimeout time.Duration
+	// how often requests that only read data are repeated after failing
+	RequestRetries int
+	// save the queue on the server while playing and offer it on startup
+	SyncPlayQueue bool
 
 	RandomSongNumber uint
 
+	// off, track, album or auto
+	ReplayGain string
+
+	// transcoding settings that can be switched between, starting with
+	// OriginalStreamProfile, and the name of the one used on startup
+	StreamProfiles []StreamProfile
+	StreamProfile  string
+
+	// songs longer than this are bookmarked on the server when they're
+	// paused, skipped or stmps quits, 0 disables it
+	BookmarkThreshold time.Duration
+
+	// save the local queue on quit and restore it on startup
+	PersistQueue  bool
+	ResumePlaying bool
+	StateFile     string
+
+	// downloaded cover arts, limited to CoverArtCacheSize bytes. No disk cache
+	// if the dir is empty.
+	CoverArtCacheDir  string
+	CoverArtCacheSize int64
+
+	// artists, albums and directories saved for the next start, they are
+	// refetched when older than LibraryCacheTTL (never if 0)
+	LibraryCacheFile string
+	LibraryCacheTTL  time.Duration
+
+	// songs marked available offline, limited to OfflineSize bytes.
+	// Disabled if the dir is empty or the size 0.
+	OfflineDir  string
+	OfflineSize int64
+
+	// tview-command toml file with key bindings per context
+	KeyBindingsFile string
+
 	Spinner string
 
 	PlayerOptions map[string]string
@@ -44,13 +105,71 @@ func InitConfig() *Config {
 	}
 	conf.Username = viper.GetString("auth.username")
 	conf.Password = viper.GetString("auth.password")
+	conf.APIKey = viper.GetString("auth.apikey")
 	conf.Authentik = viper.GetBool("sso.authentik")
 	conf.ClientId = viper.GetString("sso.clientid")
 	conf.AuthURL = viper.GetString("sso.authurl")
 	conf.Host = viper.GetString("server.host")
 	conf.PlaintextAuth = viper.GetBool("auth.plaintext")
 	conf.Scrobble = viper.GetBool("server.scrobble")
+	viper.SetDefault("server.timeout", 30*time.Second)
+	conf.RequestTimeout = viper.GetDuration("server.timeout")
+	viper.SetDefault("server.retries", 2)
+	conf.RequestRetries = viper.GetInt("server.retries")
+	conf.SyncPlayQueue = viper.GetBool("server.sync-queue")
 	conf.RandomSongNumber = viper.GetUint("client.random-songs")
+	conf.ReplayGain = viper.GetString("client.replaygain")
+
+	conf.StreamProfiles, conf.StreamProfile = streamProfiles()
+
+	viper.SetDefault("client.bookmark-threshold", 20*time.Minute)
+	conf.BookmarkThreshold = viper.GetDuration("client.bookmark-threshold")
+
+	viper.SetDefault("client.persist-queue", true)
+	conf.PersistQueue = viper.GetBool("client.persist-queue")
+	conf.ResumePlaying = viper.GetBool("client.resume-playing")
+	conf.StateFile = viper.GetString("client.state-file")
+	if conf.StateFile == "" {
+		if cacheDir, err := CacheDir(); err == nil {
+			conf.StateFile = filepath.Join(cacheDir, "state.json")
+		}
+	}
+
+	viper.SetDefault("client.cover-art-cache-mb", 100)
+	conf.CoverArtCacheSize = viper.GetInt64("client.cover-art-cache-mb") * 1024 * 1024
+	if conf.CoverArtCacheSize > 0 {
+		if cacheDir, err := CacheDir(); err == nil {
+			conf.CoverArtCacheDir = filepath.Join(cacheDir, "coverart")
+		}
+	}
+
+	conf.LibraryCacheFile = viper.GetString("client.library-cache")
+	if conf.LibraryCacheFile == "" {
+		if cacheDir, err := CacheDir(); err == nil {
+			conf.LibraryCacheFile = filepath.Join(cacheDir, "library.json")
+		}
+	}
+	viper.SetDefault("client.library-cache-ttl", 24*time.Hour)
+	conf.LibraryCacheTTL = viper.GetDuration("client.library-cache-ttl")
+
+	viper.SetDefault("client.offline-cache-mb", 4096)
+	conf.OfflineSize = viper.GetInt64("client.offline-cache-mb") * 1024 * 1024
+	conf.OfflineDir = viper.GetString("client.offline-dir")
+	if conf.OfflineDir == "" {
+		if cacheDir, err := CacheDir(); err == nil {
+			conf.OfflineDir = filepath.Join(cacheDir, "offline")
+		}
+	}
+
+	conf.KeyBindingsFile = viper.GetString("client.keybindings")
+	if conf.KeyBindingsFile == "" {
+		if configDir, err := ConfigDir(); err == nil {
+			path := filepath.Join(configDir, "keybindings.toml")
+			if _, err := os.Stat(path); err == nil {
+				conf.KeyBindingsFile = path
+			}
+		}
+	}
 
 	externalPlayerOptions := viper.Sub("mpv")
 	playerOptions := make(map[string]string)
@@ -59,6 +178,9 @@ func InitConfig() *Config {
 	playerOptions["terminal"] = "no"
 	playerOptions["demuxer-max-bytes"] = "30MiB"
 	playerOptions["audio-client-name"] = "stmp"
+	// the next song is appended to mpv's playlist, load it before it's needed
+	playerOptions["prefetch-playlist"] = "yes"
+	playerOptions["gapless-audio"] = "weak"
 
 	if externalPlayerOptions != nil {
 		opts := externalPlayerOptions.AllSettings()
@@ -71,6 +193,42 @@ func InitConfig() *Config {
 	return &conf
 }
 
+// streamProfiles reads the [streaming] section: format and max-bitrate make
+// the "default" profile, which is used on startup unless profile names
+// another one. More profiles are set in [streaming.profiles.<name>].
+func streamProfiles() ([]StreamProfile, string) {
+	profiles := []StreamProfile{OriginalStreamProfile}
+	startup := viper.GetString("streaming.profile")
+
+	format := viper.GetString("streaming.format")
+	maxBitRate := viper.GetInt("streaming.max-bitrate")
+	if format != "" || maxBitRate > 0 {
+		profiles = append(profiles, StreamProfile{Name: "default", Format: format, MaxBitRate: maxBitRate})
+		if startup == "" {
+			startup = "default"
+		}
+	}
+
+	var names []string
+	for name := range viper.GetStringMap("streaming.profiles") {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		key := "streaming.profiles." + name
+		profiles = append(profiles, StreamProfile{
+			Name:       name,
+			Format:     viper.GetString(key + ".format"),
+			MaxBitRate: viper.GetInt(key + ".max-bitrate"),
+		})
+	}
+
+	if startup == "" {
+		startup = OriginalStreamProfile.Name
+	}
+	return profiles, startup
+}
+
 func InitConfigProvider() *ConfigProviderImpl {
 	conf := InitConfig()
 	rawLogger := InitLogger(Info)
@@ -0,0 +1,26 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// CacheDir returns the directory for stmps' cached and state files, e.g.
+// ~/.cache/stmps on Linux. It is not created.
+func CacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "stmps"), nil
+}
+
+// ConfigDir returns the directory of stmps' config files, e.g.
+// ~/.config/stmps on Linux.
+func ConfigDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".config", "stmps"), nil
+}